@@ -0,0 +1,240 @@
+// The `dbtool` package provides the inventory DB command
+// line tool. Applications build the tool with their models;
+// the tool is not usable without them (only the internal
+// tables would be known) and fails with ExitUsage.
+//
+// Example:
+//
+//	func main() {
+//	    tool := dbtool.Tool{
+//	        Models: []interface{}{&Person{}, &Group{}},
+//	    }
+//	    os.Exit(tool.Main(os.Args[1:]))
+//	}
+//
+// Usage:
+//
+//	tool -db <path> export [-o file] [kind...]
+//	tool -db <path> import [-i file]
+//	tool -db <path> check [-repair delete|null]
+package dbtool
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	liberr "github.com/konveyor/controller/pkg/error"
+	"github.com/konveyor/controller/pkg/inventory/model"
+)
+
+// Exit codes.
+const (
+	ExitOk    = 0
+	ExitError = 1
+	ExitUsage = 2
+)
+
+// DB command line tool.
+type Tool struct {
+	// Data models (required).
+	// Supplied by the application.
+	Models []interface{}
+	// Standard output.
+	// Default: os.Stdout.
+	Stdout io.Writer
+	// Standard input.
+	// Default: os.Stdin.
+	Stdin io.Reader
+	// Standard error.
+	// Default: os.Stderr.
+	Stderr io.Writer
+	// Opened DB.
+	db model.DB
+}
+
+// Run the tool with the command line arguments.
+// Returns the process exit code.
+func (t *Tool) Main(args []string) (code int) {
+	t.defaults()
+	flags := flag.NewFlagSet("dbtool", flag.ContinueOnError)
+	flags.SetOutput(t.Stderr)
+	path := flags.String("db", "", "DB file path.")
+	err := flags.Parse(args)
+	if err != nil {
+		code = ExitUsage
+		return
+	}
+	args = flags.Args()
+	if len(t.Models) == 0 {
+		fmt.Fprintln(t.Stderr, "models not specified.")
+		code = ExitUsage
+		return
+	}
+	if *path == "" || len(args) == 0 {
+		t.usage()
+		code = ExitUsage
+		return
+	}
+	t.db = model.New(*path, t.Models...)
+	err = t.db.Open(false)
+	if err != nil {
+		fmt.Fprintln(t.Stderr, err)
+		code = ExitError
+		return
+	}
+	defer func() {
+		_ = t.db.Close(false)
+	}()
+	command, args := args[0], args[1:]
+	switch command {
+	case "export":
+		err = t.export(args)
+	case "import":
+		err = t.importer(args)
+	case "check":
+		err = t.check(args)
+	default:
+		t.usage()
+		code = ExitUsage
+		return
+	}
+	if err != nil {
+		fmt.Fprintln(t.Stderr, err)
+		code = ExitError
+	}
+
+	return
+}
+
+// Export command.
+// Models are written to the output file or stdout.
+func (t *Tool) export(args []string) (err error) {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	flags.SetOutput(t.Stderr)
+	path := flags.String("o", "", "Output file path.")
+	err = flags.Parse(args)
+	if err != nil {
+		return
+	}
+	writer := t.Stdout
+	if *path != "" {
+		var f *os.File
+		f, err = os.Create(*path)
+		if err != nil {
+			err = liberr.Wrap(err)
+			return
+		}
+		defer func() {
+			_ = f.Close()
+		}()
+		writer = f
+	}
+	err = t.db.Export(writer, flags.Args()...)
+	return
+}
+
+// Import command.
+// Models are read from the input file or stdin.
+func (t *Tool) importer(args []string) (err error) {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	flags.SetOutput(t.Stderr)
+	path := flags.String("i", "", "Input file path.")
+	err = flags.Parse(args)
+	if err != nil {
+		return
+	}
+	reader := t.Stdin
+	if *path != "" {
+		var f *os.File
+		f, err = os.Open(*path)
+		if err != nil {
+			err = liberr.Wrap(err)
+			return
+		}
+		defer func() {
+			_ = f.Close()
+		}()
+		reader = f
+	}
+	err = t.db.Import(reader)
+	return
+}
+
+// Check command.
+// Orphans are reported (by relation) and optionally repaired.
+// Fails when orphans are found and not repaired.
+func (t *Tool) check(args []string) (err error) {
+	flags := flag.NewFlagSet("check", flag.ContinueOnError)
+	flags.SetOutput(t.Stderr)
+	repair := flags.String("repair", "", "Repair orphans (delete|null).")
+	err = flags.Parse(args)
+	if err != nil {
+		return
+	}
+	options := model.IntegrityOptions{}
+	switch *repair {
+	case "":
+	case "delete":
+		options.Repair = model.RepairDelete
+	case "null":
+		options.Repair = model.RepairNull
+	default:
+		err = liberr.New(
+			"repair not valid.",
+			"repair",
+			*repair)
+		return
+	}
+	report, err := t.db.CheckIntegrity(options)
+	if err != nil {
+		return
+	}
+	for _, orphans := range report {
+		action := "found"
+		if orphans.Repaired {
+			action = "repaired"
+		}
+		fmt.Fprintf(
+			t.Stdout,
+			"%s.%s -> %s: %d orphan(s) %s.\n",
+			orphans.Kind,
+			orphans.Field,
+			orphans.RefKind,
+			len(orphans.Pks),
+			action)
+		for _, pk := range orphans.Pks {
+			fmt.Fprintf(t.Stdout, "  %s\n", pk)
+		}
+	}
+	if len(report) > 0 && options.Repair == model.NoRepair {
+		err = liberr.New(
+			"orphans found.",
+			"relations",
+			len(report))
+	}
+
+	return
+}
+
+// Print usage.
+func (t *Tool) usage() {
+	fmt.Fprintln(t.Stderr, "Usage:")
+	fmt.Fprintln(t.Stderr, "  -db <path> export [-o file] [kind...]")
+	fmt.Fprintln(t.Stderr, "  -db <path> import [-i file]")
+	fmt.Fprintln(t.Stderr, "  -db <path> check [-repair delete|null]")
+}
+
+// Set defaults.
+func (t *Tool) defaults() {
+	if t.Stdout == nil {
+		t.Stdout = os.Stdout
+	}
+	if t.Stdin == nil {
+		t.Stdin = os.Stdin
+	}
+	if t.Stderr == nil {
+		t.Stderr = os.Stderr
+	}
+}
@@ -0,0 +1,143 @@
+package dbtool
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/konveyor/controller/pkg/inventory/model"
+	"github.com/onsi/gomega"
+)
+
+type Person struct {
+	ID     int    `sql:"pk"`
+	Name   string `sql:""`
+	labels model.Labels
+}
+
+func (m *Person) Pk() string {
+	return fmt.Sprintf("%d", m.ID)
+}
+
+func (m *Person) Labels() model.Labels {
+	return m.labels
+}
+
+type Pet struct {
+	ID    int `sql:"pk"`
+	Owner int `sql:"fk(Person)"`
+}
+
+func (m *Pet) Pk() string {
+	return fmt.Sprintf("%d", m.ID)
+}
+
+func TestTool(t *testing.T) {
+	var err error
+	g := gomega.NewGomegaWithT(t)
+	path := "/tmp/test-dbtool.db"
+	path2 := "/tmp/test-dbtool-2.db"
+	export := "/tmp/test-dbtool.ndjson"
+	defer func() {
+		_ = os.Remove(path2)
+		_ = os.Remove(export)
+	}()
+	models := []interface{}{&Person{}, &Pet{}}
+	DB := model.New(path, models...)
+	err = DB.Open(true)
+	g.Expect(err).To(gomega.BeNil())
+	for i := 0; i < 3; i++ {
+		err = DB.Insert(
+			&Person{
+				ID:     i,
+				Name:   "Elmer",
+				labels: model.Labels{"id": fmt.Sprintf("v%d", i)},
+			})
+		g.Expect(err).To(gomega.BeNil())
+		err = DB.Insert(&Pet{ID: i, Owner: i})
+		g.Expect(err).To(gomega.BeNil())
+	}
+	// Orphan.
+	err = DB.Insert(&Pet{ID: 9, Owner: 9})
+	g.Expect(err).To(gomega.BeNil())
+	err = DB.Close(false)
+	g.Expect(err).To(gomega.BeNil())
+	defer func() {
+		_ = os.Remove(path)
+	}()
+	run := func(args ...string) (code int, stdout, stderr string) {
+		out := &bytes.Buffer{}
+		errOut := &bytes.Buffer{}
+		tool := Tool{
+			Models: models,
+			Stdout: out,
+			Stderr: errOut,
+		}
+		code = tool.Main(args)
+		stdout = out.String()
+		stderr = errOut.String()
+		return
+	}
+	// Usage.
+	code, _, stderr := run("export")
+	g.Expect(code).To(gomega.Equal(ExitUsage))
+	g.Expect(stderr).To(gomega.ContainSubstring("Usage:"))
+	code, _, _ = run("-db", path, "unknown")
+	g.Expect(code).To(gomega.Equal(ExitUsage))
+	tool := Tool{Stderr: &bytes.Buffer{}}
+	code = tool.Main([]string{"-db", path, "export"})
+	g.Expect(code).To(gomega.Equal(ExitUsage))
+	// Export.
+	code, stdout, _ := run("-db", path, "export", "Person")
+	g.Expect(code).To(gomega.Equal(ExitOk))
+	g.Expect(strings.Count(stdout, "\n")).To(gomega.Equal(3))
+	code, _, stderr = run("-db", path, "export", "Unknown")
+	g.Expect(code).To(gomega.Equal(ExitError))
+	g.Expect(stderr).ToNot(gomega.BeEmpty())
+	// Check.
+	code, stdout, _ = run("-db", path, "check")
+	g.Expect(code).To(gomega.Equal(ExitError))
+	g.Expect(stdout).To(gomega.ContainSubstring("Pet.Owner -> Person: 1 orphan(s) found."))
+	code, _, _ = run("-db", path, "check", "-repair", "bad")
+	g.Expect(code).To(gomega.Equal(ExitError))
+	code, stdout, _ = run("-db", path, "check", "-repair", "delete")
+	g.Expect(code).To(gomega.Equal(ExitOk))
+	g.Expect(stdout).To(gomega.ContainSubstring("1 orphan(s) repaired."))
+	code, _, _ = run("-db", path, "check")
+	g.Expect(code).To(gomega.Equal(ExitOk))
+	code, _, _ = run("-db", path, "export", "-o", export)
+	g.Expect(code).To(gomega.Equal(ExitOk))
+	// Import.
+	DB2 := model.New(path2, models...)
+	err = DB2.Open(true)
+	g.Expect(err).To(gomega.BeNil())
+	err = DB2.Close(false)
+	g.Expect(err).To(gomega.BeNil())
+	code, _, stderr = run("-db", path2, "import", "-i", export)
+	g.Expect(code).To(gomega.Equal(ExitOk))
+	g.Expect(stderr).To(gomega.BeEmpty())
+	DB2 = model.New(path2, models...)
+	err = DB2.Open(false)
+	g.Expect(err).To(gomega.BeNil())
+	defer func() {
+		_ = DB2.Close(true)
+	}()
+	for _, m := range models {
+		n, err := DB2.Count(m.(model.Model), nil)
+		g.Expect(err).To(gomega.BeNil())
+		g.Expect(n).To(gomega.Equal(int64(3)))
+	}
+	list := []Person{}
+	err = DB2.List(
+		&list,
+		model.ListOptions{
+			Predicate: model.Match(model.Labels{"id": "v1"}),
+		})
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(list).To(gomega.HaveLen(1))
+	code, _, stderr = run("-db", path2, "import", "-i", "/tmp/not-found.ndjson")
+	g.Expect(code).To(gomega.Equal(ExitError))
+	g.Expect(stderr).ToNot(gomega.BeEmpty())
+}
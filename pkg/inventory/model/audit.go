@@ -0,0 +1,125 @@
+package model
+
+import (
+	"time"
+
+	liberr "github.com/konveyor/controller/pkg/error"
+	"github.com/konveyor/controller/pkg/ref"
+)
+
+// Audit table.
+const auditKind = "Audit"
+
+// Transaction metadata.
+// Describes who or what made the changes and why.
+type TxMeta struct {
+	// Actor (user, controller, ...).
+	Actor string `json:"actor,omitempty"`
+	// Reason for the change.
+	Reason string `json:"reason,omitempty"`
+	// Correlation ID.
+	Correlation string `json:"correlation,omitempty"`
+	// Labels.
+	Labels []string `json:"labels,omitempty"`
+}
+
+// Audit (change) entry.
+// Stored for each change when the audit trail is enabled.
+type Audit struct {
+	PK string `sql:"pk(revision;seq)"`
+	// Commit revision.
+	Revision int64 `sql:"index(revision)"`
+	// Sequence within the transaction.
+	Seq int `sql:""`
+	// Model kind.
+	Kind string `sql:"index(model)"`
+	// Model primary key.
+	Key string `sql:"index(model)"`
+	// Action (created|updated|deleted).
+	Action string `sql:""`
+	// Actor.
+	Actor string `sql:""`
+	// Reason.
+	Reason string `sql:""`
+	// Correlation ID.
+	Correlation string `sql:"index(correlation)"`
+	// Labels.
+	Labels []string `sql:""`
+	// Timestamp (unix).
+	Timestamp int64 `sql:""`
+}
+
+func (m *Audit) Pk() string {
+	return m.PK
+}
+
+// Enable the audit trail.
+// A change (audit) entry is stored for each model created,
+// updated and deleted. Must be called before the DB is opened;
+// ignored after.
+func (r *Client) Audit(enabled bool) {
+	if r.dm != nil {
+		return
+	}
+	r.audit = enabled
+}
+
+// Get the audit trail (history) of the model.
+// Ordered by revision (oldest first).
+func (r *Client) History(model Model) (list []Audit, err error) {
+	if !r.audit {
+		err = liberr.Wrap(AuditErr)
+		return
+	}
+	list = []Audit{}
+	err = r.List(
+		&list,
+		ListOptions{
+			Predicate: And(
+				Eq("Kind", ref.ToKind(model)),
+				Eq("Key", ModelPk(model))),
+			SortBy: []string{"Revision", "Seq"},
+			Detail: MaxDetail,
+		})
+
+	return
+}
+
+// Set the transaction metadata.
+// The labels replace the labels passed to Begin() when specified.
+func (r *Tx) SetMeta(meta TxMeta) {
+	if len(meta.Labels) == 0 {
+		meta.Labels = r.labels
+	}
+	r.labels = meta.Labels
+	r.meta = meta
+}
+
+// Get the transaction metadata.
+func (r *Tx) Meta() (meta TxMeta) {
+	meta = r.meta
+	meta.Labels = r.labels
+	return
+}
+
+// Store the audit entry for the change.
+func (r *Tx) audit(action uint8, model Model) (err error) {
+	if !r.auditing || ref.ToKind(model) == auditKind {
+		return
+	}
+	r.seq++
+	entry := &Audit{
+		Revision:    r.revision,
+		Seq:         r.seq,
+		Kind:        ref.ToKind(model),
+		Key:         ModelPk(model),
+		Action:      actionName(action),
+		Actor:       r.meta.Actor,
+		Reason:      r.meta.Reason,
+		Correlation: r.meta.Correlation,
+		Labels:      r.labels,
+		Timestamp:   time.Now().Unix(),
+	}
+	err = r.table().Insert(entry)
+	return
+}
@@ -3,12 +3,14 @@ package model
 import (
 	"database/sql"
 	"errors"
+	"io"
 	"os"
 	"time"
 
 	"github.com/go-logr/logr"
 	liberr "github.com/konveyor/controller/pkg/error"
 	fb "github.com/konveyor/controller/pkg/filebacked"
+	"github.com/konveyor/controller/pkg/ref"
 )
 
 // Database client.
@@ -25,8 +27,12 @@ type DB interface {
 	List(interface{}, ListOptions) error
 	// Find models.
 	Find(interface{}, ListOptions) (fb.Iterator, error)
+	// Stream models.
+	Stream(interface{}, ListOptions) (*Cursor, error)
 	// Count based on the specified model.
 	Count(Model, Predicate) (int64, error)
+	// Read within a consistent snapshot.
+	Snapshot(fn func(Reader) error) error
 	// Begin a transaction.
 	Begin(...string) (*Tx, error)
 	// With transaction.
@@ -39,8 +45,52 @@ type DB interface {
 	Delete(Model) error
 	// Watch a model collection.
 	Watch(Model, EventHandler) (*Watch, error)
+	// Enable the audit trail.
+	Audit(bool)
+	// Set the SQL dialect.
+	Dialect(Dialect)
+	// Watch multiple (or all) model kinds.
+	WatchKinds([]Model, EventHandler) (*Watch, error)
 	// End a watch.
 	EndWatch(watch *Watch)
+	// Export models as NDJSON.
+	Export(io.Writer, ...string) error
+	// Purge expired models.
+	Purge() (int, error)
+	// Run maintenance tasks.
+	Maintain() error
+	// Get the schema.
+	Schema() Schema
+	// Get the session pool state.
+	Sessions() []SessionState
+	// Get the current (committed) revision.
+	Revision() (int64, error)
+	// Get the audit trail of a model.
+	History(Model) ([]Audit, error)
+	// Register a projection.
+	Project(Projection) error
+	// Rebuild projections.
+	Rebuild(...string) error
+	// Get the ancestors of a model.
+	Ancestors(Model, GraphOptions) (*Graph, error)
+	// Get the descendants of a model.
+	Descendants(Model, GraphOptions) (*Graph, error)
+	// Check referential integrity.
+	CheckIntegrity(IntegrityOptions) ([]Orphans, error)
+	// Register an event sink.
+	Sink(EventSink) error
+	// Remove an event sink (and cursor).
+	RemoveSink(string) error
+	// Deliver the outbox to the sinks.
+	Deliver() error
+	// Get the count of models of the kind.
+	Tally(Model) int64
+	// Get the count of models of the kind with the label.
+	TallyLabel(Model, string, string) int64
+	// Reconcile the counters with the DB.
+	Reconcile() error
+	// Import models exported as NDJSON.
+	Import(io.Reader) error
 }
 
 // Database client.
@@ -55,33 +105,88 @@ type Client struct {
 	pool Pool
 	// Journal
 	journal Journal
+	// Expired model janitor.
+	janitor janitor
+	// Maintenance scheduler.
+	maintenance maintenance
+	// Session leak detector.
+	leakDetector leakDetector
+	// Sink (outbox) delivery.
+	sinkDelivery sinkDelivery
+	// Model counters.
+	counters counters
+	// Operation interceptor.
+	interceptor Interceptor
+	// Audit trail enabled.
+	audit bool
+	// SQL dialect.
+	dialect Dialect
+	// Registered projections.
+	projections projections
 	// Logger
 	log logr.Logger
 }
 
 // Create the database.
 // Build the schema to support the specified models.
+// Returns an error when the DB cannot be opened. The DB
+// file is deleted on error only when `delete` is true.
 // See: Pool.Open().
 func (r *Client) Open(delete bool) (err error) {
 	if delete {
 		_ = os.Remove(r.path)
 		r.log.V(3).Info("DB file deleted.")
 	}
+	r.pool.dialect = r.dialect
 	err = r.pool.Open(1, 10, r.path, &r.journal)
 	if err != nil {
 		r.log.V(3).Error(err, "open session pool failed.")
-		panic(err)
+		return
 	}
 	defer func() {
 		if err != nil {
 			_ = r.pool.Close()
-			_ = os.Remove(r.path)
+			if delete {
+				_ = os.Remove(r.path)
+			}
 		}
 	}()
 	err = r.build()
 	if err != nil {
-		panic(err)
+		return
+	}
+	err = r.Reconcile()
+	if err != nil {
+		return
+	}
+	err = r.openOutbox()
+	if err != nil {
+		return
 	}
+	r.janitor = janitor{
+		client:   r,
+		interval: JanitorInterval,
+		batch:    JanitorBatch,
+	}
+	r.janitor.Start()
+	r.maintenance = maintenance{
+		client:    r,
+		interval:  MaintenanceInterval,
+		integrity: IntegrityInterval,
+	}
+	r.maintenance.Start()
+	r.leakDetector = leakDetector{
+		client:    r,
+		interval:  LeakCheckInterval,
+		threshold: LeakThreshold,
+		lifespan:  TxMaxLifespan,
+	}
+	r.leakDetector.Start()
+	r.sinkDelivery = sinkDelivery{
+		client:   r,
+		interval: SinkInterval,
+	}
+	r.sinkDelivery.Start()
 
 	r.log.V(3).Info("session pool opened.")
 
@@ -91,6 +196,10 @@ func (r *Client) Open(delete bool) (err error) {
 // Close the database.
 // The session pool and journal are closed.
 func (r *Client) Close(delete bool) (err error) {
+	r.janitor.Shutdown()
+	r.maintenance.Shutdown()
+	r.leakDetector.Shutdown()
+	r.sinkDelivery.Shutdown()
 	jErr := r.journal.Close()
 	if jErr != nil {
 		r.log.Error(
@@ -113,6 +222,40 @@ func (r *Client) Close(delete bool) (err error) {
 	return
 }
 
+// Purge expired models.
+// Models with a `ttl` field older than the TTL are
+// deleted; a zero timestamp never expires. Kinds that
+// fail to be purged do not prevent other kinds from being
+// purged. Returns the number of models purged and the
+// first error.
+func (r *Client) Purge() (n int, err error) {
+	n, err = r.janitor.Purge()
+	return
+}
+
+// Get the schema.
+// Describes the data model.
+func (r *Client) Schema() (schema Schema) {
+	schema = r.dm.Schema()
+	return
+}
+
+// Get the session pool state.
+// Reserved sessions include the age and the caller
+// stack. Intended for debugging.
+func (r *Client) Sessions() (state []SessionState) {
+	state = r.pool.State()
+	return
+}
+
+// Run maintenance tasks.
+// Includes the integrity check. A failed
+// integrity check returns IntegrityErr.
+func (r *Client) Maintain() (err error) {
+	err = r.maintenance.Run(true)
+	return
+}
+
 // Execute SQL.
 // Delegated to Tx.Execute().
 func (r *Client) Execute(sql string) (result sql.Result, err error) {
@@ -129,7 +272,7 @@ func (r *Client) Get(model Model) (err error) {
 	session := r.pool.Reader()
 	defer session.Return()
 	mark := time.Now()
-	err = Table{session.db}.Get(model)
+	err = r.table(session.db).Get(model)
 	if err == nil {
 		r.log.V(4).Info(
 			"get succeeded.",
@@ -148,7 +291,7 @@ func (r *Client) List(list interface{}, options ListOptions) (err error) {
 	session := r.pool.Reader()
 	defer session.Return()
 	mark := time.Now()
-	err = Table{session.db}.List(list, options)
+	err = r.table(session.db).List(list, options)
 	if err == nil {
 		r.log.V(4).Info(
 			"list succeeded.",
@@ -166,7 +309,7 @@ func (r *Client) Find(model interface{}, options ListOptions) (itr fb.Iterator,
 	session := r.pool.Reader()
 	defer session.Return()
 	mark := time.Now()
-	itr, err = Table{session.db}.Find(model, options)
+	itr, err = r.table(session.db).Find(model, options)
 	if err == nil {
 		r.log.V(4).Info(
 			"list succeeded.",
@@ -179,12 +322,33 @@ func (r *Client) Find(model interface{}, options ListOptions) (itr fb.Iterator,
 	return
 }
 
+// Stream models.
+// The returned cursor holds a reader session until closed.
+func (r *Client) Stream(model interface{}, options ListOptions) (cursor *Cursor, err error) {
+	session := r.pool.Reader()
+	mark := time.Now()
+	cursor, err = r.table(session.db).Stream(model, options)
+	if err != nil {
+		session.Return()
+		return
+	}
+	cursor.session = session
+	r.log.V(4).Info(
+		"stream succeeded.",
+		"options",
+		options,
+		"duration",
+		time.Since(mark))
+
+	return
+}
+
 // Count models.
 func (r *Client) Count(model Model, predicate Predicate) (n int64, err error) {
 	session := r.pool.Reader()
 	defer session.Return()
 	mark := time.Now()
-	n, err = Table{session.db}.Count(model, predicate)
+	n, err = r.table(session.db).Count(model, predicate)
 	if err == nil {
 		r.log.V(4).Info(
 			"count succeeded.",
@@ -198,7 +362,7 @@ func (r *Client) Count(model Model, predicate Predicate) (n int64, err error) {
 }
 
 // Begin a transaction.
-func (r *Client) Begin(labels ...string) (tx *Tx, error error) {
+func (r *Client) Begin(labels ...string) (tx *Tx, err error) {
 	mark := time.Now()
 	session := r.pool.Writer()
 	realTx, err := session.Begin()
@@ -209,6 +373,7 @@ func (r *Client) Begin(labels ...string) (tx *Tx, error error) {
 			r.path)
 		return
 	}
+	delta := counterDelta{}
 	tx = &Tx{
 		session: session,
 		real:    realTx,
@@ -216,12 +381,20 @@ func (r *Client) Begin(labels ...string) (tx *Tx, error error) {
 		staged:  fb.NewList(),
 		dm:      r.dm,
 		labeler: Labeler{
-			tx:  realTx,
-			log: r.log,
+			tx:      realTx,
+			dialect: r.dialect,
+			log:     r.log,
+			delta:   delta,
 		},
-		started: time.Now(),
-		labels:  labels,
-		log:     r.log,
+		started:     time.Now(),
+		labels:      labels,
+		interceptor: r.interceptor,
+		auditing:    r.audit,
+		dialect:     r.dialect,
+		projections: r.projections.list(),
+		counters:    &r.counters,
+		delta:       delta,
+		log:         r.log,
 	}
 
 	r.log.V(4).Info("tx begin.", "duration", time.Since(mark))
@@ -317,22 +490,78 @@ func (r *Client) Watch(model Model, handler EventHandler) (w *Watch, err error)
 		}
 	}()
 	options := handler.Options()
-	var snapshot fb.Iterator
-	if options.Snapshot {
+	var snapshot Iterator
+	switch {
+	case options.Snapshot && options.Stream:
+		snapshot, err = r.Stream(model, ListOptions{Detail: MaxDetail})
+	case options.Snapshot:
 		snapshot, err = r.Find(model, ListOptions{Detail: MaxDetail})
-		if err != nil {
+	default:
+		snapshot = &fb.EmptyIterator{}
+	}
+	if err != nil {
+		return
+	}
+
+	w.Start(snapshot)
+
+	r.log.V(4).Info(
+		"watch started.",
+		"model",
+		Describe(model),
+		"options",
+		options,
+		"duration",
+		time.Since(mark))
+
+	return
+}
+
+// Watch model events for the specified models (kinds).
+// All (application) kinds are watched when no models are
+// specified. The snapshot of all kinds is listed within a
+// single read transaction (in dependency order) and is
+// followed by a single Parity marker. Events are delivered
+// in commit order. The snapshot is always detached.
+// Returns KindErr when a model is not in the data model.
+func (r *Client) WatchKinds(models []Model, handler EventHandler) (w *Watch, err error) {
+	mark := time.Now()
+	for _, m := range models {
+		if _, found := r.dm.FindWith(m); !found {
+			err = liberr.Wrap(
+				KindErr,
+				"kind",
+				Definition{}.kind(m))
 			return
 		}
+	}
+	w, err = r.journal.WatchKinds(models, handler)
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			w.End()
+			w = nil
+		}
+	}()
+	options := handler.Options()
+	var snapshot Iterator
+	if options.Snapshot {
+		snapshot, err = r.snapshot(models)
 	} else {
 		snapshot = &fb.EmptyIterator{}
 	}
+	if err != nil {
+		return
+	}
 
 	w.Start(snapshot)
 
 	r.log.V(4).Info(
 		"watch started.",
 		"model",
-		Describe(model),
+		w.kind(),
 		"options",
 		options,
 		"duration",
@@ -341,22 +570,79 @@ func (r *Client) Watch(model Model, handler EventHandler) (w *Watch, err error)
 	return
 }
 
+// Build the (combined) watch snapshot.
+// Listed within a single read transaction in
+// dependency order.
+func (r *Client) snapshot(models []Model) (itr Iterator, err error) {
+	kinds := make(map[string]bool)
+	for _, m := range models {
+		md, found := r.dm.FindWith(m)
+		if !found {
+			err = liberr.Wrap(
+				KindErr,
+				"kind",
+				Definition{}.kind(m))
+			return
+		}
+		kinds[md.Kind] = true
+	}
+	list := iterators{}
+	err = r.Snapshot(func(reader Reader) (err error) {
+		relation := FkRelation{dm: r.dm}
+		for _, md := range relation.Definitions() {
+			if len(kinds) > 0 {
+				if !kinds[md.Kind] {
+					continue
+				}
+			} else {
+				if !application(md.Kind) {
+					continue
+				}
+			}
+			var found fb.Iterator
+			found, err = reader.Find(md.NewModel(), ListOptions{Detail: MaxDetail})
+			if err != nil {
+				return
+			}
+			list = append(list, found)
+		}
+		return
+	})
+	if err != nil {
+		list.Close()
+		return
+	}
+
+	itr = &list
+
+	return
+}
+
 // End watch.
 func (r *Client) EndWatch(watch *Watch) {
 	r.journal.End(watch)
 	r.log.V(4).Info(
 		"watch ended.",
 		"model",
-		Describe(watch.Model))
+		watch.kind())
 }
 
 // Build the data model.
 func (r *Client) build() (err error) {
-	r.models = append(r.models, &Label{})
+	r.models = append(
+		r.models,
+		&Label{},
+		&Revision{},
+		&Outbox{},
+		&SinkCursor{})
+	if r.audit {
+		r.models = append(r.models, &Audit{})
+	}
 	r.dm, err = NewModel(r.models)
 	if err != nil {
 		return err
 	}
+	r.dm.bind(r.dialect)
 	ddls, err := r.dm.DDL()
 	if err != nil {
 		return err
@@ -378,6 +664,10 @@ func (r *Client) build() (err error) {
 				ddl)
 		}
 	}
+	err = r.buildRevision(session)
+	if err != nil {
+		return err
+	}
 
 	return nil
 }
@@ -402,15 +692,39 @@ type Tx struct {
 	started time.Time
 	// Labels associated with the transaction.
 	labels []string
+	// Operation interceptor.
+	interceptor Interceptor
+	// Commit revision (0=no changes).
+	revision int64
+	// Metadata.
+	meta TxMeta
+	// Projections.
+	projections []*Projection
+	// Model counters.
+	counters *counters
+	// Counter deltas applied on commit.
+	delta counterDelta
+	// Audit trail enabled.
+	auditing bool
+	// Audit (change) sequence.
+	seq int
+	// SQL dialect.
+	dialect Dialect
 	// Ended.
 	ended bool
 }
 
 // Execute SQL.
 func (r *Tx) Execute(sql string) (result sql.Result, err error) {
+	err = r.aborted()
+	if err != nil {
+		return
+	}
 	mark := time.Now()
 	result, err = r.real.Exec(sql)
 	if err == nil {
+		nRows, _ := result.RowsAffected()
+		Metrics.Operation(OpExecute, "", time.Since(mark), nRows)
 		r.log.V(4).Info(
 			"execute succeeded.",
 			"sql",
@@ -424,8 +738,12 @@ func (r *Tx) Execute(sql string) (result sql.Result, err error) {
 
 // Get the model.
 func (r *Tx) Get(model Model) (err error) {
+	err = r.aborted()
+	if err != nil {
+		return
+	}
 	mark := time.Now()
-	err = Table{r.real}.Get(model)
+	err = r.table().Get(model)
 	if err == nil {
 		r.log.V(4).Info(
 			"get succeeded.",
@@ -441,8 +759,12 @@ func (r *Tx) Get(model Model) (err error) {
 // List models.
 // The `list` must be: *[]Model.
 func (r *Tx) List(list interface{}, options ListOptions) (err error) {
+	err = r.aborted()
+	if err != nil {
+		return
+	}
 	mark := time.Now()
-	err = Table{r.real}.List(list, options)
+	err = r.table().List(list, options)
 	if err == nil {
 		r.log.V(4).Info(
 			"list succeeded.",
@@ -457,8 +779,12 @@ func (r *Tx) List(list interface{}, options ListOptions) (err error) {
 
 // List models.
 func (r *Tx) Find(model interface{}, options ListOptions) (itr fb.Iterator, err error) {
+	err = r.aborted()
+	if err != nil {
+		return
+	}
 	mark := time.Now()
-	itr, err = Table{r.real}.Find(model, options)
+	itr, err = r.table().Find(model, options)
 	if err == nil {
 		r.log.V(4).Info(
 			"iter succeeded",
@@ -471,10 +797,36 @@ func (r *Tx) Find(model interface{}, options ListOptions) (itr fb.Iterator, err
 	return
 }
 
+// Stream models.
+// The returned cursor must be closed before the
+// transaction is committed or ended.
+func (r *Tx) Stream(model interface{}, options ListOptions) (cursor *Cursor, err error) {
+	err = r.aborted()
+	if err != nil {
+		return
+	}
+	mark := time.Now()
+	cursor, err = r.table().Stream(model, options)
+	if err == nil {
+		r.log.V(4).Info(
+			"stream succeeded.",
+			"options",
+			options,
+			"duration",
+			time.Since(mark))
+	}
+
+	return
+}
+
 // Count models.
 func (r *Tx) Count(model Model, predicate Predicate) (n int64, err error) {
+	err = r.aborted()
+	if err != nil {
+		return
+	}
 	mark := time.Now()
-	n, err = Table{r.real}.Count(model, predicate)
+	n, err = r.table().Count(model, predicate)
 	if err == nil {
 		r.log.V(4).Info(
 			"count succeeded.",
@@ -487,20 +839,46 @@ func (r *Tx) Count(model Model, predicate Predicate) (n int64, err error) {
 }
 
 // Insert the model.
+// An existing model is replaced (upsert) along with
+// its labels.
 func (r *Tx) Insert(model Model) (err error) {
+	err = r.before(OpInsert, model)
+	if err != nil {
+		return
+	}
+	defer func() {
+		r.after(OpInsert, model, err)
+	}()
 	mark := time.Now()
-	err = Table{r.real}.Insert(model)
+	err = r.stamp(model)
 	if err != nil {
 		return
 	}
+	inserted, err := r.table().insert(model)
+	if err != nil {
+		return
+	}
+	if inserted {
+		r.delta.kind(ref.ToKind(model), 1)
+	}
 	event := Event{
-		ID:     serial.next(1),
-		Labels: r.labels,
-		Action: Created,
-		Model:  model,
+		ID:       serial.next(1),
+		Labels:   r.labels,
+		Action:   Created,
+		Model:    model,
+		Revision: r.revision,
 	}
 	event.append(r.staged)
-	err = r.labeler.Insert(model)
+	err = r.audit(Created, model)
+	if err != nil {
+		return
+	}
+	if inserted {
+		err = r.labeler.Insert(model)
+	} else {
+		// Upserted; labels replaced.
+		err = r.labeler.Replace(model)
+	}
 	if err != nil {
 		return
 	}
@@ -517,25 +895,41 @@ func (r *Tx) Insert(model Model) (err error) {
 
 // Update the model.
 func (r *Tx) Update(model Model, predicate ...Predicate) (err error) {
+	err = r.before(OpUpdate, model)
+	if err != nil {
+		return
+	}
+	defer func() {
+		r.after(OpUpdate, model, err)
+	}()
 	mark := time.Now()
 	current := model
 	current = Clone(model)
-	err = Table{r.real}.Get(current)
+	err = r.table().Get(current)
 	if err != nil {
 		return
 	}
-	err = Table{r.real}.Update(model, predicate...)
+	err = r.stamp(model)
+	if err != nil {
+		return
+	}
+	err = r.table().Update(model, predicate...)
 	if err != nil {
 		return
 	}
 	event := Event{
-		ID:      serial.next(1),
-		Labels:  r.labels,
-		Action:  Updated,
-		Model:   current,
-		Updated: model,
+		ID:       serial.next(1),
+		Labels:   r.labels,
+		Action:   Updated,
+		Model:    current,
+		Updated:  model,
+		Revision: r.revision,
 	}
 	event.append(r.staged)
+	err = r.audit(Updated, model)
+	if err != nil {
+		return
+	}
 	err = r.labeler.Replace(model)
 	if err != nil {
 		return
@@ -553,17 +947,35 @@ func (r *Tx) Update(model Model, predicate ...Predicate) (err error) {
 
 // Delete (cascading) of the model.
 func (r *Tx) Delete(model Model) (err error) {
-	err = Table{r.real}.Get(model)
+	err = r.before(OpDelete, model)
+	if err != nil {
+		return
+	}
+	defer func() {
+		r.after(OpDelete, model, err)
+	}()
+	err = r.table().Get(model)
 	if err != nil {
 		if errors.Is(err, NotFound) {
 			return
 		}
 		return
 	}
-	cascaded, err := r.dm.Deleted(r, model)
+	cascaded, nulled, err := r.dm.Deleted(r, model)
 	if err != nil {
 		return
 	}
+	for {
+		m, hasNext := nulled.Next()
+		if hasNext {
+			err = r.Update(m.(Model))
+			if err != nil {
+				return
+			}
+		} else {
+			break
+		}
+	}
 	for {
 		m, hasNext := cascaded.Next()
 		if hasNext {
@@ -583,8 +995,79 @@ func (r *Tx) Delete(model Model) (err error) {
 	return
 }
 
+// Link models using the (many-to-many) join model.
+// The join model FK fields are set and the join model
+// is inserted unless the models are already linked.
+func (r *Tx) Link(join Model, modelA, modelB Model) (err error) {
+	predicate, err := r.joined(join, modelA, modelB)
+	if err != nil {
+		return
+	}
+	n, err := r.Count(Clone(join), predicate)
+	if err != nil || n > 0 {
+		return
+	}
+	err = r.Insert(join)
+	return
+}
+
+// Unlink models joined by the (many-to-many) join model.
+// The join model(s) are deleted.
+func (r *Tx) Unlink(join Model, modelA, modelB Model) (err error) {
+	predicate, err := r.joined(join, modelA, modelB)
+	if err != nil {
+		return
+	}
+	itr, err := r.Find(join, ListOptions{Predicate: predicate})
+	if err != nil {
+		return
+	}
+	defer itr.Close()
+	for {
+		m, hasNext := itr.Next()
+		if !hasNext {
+			break
+		}
+		err = r.Delete(m.(Model))
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// Set the join model FK fields for the models.
+// Returns a predicate matching the join models.
+func (r *Tx) joined(join Model, modelA, modelB Model) (p Predicate, err error) {
+	md, err := Inspect(join)
+	if err != nil {
+		return
+	}
+	fkA, fkB, err := md.Joined(
+		md.kind(modelA),
+		md.kind(modelB))
+	if err != nil {
+		return
+	}
+	err = fkA.Owner.Set(ModelPk(modelA))
+	if err != nil {
+		return
+	}
+	err = fkB.Owner.Set(ModelPk(modelB))
+	if err != nil {
+		return
+	}
+	p = And(
+		Eq(fkA.Owner.Name, ModelPk(modelA)),
+		Eq(fkB.Owner.Name, ModelPk(modelB)))
+
+	return
+}
+
 // Commit a transaction.
-// Staged changes are committed in the DB.
+// Projections are applied and staged changes
+// are committed in the DB.
 // The transaction is ended and the session returned.
 func (r *Tx) Commit() (err error) {
 	if r.ended {
@@ -592,14 +1075,46 @@ func (r *Tx) Commit() (err error) {
 	}
 	r.ended = true
 	defer func() {
+		if err == nil {
+			r.counters.apply(r.delta)
+		}
 		r.session.Return()
+		Metrics.TxEnded(err == nil, time.Since(r.started))
 		if err == nil {
 			r.report()
 		}
 	}()
+	err = r.aborted()
+	if err != nil {
+		_ = r.real.Rollback()
+		return
+	}
+	err = r.project()
+	if err != nil {
+		_ = r.real.Rollback()
+		return
+	}
+	err = r.outbox()
+	if err != nil {
+		_ = r.real.Rollback()
+		return
+	}
+	err = r.before(OpCommit, nil)
+	if err != nil {
+		_ = r.real.Rollback()
+		return
+	}
+	defer func() {
+		r.after(OpCommit, nil, err)
+	}()
 	mark := time.Now()
 	err = r.real.Commit()
 	if err != nil {
+		if r.session.Aborted() {
+			err = liberr.Wrap(TxAbortedErr)
+			return
+		}
+		err = liberr.Wrap(mapErr(r.dialect, err, nil))
 		return
 	}
 
@@ -623,11 +1138,15 @@ func (r *Tx) End() (err error) {
 	r.ended = true
 	defer func() {
 		r.session.Return()
+		Metrics.TxEnded(false, time.Since(r.started))
 		r.staged = fb.NewList()
 	}()
 	mark := time.Now()
 	err = r.real.Rollback()
 	if err != nil {
+		if r.session.Aborted() {
+			err = liberr.Wrap(TxAbortedErr)
+		}
 		return
 	}
 
@@ -646,20 +1165,30 @@ func (r *Tx) End() (err error) {
 // The model must be complete (fetched from the DB).
 func (r *Tx) delete(model Model) (err error) {
 	mark := time.Now()
-	err = Table{r.real}.Delete(model)
+	err = r.table().Delete(model)
 	if err != nil {
 		if errors.Is(err, NotFound) {
 			err = nil
 		}
 		return
 	}
+	r.delta.kind(ref.ToKind(model), -1)
+	err = r.bump()
+	if err != nil {
+		return
+	}
 	event := Event{
-		ID:     serial.next(1),
-		Labels: r.labels,
-		Action: Deleted,
-		Model:  model,
+		ID:       serial.next(1),
+		Labels:   r.labels,
+		Action:   Deleted,
+		Model:    model,
+		Revision: r.revision,
 	}
 	event.append(r.staged)
+	err = r.audit(Deleted, model)
+	if err != nil {
+		return
+	}
 	err = r.labeler.Delete(model)
 	if err != nil {
 		return
@@ -675,6 +1204,19 @@ func (r *Tx) delete(model Model) (err error) {
 	return
 }
 
+// Table using the transaction.
+func (r *Tx) table() Table {
+	return Table{DB: r.real, Dialect: r.dialect}
+}
+
+// Aborted by the pool (TxMaxLifespan).
+func (r *Tx) aborted() (err error) {
+	if r.session.Aborted() {
+		err = liberr.Wrap(TxAbortedErr)
+	}
+	return
+}
+
 // Report staged events to the journal.
 func (r *Tx) report() {
 	if r.staged.Len() == 0 {
@@ -688,37 +1230,52 @@ func (r *Tx) report() {
 type Labeler struct {
 	// DB transaction.
 	tx *sql.Tx
+	// SQL dialect.
+	dialect Dialect
 	// Logger.
 	log logr.Logger
+	// Counter deltas.
+	delta counterDelta
 }
 
 // Insert labels for the model into the DB.
 func (r *Labeler) Insert(model Model) (err error) {
-	table := Table{r.tx}
-	kind := table.Name(model)
 	if labeled, cast := model.(Labeled); cast {
-		for l, v := range labeled.Labels() {
-			label := &Label{
-				Parent: model.Pk(),
-				Kind:   kind,
-				Name:   l,
-				Value:  v,
-			}
-			err = table.Insert(label)
-			if err != nil {
-				return
-			}
-			r.log.V(2).Info(
-				"label inserted.",
-				"model",
-				Describe(model),
-				"kind",
-				kind,
-				"label",
-				l,
-				"value",
-				v)
+		err = r.insert(model, labeled.Labels())
+	}
+
+	return
+}
+
+// Insert the specified labels for the model into the DB.
+func (r *Labeler) insert(model Model, labels Labels) (err error) {
+	table := Table{DB: r.tx, Dialect: r.dialect}
+	kind := table.Name(model)
+	for l, v := range labels {
+		label := &Label{
+			Parent: ModelPk(model),
+			Kind:   kind,
+			Name:   l,
+			Value:  v,
+		}
+		var inserted bool
+		inserted, err = table.insert(label)
+		if err != nil {
+			return
 		}
+		if inserted {
+			r.delta.label(label, 1)
+		}
+		r.log.V(2).Info(
+			"label inserted.",
+			"model",
+			Describe(model),
+			"kind",
+			kind,
+			"label",
+			l,
+			"value",
+			v)
 	}
 
 	return
@@ -730,13 +1287,14 @@ func (r *Labeler) Delete(model Model) (err error) {
 		return
 	}
 	list := []Label{}
-	table := Table{r.tx}
+	table := Table{DB: r.tx, Dialect: r.dialect}
 	err = table.List(
 		&list,
 		ListOptions{
 			Predicate: And(
 				Eq("Kind", table.Name(model)),
-				Eq("Parent", model.Pk())),
+				Eq("Parent", ModelPk(model))),
+			Detail: MaxDetail,
 		})
 	if err != nil {
 		return
@@ -746,6 +1304,7 @@ func (r *Labeler) Delete(model Model) (err error) {
 		if err != nil {
 			return
 		}
+		r.delta.label(&label, -1)
 		r.log.V(2).Info(
 			"label inserted.",
 			"model",
@@ -0,0 +1,202 @@
+package model
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	liberr "github.com/konveyor/controller/pkg/error"
+)
+
+// Storage classes.
+const (
+	StorageText    = "TEXT"
+	StorageInteger = "INTEGER"
+	StorageReal    = "REAL"
+)
+
+// Field codec.
+// Maps a field type to a storage class. Values are stored as
+// (string) TEXT, (int64) INTEGER or (float64) REAL. A nil value
+// is stored as NULL. Compact and comparable storage is needed
+// for the field to be used in predicates and generated primary
+// keys.
+type Codec interface {
+	// Storage class: TEXT|INTEGER|REAL.
+	Storage() string
+	// Encode the field value.
+	// Returns a string (TEXT), int64 (INTEGER), float64 (REAL)
+	// or nil (NULL).
+	Encode(value interface{}) (interface{}, error)
+	// Decode the stored value (string|int64|float64) into
+	// the field using the pointer. The value is nil when NULL.
+	Decode(stored interface{}, ptr interface{}) error
+}
+
+// Codec registry.
+var codecs = struct {
+	mutex sync.RWMutex
+	// Registered codecs.
+	content map[reflect.Type]Codec
+	// Resolved codecs (nil=none) by type.
+	resolved map[reflect.Type]Codec
+}{
+	content:  map[reflect.Type]Codec{},
+	resolved: map[reflect.Type]Codec{},
+}
+
+// Register a codec for the type of the `object`.
+// Used for (third-party) types that do not implement
+// driver.Valuer and sql.Scanner.
+// Must be called by the application before the DB is opened.
+// Example:
+//
+//	func init() {
+//	  model.RegisterCodec(resource.Quantity{}, &QuantityCodec{})
+//	}
+func RegisterCodec(object interface{}, codec Codec) {
+	codecs.mutex.Lock()
+	defer codecs.mutex.Unlock()
+	codecs.content[reflect.TypeOf(object)] = codec
+	codecs.resolved = map[reflect.Type]Codec{}
+}
+
+// Find the codec for the type.
+// Registered codecs have precedence over types that
+// implement both driver.Valuer and sql.Scanner.
+// Returns nil when not found.
+func FindCodec(t reflect.Type) (codec Codec) {
+	codecs.mutex.RLock()
+	codec, found := codecs.resolved[t]
+	codecs.mutex.RUnlock()
+	if found {
+		return
+	}
+	codecs.mutex.Lock()
+	defer codecs.mutex.Unlock()
+	codec, found = codecs.content[t]
+	if !found {
+		if t.Implements(valuerType) && reflect.PtrTo(t).Implements(scannerType) {
+			codec = &ValuerCodec{storage: storage(t)}
+		}
+	}
+	codecs.resolved[t] = codec
+
+	return
+}
+
+// Interface types.
+var (
+	valuerType  = reflect.TypeOf((*driver.Valuer)(nil)).Elem()
+	scannerType = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+)
+
+// Nullable (database/sql) types stored as INTEGER.
+var integerTypes = map[reflect.Type]bool{
+	reflect.TypeOf(sql.NullInt64{}): true,
+	reflect.TypeOf(sql.NullInt32{}): true,
+	reflect.TypeOf(sql.NullInt16{}): true,
+	reflect.TypeOf(sql.NullByte{}):  true,
+	reflect.TypeOf(sql.NullBool{}):  true,
+}
+
+// Determine the storage class for a driver.Valuer type.
+// The nullable integer and bool types are stored as INTEGER
+// and the nullable float as REAL. Other types are stored as
+// TEXT unless declared using the `storage(class)` field tag.
+func storage(t reflect.Type) (class string) {
+	class = StorageText
+	switch {
+	case integerTypes[t]:
+		class = StorageInteger
+	case t == reflect.TypeOf(sql.NullFloat64{}):
+		class = StorageReal
+	}
+
+	return
+}
+
+// Storage class is valid.
+func validStorage(class string) bool {
+	switch strings.ToUpper(class) {
+	case StorageText, StorageInteger, StorageReal:
+		return true
+	}
+
+	return false
+}
+
+// Codec for types implementing driver.Valuer and sql.Scanner.
+type ValuerCodec struct {
+	// Storage class.
+	storage string
+}
+
+// Storage class.
+func (c *ValuerCodec) Storage() string {
+	return c.storage
+}
+
+// Encode the field value.
+func (c *ValuerCodec) Encode(value interface{}) (encoded interface{}, err error) {
+	v, err := value.(driver.Valuer).Value()
+	if err != nil {
+		err = liberr.Wrap(err)
+		return
+	}
+	if v == nil {
+		return
+	}
+	switch c.storage {
+	case StorageInteger:
+		switch n := v.(type) {
+		case int64:
+			encoded = n
+		case bool:
+			encoded = int64(0)
+			if n {
+				encoded = int64(1)
+			}
+		default:
+			err = liberr.Wrap(FieldTypeErr)
+		}
+	case StorageReal:
+		switch n := v.(type) {
+		case float64:
+			encoded = n
+		case int64:
+			encoded = float64(n)
+		default:
+			err = liberr.Wrap(FieldTypeErr)
+		}
+	default:
+		switch s := v.(type) {
+		case string:
+			encoded = s
+		case []byte:
+			encoded = string(s)
+		case time.Time:
+			encoded = s.Format(time.RFC3339Nano)
+		case float64:
+			encoded = strconv.FormatFloat(s, 'g', -1, 64)
+		default:
+			err = liberr.Wrap(FieldTypeErr)
+		}
+	}
+
+	return
+}
+
+// Decode the stored value.
+func (c *ValuerCodec) Decode(stored interface{}, ptr interface{}) (err error) {
+	err = ptr.(sql.Scanner).Scan(stored)
+	if err != nil {
+		err = liberr.Wrap(err)
+	}
+
+	return
+}
@@ -0,0 +1,178 @@
+package model
+
+import (
+	"sync"
+
+	liberr "github.com/konveyor/controller/pkg/error"
+	"github.com/konveyor/controller/pkg/ref"
+)
+
+// Count models by label (name and value).
+// Must be set by the application before the DB is opened.
+var LabelCounters = false
+
+// Counter key.
+// The name and value are empty for the kind counter.
+type counterKey struct {
+	kind  string
+	name  string
+	value string
+}
+
+// Counter deltas.
+type counterDelta map[counterKey]int64
+
+// Add to the kind counter.
+func (r counterDelta) kind(kind string, n int64) {
+	r[counterKey{kind: kind}] += n
+}
+
+// Add to the label counter.
+func (r counterDelta) label(label *Label, n int64) {
+	if !LabelCounters {
+		return
+	}
+	key := counterKey{
+		kind:  label.Kind,
+		name:  label.Name,
+		value: label.Value,
+	}
+	r[key] += n
+}
+
+// Model counters.
+// Maintained (in memory) using the deltas of committed
+// transactions and reconciled with the DB when opened.
+// Changes made by Execute() are not counted.
+type counters struct {
+	// Counts.
+	counts map[counterKey]int64
+	// Protect the counts.
+	mutex sync.RWMutex
+}
+
+// Apply (committed) deltas.
+func (r *counters) apply(delta counterDelta) {
+	if len(delta) == 0 {
+		return
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.counts == nil {
+		r.counts = make(map[counterKey]int64)
+	}
+	for key, n := range delta {
+		r.counts[key] += n
+	}
+}
+
+// Get the count.
+func (r *counters) get(key counterKey) int64 {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.counts[key]
+}
+
+// Reconcile with the DB.
+// Returns the number of counters corrected.
+func (r *counters) reconcile(table Table, dm *DataModel) (corrected int, err error) {
+	counts := make(map[counterKey]int64)
+	for _, md := range dm.Definitions() {
+		if !application(md.Kind) {
+			continue
+		}
+		var n int64
+		n, err = table.Count(md.NewModel(), nil)
+		if err != nil {
+			return
+		}
+		counts[counterKey{kind: md.Kind}] = n
+	}
+	if LabelCounters {
+		err = r.labels(table, counts)
+		if err != nil {
+			return
+		}
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for key, n := range counts {
+		if r.counts[key] != n {
+			corrected++
+		}
+	}
+	for key, n := range r.counts {
+		if _, found := counts[key]; !found && n != 0 {
+			corrected++
+		}
+	}
+
+	r.counts = counts
+
+	return
+}
+
+// Count labels.
+func (r *counters) labels(table Table, counts map[counterKey]int64) (err error) {
+	rows, err := table.DB.Query(
+		"SELECT Kind, Name, Value, COUNT(*) FROM Label GROUP BY Kind, Name, Value;")
+	if err != nil {
+		err = liberr.Wrap(table.mapErr(err, nil))
+		return
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+	for rows.Next() {
+		key := counterKey{}
+		var n int64
+		err = rows.Scan(&key.kind, &key.name, &key.value, &n)
+		if err != nil {
+			err = liberr.Wrap(err)
+			return
+		}
+		counts[key] = n
+	}
+	err = rows.Err()
+	if err != nil {
+		err = liberr.Wrap(err)
+	}
+
+	return
+}
+
+// Get the count of models of the kind.
+// Maintained by the DB; O(1).
+func (r *Client) Tally(model Model) int64 {
+	return r.counters.get(counterKey{kind: ref.ToKind(model)})
+}
+
+// Get the count of models of the kind with the label.
+// Maintained by the DB when LabelCounters; O(1).
+func (r *Client) TallyLabel(model Model, name, value string) int64 {
+	return r.counters.get(
+		counterKey{
+			kind:  ref.ToKind(model),
+			name:  name,
+			value: value,
+		})
+}
+
+// Reconcile the counters with the DB.
+// Performed when the DB is opened. Counts are corrected as
+// needed; for example: after changes made by Execute().
+func (r *Client) Reconcile() (err error) {
+	session := r.pool.Writer()
+	defer session.Return()
+	corrected, err := r.counters.reconcile(r.table(session.db), r.dm)
+	if err != nil {
+		return
+	}
+
+	r.log.V(3).Info(
+		"counters reconciled.",
+		"corrected",
+		corrected)
+
+	return
+}
@@ -0,0 +1,199 @@
+package model
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+	"runtime"
+	"time"
+
+	liberr "github.com/konveyor/controller/pkg/error"
+)
+
+// Model iterator.
+// Implemented by both the (detached) file-backed
+// iterator and the (streaming) Cursor.
+type Iterator interface {
+	// Next object.
+	Next() (interface{}, bool)
+	// Close the iterator.
+	Close()
+}
+
+// Streaming cursor.
+// Rows are fetched and decoded on demand. The cursor holds
+// the sql.Rows (and the reader session when reserved) open
+// until closed. The cursor is closed when exhausted.
+// A cursor that is not closed is detected and closed by the
+// garbage collector and reported as leaked.
+type Cursor struct {
+	// Table.
+	table Table
+	// Model definition.
+	md *Definition
+	// The model (type) template.
+	model interface{}
+	// Options.
+	options ListOptions
+	// Rows.
+	rows *sql.Rows
+	// Reserved session.
+	session *Session
+	// Rendered SQL.
+	stmt string
+	// SQL params.
+	params []interface{}
+	// Started timestamp.
+	started time.Time
+	// Time spent querying and fetching rows.
+	// Excludes the time spent by the consumer.
+	elapsed time.Duration
+	// Created by (caller).
+	caller string
+	// Number of rows fetched.
+	count int64
+	// Last error.
+	err error
+	// Closed.
+	closed bool
+}
+
+// Build a new cursor.
+func newCursor(t Table, md *Definition, model interface{}, options ListOptions) (c *Cursor) {
+	c = &Cursor{
+		table:   t,
+		md:      md,
+		model:   model,
+		options: options,
+		started: time.Now(),
+	}
+	_, file, line, ok := runtime.Caller(3)
+	if ok {
+		c.caller = fmt.Sprintf("%s:%d", file, line)
+	}
+	runtime.SetFinalizer(
+		c,
+		func(c *Cursor) {
+			if !c.closed {
+				log.V(1).Info(
+					"cursor: leaked (not closed).",
+					"caller",
+					c.caller)
+				c.release()
+			}
+		})
+
+	return
+}
+
+// Next model.
+func (c *Cursor) Next() (object interface{}, hasNext bool) {
+	if c.closed {
+		return
+	}
+	mt := reflect.TypeOf(c.model)
+	mPtr := reflect.New(mt.Elem())
+	hasNext = c.NextWith(mPtr.Interface())
+	if hasNext {
+		object = mPtr.Interface()
+	}
+
+	return
+}
+
+// Next model (with).
+// The `object` must be a pointer to the model.
+func (c *Cursor) NextWith(object interface{}) (hasNext bool) {
+	if c.closed {
+		return
+	}
+	mark := time.Now()
+	defer func() {
+		c.elapsed += time.Since(mark)
+	}()
+	if !c.rows.Next() {
+		c.err = c.table.mapErr(c.rows.Err(), c.md)
+		c.Close()
+		return
+	}
+	md, err := Inspect(object)
+	if err != nil {
+		c.err = err
+		c.Close()
+		return
+	}
+	c.options.fields = md.Fields
+	err = c.table.scan(c.rows, c.options.Fields())
+	if err != nil {
+		c.err = liberr.Wrap(c.table.mapErr(err, c.md))
+		c.Close()
+		return
+	}
+	c.count++
+	hasNext = true
+	return
+}
+
+// Error.
+// Returns the error (if any) that ended the iteration.
+func (c *Cursor) Err() error {
+	return c.err
+}
+
+// Close the cursor.
+// The rows are closed and the session returned.
+// The operation is observed (timed) excluding the time
+// spent by the consumer between rows.
+func (c *Cursor) Close() {
+	if c.closed {
+		return
+	}
+	c.release()
+	c.table.record(OpStream, c.md, c.stmt, c.params, c.elapsed, c.count)
+
+	log.V(5).Info(
+		"cursor: closed.",
+		"sql",
+		c.stmt,
+		"params",
+		c.params,
+		"fetched",
+		c.count)
+}
+
+// Release the rows and the session.
+func (c *Cursor) release() {
+	c.closed = true
+	_ = c.rows.Close()
+	if c.session != nil {
+		c.session.Return()
+		c.session = nil
+	}
+}
+
+// Chained iterators.
+// Iterated in order; each is closed when exhausted.
+type iterators []Iterator
+
+// Next object.
+func (r *iterators) Next() (object interface{}, hasNext bool) {
+	for len(*r) > 0 {
+		object, hasNext = (*r)[0].Next()
+		if hasNext {
+			return
+		}
+		(*r)[0].Close()
+		*r = (*r)[1:]
+	}
+
+	return
+}
+
+// Close the iterators.
+func (r *iterators) Close() {
+	for _, itr := range *r {
+		itr.Close()
+	}
+
+	*r = nil
+}
@@ -0,0 +1,67 @@
+package model
+
+import (
+	"reflect"
+)
+
+// SQL dialect.
+// Encapsulates what is specific to the database (driver)
+// used by database/sql. Parameters are bound by name
+// using sql.Named(). Set on the client (before the DB is
+// opened) and passed down to each Table.
+// SQLite specific (not provided by the dialect):
+//   - label predicates (GLOB and CAST).
+//   - graph traversal (recursive CTE).
+//   - integrity (orphan) queries.
+//   - counter reconcile (COUNT ... GROUP BY).
+//   - snapshot pinning (deferred read transaction).
+//   - maintenance tasks (PRAGMA).
+type Dialect interface {
+	// The database/sql driver name.
+	Driver() string
+	// Statements executed when a connection is opened.
+	Setup() []string
+	// Column type for the field (reflect) kind.
+	Type(kind reflect.Kind) string
+	// Named parameter (placeholder) in SQL statements.
+	Param(name string) string
+	// Insert statement that (on conflict with the keys)
+	// updates the listed columns. Conflicts are ignored
+	// when no columns are listed.
+	Upsert(table string, columns, keys, update []string) string
+	// Table DDL template.
+	// See: TableDDL.
+	TableDDL() string
+	// Index DDL template.
+	// See: IndexDDL.
+	IndexDDL() string
+	// Map driver errors.
+	// Returns the DbErr or the original error when not mapped.
+	// The model definition (optional) is used to qualify the
+	// error by table and offending fields.
+	MapErr(err error, md *Definition) error
+}
+
+// Set the SQL dialect.
+// Must be called before the DB is opened; ignored after.
+// Default: SQLite.
+func (r *Client) Dialect(dialect Dialect) {
+	if r.dm != nil {
+		return
+	}
+	r.dialect = dialect
+}
+
+// Table using the DB (session) connection.
+func (r *Client) table(db DBTX) Table {
+	return Table{DB: db, Dialect: r.dialect}
+}
+
+// The dialect or the default (SQLite) when not set.
+func dialectOf(dialect Dialect) Dialect {
+	if dialect == nil {
+		dialect = &SQLite{}
+	}
+
+	return dialect
+}
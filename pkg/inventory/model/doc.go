@@ -7,15 +7,25 @@
 //	 sql: "-"
 //	    The field is omitted.
 //	`sql:"pk"`
-//	    The primary key.
-//	`sql:"pk(field;field;..)"`
-//	    The generated primary key.
+//	    The primary key. Multiple `pk` fields declare a composite
+//	    primary key keyed (labels, relations) by the field values
+//	    joined by the PkSeparator. See: ModelPk().
+//	`sql:"pk(field;field;.. +generator)"`
+//	    The generated primary key with optional generator:
+//	      +sha1 = sha1 of the field values (default).
+//	      +sha256 = sha256 of the field values.
+//	      +uuid5 = UUIDv5 in the PkNamespace.
+//	      +uuid5=<namespace> = UUIDv5 in the namespace.
+//	      +concat = field values joined by the PkSeparator.
 //	`sql:"key"`
 //	    The field is part of the natural key.
 //	`sql:"fk(table flags...)"`
 //	    Foreign key with optional flags:
 //	      +must = referenced model must exist.
 //	      +cascade = cascade delete.
+//	      +join = many-to-many join (implies cascade).
+//	      +setnull = field cleared (updated) on delete.
+//	      +restrict = referenced model may not be deleted.
 //	`sql:"unique(G)"`
 //	    Unique index. `G` = unique-together fields.
 //	`sql:"index(G)"`
@@ -28,6 +38,24 @@
 //	    The field detail level.  n = level number.
 //	`sql:incremented`
 //	    The field is auto-incremented.
+//	`sql:"ttl(duration)"`
+//	    The (int) unix timestamp used for expiry. Models older
+//	    than the TTL are purged by the janitor. Example: ttl(24h).
+//	`sql:"revision"`
+//	    The (int) field is set to the commit revision on insert
+//	    and update. Supports ListOptions.SinceRevision.
+//	`sql:"storage(class)"`
+//	    The storage class (integer|text|real) of a driver.Valuer field.
+//
+// Field types are stored by kind: integers and bool as INTEGER,
+// strings as TEXT (SQLite); structs, slices and maps are json encoded.
+// Types implementing both driver.Valuer and sql.Scanner, and types
+// with a codec registered using RegisterCodec() are stored using
+// the codec storage class. The (database/sql) nullable integer and
+// bool types are stored as INTEGER and the nullable float as REAL;
+// other driver.Valuer types are stored as TEXT unless declared.
+// Codec columns are nullable; nil values are stored as NULL.
+// Codec errors are returned.
 //
 // Each struct must implement the `Model` interface.
 // Basic CRUD operations may be performed on each model using
@@ -63,6 +91,11 @@
 // the DB will derive (generate) its value as a sha1 of the
 // natural key fields.
 //
+// The model is updated when the primary key exists. Other
+// (unique key) conflicts are returned as ConflictErr.
+// Breaking change: previously, the model was updated on
+// any constraint conflict.
+//
 // Update the model:
 //
 //	person.Age = 62
@@ -123,6 +156,49 @@
 //	        },
 //	    })
 //
+// List persons by label using the (k8s) label selector syntax.
+// Supported: =, ==, !=, in, notin, exists, !exists, gt and lt.
+//
+//	selector, err := ParseSelector("env in (prod,stage),!retired")
+//	err = DB.List(
+//	    &persons,
+//	    ListOptions{
+//	        Predicate: selector,
+//	    })
+//
+// List persons using a filter expression.
+// See: Parse() for the grammar.
+//
+//	md, err := Inspect(&Person{})
+//	filter, err := Parse(`last = "Fudd" and age > 17 or labels.env in (prod)`, md)
+//	err = DB.List(
+//	    &persons,
+//	    ListOptions{
+//	        Predicate: filter,
+//	    })
+//
+// Many-to-many relations.
+// Declared by a join model with (2) `+join` foreign keys.
+// Join models are deleted when either related model is deleted.
+//
+//	type PersonGroup struct {
+//	    PK     string `sql:"pk(person;group)"`
+//	    Person string `sql:"fk(Person +join)"`
+//	    Group  string `sql:"fk(Group +join)"`
+//	}
+//
+//	err = tx.Link(&PersonGroup{}, person, group)
+//	err = tx.Unlink(&PersonGroup{}, person, group)
+//
+// List groups related to a person:
+//
+//	groups := []Group{}
+//	err := DB.List(
+//	    &groups,
+//	    ListOptions{
+//	        Predicate: Related(&PersonGroup{}, person),
+//	    })
+//
 // Transactions.
 //
 // Explicit:
@@ -146,6 +222,44 @@
 //	  err  = tx.Insert(&person)
 //	  return
 //	})
+//
+// Transaction metadata.
+// Stored in the audit trail when enabled: DB.Audit(true).
+//
+//	err := DB.With(func(tx *Tx) (err error) {
+//	  tx.SetMeta(TxMeta{
+//	    Actor:       "controller",
+//	    Reason:      "reconciled",
+//	    Correlation: request.UID,
+//	  })
+//	  err  = tx.Update(&person)
+//	  return
+//	})
+//
+// Audit trail of a model:
+//
+//	history, err := DB.History(&person)
+//
+// Event sinks receive each committed batch of changes (at-least-once,
+// in revision order) through a durable outbox:
+//
+//	err := DB.Sink(&WebhookSink{URL: url})
+//	err = DB.Sink(&FileSink{Path: path, MaxSize: 1 << 20, MaxFiles: 5})
+//	err = DB.Open(false)
+//
+// A sink no longer used is removed along with its (stored) cursor:
+//
+//	err = DB.RemoveSink(name)
+//
+// SQL that is specific to the database (driver) is provided by
+// the Dialect set on the DB before it is opened. SQLite is the
+// default. Label predicates, graph traversal, integrity checks,
+// counter reconcile, snapshots and maintenance (PRAGMA) tasks
+// are SQLite specific. See: Dialect.
+//
+//	db := model.New(dsn, &Person{})
+//	db.Dialect(&MyDialect{})
+//	err := db.Open(false)
 package model
 
 import (
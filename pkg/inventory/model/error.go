@@ -0,0 +1,80 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// DB (driver) errors.
+var (
+	// Unique or primary key constraint violated.
+	ConflictErr = errors.New("conflict")
+	// Foreign key constraint violated.
+	FkViolationErr = errors.New("foreign key violation")
+	// Not null constraint violated.
+	NotNullErr = errors.New("not null violation")
+	// Other constraint violated.
+	ConstraintErr = errors.New("constraint violation")
+	// DB busy or locked.
+	BusyErr = errors.New("db busy")
+	// Transaction aborted by the pool.
+	// The max lifespan was exceeded.
+	TxAbortedErr = errors.New("transaction aborted")
+)
+
+// DB error.
+// A driver error mapped to a sentinel error and qualified
+// by the table and offending fields. Supports:
+//
+//	errors.Is(err, ConflictErr)
+//	errors.As(err, &DbErr{})
+type DbErr struct {
+	// The sentinel error.
+	Reason error
+	// Table (kind).
+	Kind string
+	// Offending fields (when known).
+	// Not reported for FK violations.
+	Fields []string
+	// The driver error.
+	Cause error
+}
+
+// Error description.
+func (e *DbErr) Error() string {
+	s := e.Reason.Error()
+	if e.Kind != "" {
+		s = fmt.Sprintf("%s: %s", s, e.Kind)
+	}
+	if len(e.Fields) > 0 {
+		s = fmt.Sprintf("%s(%s)", s, strings.Join(e.Fields, ","))
+	}
+	if e.Cause != nil {
+		s = fmt.Sprintf("%s caused by: '%s'", s, e.Cause.Error())
+	}
+
+	return s
+}
+
+// Match the sentinel error.
+func (e *DbErr) Is(target error) bool {
+	return target == e.Reason
+}
+
+// Get whether the field is offending.
+func (e *DbErr) HasField(name string) bool {
+	for _, f := range e.Fields {
+		if strings.EqualFold(f, name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Map driver errors.
+// See: Dialect.MapErr().
+func mapErr(dialect Dialect, err error, md *Definition) error {
+	return dialectOf(dialect).MapErr(err, md)
+}
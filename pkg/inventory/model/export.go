@@ -0,0 +1,203 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+
+	liberr "github.com/konveyor/controller/pkg/error"
+)
+
+// Exported model.
+// A (NDJSON) line written by Export() and read by Import().
+type Exported struct {
+	// Model kind.
+	Kind string `json:"kind"`
+	// JSON encoded model.
+	Model json.RawMessage `json:"model"`
+	// Model labels.
+	Labels Labels `json:"labels,omitempty"`
+}
+
+// Export models.
+// Each model is written as an `Exported` (NDJSON) line in
+// FK-dependency order. All kinds are exported when none specified.
+// The internal (label, revision, outbox) and audit tables are
+// not exported. Labels are written with the labeled model.
+// The models are streamed using a single reader session within
+// a (read) transaction.
+func (r *Client) Export(w io.Writer, kinds ...string) (err error) {
+	session := r.pool.Reader()
+	defer session.Return()
+	tx, err := session.Begin()
+	if err != nil {
+		return
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+	wanted := map[string]bool{}
+	for _, kind := range kinds {
+		_, found := r.dm.Find(kind)
+		if !found {
+			err = liberr.Wrap(
+				KindErr,
+				"kind",
+				kind)
+			return
+		}
+		wanted[strings.ToLower(kind)] = true
+	}
+	encoder := json.NewEncoder(w)
+	relation := FkRelation{dm: r.dm}
+	n := 0
+	for _, md := range relation.Definitions() {
+		if len(wanted) > 0 && !wanted[strings.ToLower(md.Kind)] {
+			continue
+		}
+		if !application(md.Kind) {
+			continue
+		}
+		var labels map[string]Labels
+		labels, err = r.labels(tx, md)
+		if err != nil {
+			return
+		}
+		var cursor *Cursor
+		cursor, err = r.table(tx).Stream(
+			md.NewModel(),
+			ListOptions{Detail: MaxDetail})
+		if err != nil {
+			return
+		}
+		err = r.encode(encoder, md, cursor, labels)
+		if err != nil {
+			return
+		}
+		n += int(cursor.count)
+	}
+
+	r.log.V(3).Info(
+		"models exported.",
+		"kinds",
+		kinds,
+		"count",
+		n)
+
+	return
+}
+
+// Labels for models of the kind keyed by model PK.
+// Empty when the kind is not labeled.
+func (r *Client) labels(tx DBTX, md *Definition) (labels map[string]Labels, err error) {
+	labels = map[string]Labels{}
+	if _, labeled := md.NewModel().(Labeled); !labeled {
+		return
+	}
+	list := []Label{}
+	err = r.table(tx).List(
+		&list,
+		ListOptions{
+			Predicate: Eq("Kind", md.Kind),
+			Detail:    MaxDetail,
+		})
+	if err != nil {
+		return
+	}
+	for _, label := range list {
+		if _, found := labels[label.Parent]; !found {
+			labels[label.Parent] = Labels{}
+		}
+		labels[label.Parent][label.Name] = label.Value
+	}
+
+	return
+}
+
+// Encode the models read from the cursor.
+// The cursor is closed.
+func (r *Client) encode(encoder *json.Encoder, md *Definition, cursor *Cursor, labels map[string]Labels) (err error) {
+	defer cursor.Close()
+	for {
+		m, hasNext := cursor.Next()
+		if !hasNext {
+			err = cursor.Err()
+			break
+		}
+		line := Exported{
+			Kind:   md.Kind,
+			Labels: labels[ModelPk(m.(Model))],
+		}
+		line.Model, err = json.Marshal(m)
+		if err != nil {
+			err = liberr.Wrap(err)
+			return
+		}
+		err = encoder.Encode(&line)
+		if err != nil {
+			err = liberr.Wrap(err)
+			return
+		}
+	}
+
+	return
+}
+
+// Import models.
+// Each `Exported` (NDJSON) line is inserted in a
+// single transaction which reports `Created` events.
+// The exported labels are inserted with the model.
+func (r *Client) Import(reader io.Reader) (err error) {
+	n := 0
+	err = r.With(func(tx *Tx) (err error) {
+		decoder := json.NewDecoder(reader)
+		for {
+			line := Exported{}
+			err = decoder.Decode(&line)
+			if err != nil {
+				if errors.Is(err, io.EOF) {
+					err = nil
+				} else {
+					err = liberr.Wrap(err, "line", n+1)
+				}
+				return
+			}
+			md, found := r.dm.Find(line.Kind)
+			if !found {
+				err = liberr.Wrap(
+					KindErr,
+					"kind",
+					line.Kind,
+					"line",
+					n+1)
+				return
+			}
+			m := md.NewModel()
+			err = json.Unmarshal(line.Model, m)
+			if err != nil {
+				err = liberr.Wrap(err, "line", n+1)
+				return
+			}
+			err = tx.Insert(m.(Model))
+			if err != nil {
+				return
+			}
+			err = tx.labeler.insert(m.(Model), line.Labels)
+			if err != nil {
+				return
+			}
+			n++
+		}
+	})
+	if err != nil {
+		return
+	}
+
+	r.log.V(3).Info(
+		"models imported.",
+		"count",
+		n)
+
+	return
+}
@@ -3,12 +3,14 @@ package model
 import (
 	"encoding/json"
 	"fmt"
+	"github.com/google/uuid"
 	liberr "github.com/konveyor/controller/pkg/error"
 	"github.com/pkg/errors"
 	"reflect"
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 )
 
 const (
@@ -28,6 +30,21 @@ const (
 //	}
 var DefaultDetail = 0
 
+// PK generators.
+const (
+	GenSha1   = "sha1"
+	GenSha256 = "sha256"
+	GenUuid5  = "uuid5"
+	GenConcat = "concat"
+)
+
+// The separator used to join field values for
+// composite and (+concat) generated primary keys.
+var PkSeparator = "/"
+
+// The namespace used for (+uuid5) generated primary keys.
+var PkNamespace = uuid.NameSpaceOID
+
 // Regex used for `pk(fields)` tags.
 var PkRegex = regexp.MustCompile(`(pk)((\()(.+)(\)))?`)
 
@@ -43,6 +60,12 @@ var FkRegex = regexp.MustCompile(`(fk)(\()(.+)(\))`)
 // Regex used for detail.
 var DetailRegex = regexp.MustCompile(`(d)([0-9]+)`)
 
+// Regex used for `ttl(duration)` tags.
+var TtlRegex = regexp.MustCompile(`(ttl)(\()(.+)(\))`)
+
+// Regex used for `storage(class)` tags.
+var StorageRegex = regexp.MustCompile(`(storage)(\()(.+)(\))`)
+
 // Model (struct) Field
 type Field struct {
 	// reflect.Type of the field.
@@ -57,13 +80,60 @@ type Field struct {
 	string string
 	// Staging (int) values.
 	int int64
+	// Staging (float) values.
+	float float64
+	// Staging (codec) stored value.
+	stored interface{}
 	// Referenced as a parameter.
 	isParam bool
+	// Part of a composite primary key.
+	composite bool
+	// Codec (resolved by Inspect).
+	coder Codec
+	// Time-to-live (resolved by Inspect).
+	ttl *time.Duration
+	// SQL dialect.
+	dialect Dialect
+}
+
+// Resolve the codec and time-to-live.
+// Called once by Inspect() so that the codec registry and
+// tags are not consulted for each value.
+// The declared storage class overrides the class of the
+// ValuerCodec.
+func (f *Field) resolve() (err error) {
+	f.coder = FindCodec(f.Value.Type())
+	if vc, cast := f.coder.(*ValuerCodec); cast {
+		class := strings.ToUpper(f.Storage())
+		if validStorage(class) && class != vc.storage {
+			f.coder = &ValuerCodec{storage: class}
+		}
+	}
+	for _, opt := range strings.Split(f.Tag, ",") {
+		opt = strings.TrimSpace(opt)
+		m := TtlRegex.FindStringSubmatch(opt)
+		if len(m) == 5 {
+			d, pErr := time.ParseDuration(m[3])
+			if pErr != nil {
+				err = liberr.Wrap(
+					TtlErr,
+					"field",
+					f.Name,
+					"ttl",
+					m[3])
+				return
+			}
+			f.ttl = &d
+			break
+		}
+	}
+
+	return
 }
 
 // Validate.
 func (f *Field) Validate() error {
-	switch f.Value.Kind() {
+	switch f.kind() {
 	case reflect.String:
 	case reflect.Int,
 		reflect.Int8,
@@ -81,14 +151,95 @@ func (f *Field) Validate() error {
 	if f.Detail() > MaxDetail {
 		return liberr.Wrap(DetailErr)
 	}
+	if class := f.Storage(); class != "" {
+		_, valuer := FindCodec(f.Value.Type()).(*ValuerCodec)
+		if !valuer || !validStorage(class) {
+			return liberr.Wrap(StorageErr, "field", f.Name, "storage", class)
+		}
+	}
+	if len(f.WithFields()) > 0 {
+		generator, namespace := f.Generator()
+		switch generator {
+		case GenSha1, GenSha256, GenConcat:
+		case GenUuid5:
+			if namespace != "" {
+				if _, err := uuid.Parse(namespace); err != nil {
+					return liberr.Wrap(PkGenErr, "namespace", namespace)
+				}
+			}
+		default:
+			return liberr.Wrap(PkGenErr, "generator", generator)
+		}
+	}
+	if _, found := f.TTL(); found {
+		switch f.kind() {
+		case reflect.Int,
+			reflect.Int32,
+			reflect.Int64:
+		default:
+			return liberr.Wrap(TtlTypeErr)
+		}
+	}
+	if f.Revisioned() {
+		switch f.kind() {
+		case reflect.Int,
+			reflect.Int64:
+		default:
+			return liberr.Wrap(RevisionTypeErr)
+		}
+	}
+	if fk := f.Fk(); fk != nil {
+		err := fk.Validate()
+		if err != nil {
+			return err
+		}
+	}
 
 	return nil
 }
 
 // Pull from model.
 // Populate the appropriate `staging` field using the
-// model field value.
+// model field value. Codec errors are returned by Encode().
 func (f *Field) Pull() interface{} {
+	value, _ := f.Encode()
+	return value
+}
+
+// Encode (pull) from model.
+// Populate the appropriate `staging` field using the
+// model field value. Returns codec (encode) errors.
+func (f *Field) Encode() (value interface{}, err error) {
+	if codec := f.codec(); codec != nil {
+		var encoded interface{}
+		encoded, err = codec.Encode(f.Value.Interface())
+		if err != nil {
+			err = liberr.Wrap(err, "field", f.Name)
+			return
+		}
+		f.string, f.int, f.float = "", 0, 0
+		switch v := encoded.(type) {
+		case string:
+			f.string = v
+			value = f.string
+		case int64:
+			f.int = v
+			value = f.int
+		case float64:
+			f.float = v
+			value = f.float
+		case nil:
+		default:
+			err = liberr.Wrap(FieldTypeErr, "field", f.Name)
+		}
+		return
+	}
+	value = f.pull()
+	return
+}
+
+// Pull the (native) field value.
+func (f *Field) pull() interface{} {
 	switch f.Value.Kind() {
 	case reflect.Struct:
 		object := f.Value.Interface()
@@ -144,8 +295,13 @@ func (f *Field) Pull() interface{} {
 }
 
 // Pointer used for Scan().
+// Codec fields are scanned as the stored (driver) value
+// which is nil when NULL.
 func (f *Field) Ptr() interface{} {
-	switch f.Value.Kind() {
+	if f.codec() != nil {
+		return &f.stored
+	}
+	switch f.kind() {
 	case reflect.Bool,
 		reflect.Int,
 		reflect.Int8,
@@ -160,7 +316,19 @@ func (f *Field) Ptr() interface{} {
 
 // Push to the model.
 // Set the model field value using the `staging` field.
-func (f *Field) Push() {
+// Returns codec (decode) errors.
+func (f *Field) Push() (err error) {
+	if codec := f.codec(); codec != nil {
+		stored := f.stored
+		if b, cast := stored.([]byte); cast {
+			stored = string(b)
+		}
+		err = codec.Decode(stored, f.Value.Addr().Interface())
+		if err != nil {
+			err = liberr.Wrap(err, "field", f.Name)
+		}
+		return
+	}
 	switch f.Value.Kind() {
 	case reflect.Struct:
 		if len(f.string) == 0 {
@@ -201,6 +369,8 @@ func (f *Field) Push() {
 		reflect.Int64:
 		f.Value.SetInt(f.int)
 	}
+
+	return
 }
 
 // Column DDL.
@@ -210,30 +380,30 @@ func (f *Field) DDL() string {
 		"",     // type
 		"",     // constraint
 	}
-	switch f.Value.Kind() {
-	case reflect.Bool,
-		reflect.Int,
-		reflect.Int8,
-		reflect.Int16,
-		reflect.Int32,
-		reflect.Int64:
-		part[1] = "INTEGER"
-	default:
-		part[1] = "TEXT"
-	}
-	if f.Pk() {
+	part[1] = f.SqlType()
+	switch {
+	case f.Pk() && !f.composite:
 		part[2] = "PRIMARY KEY"
-	} else {
+	case f.codec() != nil && !f.Pk():
+		// Codec values may be NULL.
+		part = part[:2]
+	default:
 		part[2] = "NOT NULL"
 	}
 
 	return strings.Join(part, " ")
 }
 
+// Column (SQL) type.
+// See: Dialect.Type().
+func (f *Field) SqlType() string {
+	return dialectOf(f.dialect).Type(f.kind())
+}
+
 // Get as SQL param.
 func (f *Field) Param() string {
 	f.isParam = true
-	return ":" + f.Name
+	return dialectOf(f.dialect).Param(f.Name)
 }
 
 // Get whether field is the primary key.
@@ -253,15 +423,57 @@ func (f *Field) Pk() (matched bool) {
 // when generation is not enabled.
 func (f *Field) WithFields() (withFields map[string]bool) {
 	withFields = map[string]bool{}
+	names, _ := f.pkGen()
+	for _, name := range names {
+		withFields[strings.ToLower(name)] = true
+	}
+
+	return
+}
+
+// Get the PK generator.
+// Format: pk(field;field;.. +generator) where the generator
+// is optional. Generators:
+//
+//	+sha1 = sha1 (hex) of the field values (default).
+//	+sha256 = sha256 (hex) of the field values.
+//	+uuid5 = UUIDv5 of the field values in the PkNamespace.
+//	+uuid5=<namespace> = UUIDv5 in the specified namespace.
+//	+concat = field values joined by PkSeparator.
+func (f *Field) Generator() (generator string, namespace string) {
+	_, flags := f.pkGen()
+	generator = GenSha1
+	for _, flag := range flags {
+		flag = strings.TrimPrefix(flag, "+")
+		part := strings.SplitN(flag, "=", 2)
+		generator = part[0]
+		if len(part) == 2 {
+			namespace = part[1]
+		}
+	}
+
+	return
+}
+
+// Parse the `pk(fields +generator)` tag.
+// Returns the field names and (+) flags.
+func (f *Field) pkGen() (names []string, flags []string) {
 	for _, opt := range strings.Split(f.Tag, ",") {
 		opt = strings.TrimSpace(opt)
 		m := PkRegex.FindStringSubmatch(opt)
 		if len(m) == 6 {
-			for _, name := range strings.Split(m[4], ";") {
+			joined := ""
+			for _, token := range strings.Fields(m[4]) {
+				if strings.HasPrefix(token, "+") {
+					flags = append(flags, token)
+				} else {
+					joined += token
+				}
+			}
+			for _, name := range strings.Split(joined, ";") {
 				name = strings.TrimSpace(name)
 				if len(name) > 0 {
-					name = strings.ToLower(name)
-					withFields[name] = true
+					names = append(names, name)
 				}
 			}
 		}
@@ -327,6 +539,9 @@ func (f *Field) Index() []string {
 //
 //	+must = referenced model must exist.
 //	+cascade = cascade delete.
+//	+join = many-to-many join (implies cascade).
+//	+setnull = clear the field when the referenced model is deleted.
+//	+restrict = referenced model may not be deleted.
 func (f *Field) Fk() (fk *FK) {
 	for _, opt := range strings.Split(f.Tag, ",") {
 		opt = strings.TrimSpace(opt)
@@ -344,6 +559,12 @@ func (f *Field) Fk() (fk *FK) {
 						fk.Cascade = true
 					case "+must":
 						fk.Must = true
+					case "+join":
+						fk.Join = true
+					case "+setnull":
+						fk.SetNull = true
+					case "+restrict":
+						fk.Restrict = true
 					default:
 						panic(
 							errors.Errorf(
@@ -359,14 +580,43 @@ func (f *Field) Fk() (fk *FK) {
 	return
 }
 
+// Get the time-to-live.
+// Format: ttl(duration). Example: ttl(24h).
+// The field is a (unix) timestamp in seconds. Models
+// with a timestamp older than the TTL are expired.
+func (f *Field) TTL() (ttl time.Duration, found bool) {
+	if f.ttl != nil {
+		ttl = *f.ttl
+		found = true
+	}
+
+	return
+}
+
 // Get whether field is auto-incremented.
 func (f *Field) Incremented() bool {
 	return f.hasOpt("incremented")
 }
 
+// Get whether field is stamped with the commit revision.
+func (f *Field) Revisioned() bool {
+	return f.hasOpt("revision")
+}
+
 // Convert the specified `object` to a value
 // (type) appropriate for the field.
 func (f *Field) AsValue(object interface{}) (value interface{}, err error) {
+	if codec := f.codec(); codec != nil {
+		ft := f.Value.Type()
+		switch reflect.TypeOf(object) {
+		case ft:
+			value, err = codec.Encode(object)
+			return
+		case reflect.PtrTo(ft):
+			value, err = codec.Encode(reflect.ValueOf(object).Elem().Interface())
+			return
+		}
+	}
 	val := reflect.ValueOf(object)
 	switch val.Kind() {
 	case reflect.Ptr:
@@ -377,7 +627,7 @@ func (f *Field) AsValue(object interface{}) (value interface{}, err error) {
 		err = liberr.Wrap(PredicateValueErr)
 		return
 	}
-	switch f.Value.Kind() {
+	switch f.kind() {
 	case reflect.String:
 		switch val.Kind() {
 		case reflect.String:
@@ -448,6 +698,28 @@ func (f *Field) AsValue(object interface{}) (value interface{}, err error) {
 		default:
 			err = liberr.Wrap(PredicateValueErr)
 		}
+	case reflect.Float32,
+		reflect.Float64:
+		switch val.Kind() {
+		case reflect.String:
+			n, pErr := strconv.ParseFloat(val.String(), 64)
+			if pErr != nil {
+				err = liberr.Wrap(pErr)
+				return
+			}
+			value = n
+		case reflect.Int,
+			reflect.Int8,
+			reflect.Int16,
+			reflect.Int32,
+			reflect.Int64:
+			value = float64(val.Int())
+		case reflect.Float32,
+			reflect.Float64:
+			value = val.Float()
+		default:
+			err = liberr.Wrap(PredicateValueErr)
+		}
 	default:
 		err = liberr.Wrap(FieldTypeErr)
 	}
@@ -455,9 +727,41 @@ func (f *Field) AsValue(object interface{}) (value interface{}, err error) {
 	return
 }
 
+// Set the model field.
+// The `object` is converted using AsValue().
+func (f *Field) Set(object interface{}) (err error) {
+	value, err := f.AsValue(object)
+	if err != nil {
+		return
+	}
+	if codec := f.codec(); codec != nil {
+		err = codec.Decode(value, f.Value.Addr().Interface())
+		return
+	}
+	switch v := value.(type) {
+	case string:
+		f.Value.SetString(v)
+	case bool:
+		f.Value.SetBool(v)
+	case int64:
+		f.Value.SetInt(v)
+	case int:
+		f.Value.SetInt(int64(v))
+	default:
+		err = liberr.Wrap(
+			FieldTypeErr,
+			"field",
+			f.Name,
+			"type",
+			fmt.Sprintf("%T", value))
+	}
+
+	return
+}
+
 // Get whether the field is `json` encoded.
 func (f *Field) Encoded() (encoded bool) {
-	switch f.Value.Kind() {
+	switch f.kind() {
 	case reflect.Struct,
 		reflect.Slice,
 		reflect.Map:
@@ -495,6 +799,45 @@ func (f *Field) MatchDetail(level int) bool {
 	return f.Detail() <= level
 }
 
+// Get the codec for the field type.
+// Returns nil when not found.
+// See: resolve().
+func (f *Field) codec() Codec {
+	return f.coder
+}
+
+// Declared storage class.
+// Format: storage(integer|text|real).
+// Applies to driver.Valuer (codec) fields.
+func (f *Field) Storage() (class string) {
+	for _, opt := range strings.Split(f.Tag, ",") {
+		opt = strings.TrimSpace(opt)
+		m := StorageRegex.FindStringSubmatch(opt)
+		if len(m) == 5 {
+			class = m[3]
+			break
+		}
+	}
+
+	return
+}
+
+// Storage kind.
+// The field kind or the kind of the codec storage class.
+func (f *Field) kind() reflect.Kind {
+	if codec := f.codec(); codec != nil {
+		switch codec.Storage() {
+		case StorageInteger:
+			return reflect.Int64
+		case StorageReal:
+			return reflect.Float64
+		}
+		return reflect.String
+	}
+
+	return f.Value.Kind()
+}
+
 // Get whether field has an option.
 func (f *Field) hasOpt(name string) bool {
 	for _, opt := range strings.Split(f.Tag, ",") {
@@ -519,6 +862,12 @@ type FK struct {
 	Must bool
 	// +cascade delete option.
 	Cascade bool
+	// +join (many-to-many) option.
+	Join bool
+	// +setnull on delete option.
+	SetNull bool
+	// +restrict delete option.
+	Restrict bool
 }
 
 // Get DDL.
@@ -534,5 +883,33 @@ func (f *FK) DDL(field *Field) string {
 // The `must` is implemented by a constraint which is
 // implicitly indexed by the DB.
 func (f *FK) needsIndex() bool {
-	return f.Cascade && !f.Must
+	return (f.Cascade || f.Join || f.SetNull || f.Restrict) && !f.Must
+}
+
+// Validate flags.
+// The +setnull, +restrict and cascade are exclusive. The
+// +setnull clears the field which cannot satisfy +must.
+func (f *FK) Validate() (err error) {
+	n := 0
+	for _, flag := range []bool{f.cascaded(), f.SetNull, f.Restrict} {
+		if flag {
+			n++
+		}
+	}
+	if n > 1 || (f.SetNull && f.Must) {
+		err = liberr.Wrap(
+			FkFlagErr,
+			"field",
+			f.Owner.Name,
+			"table",
+			f.Table)
+	}
+
+	return
+}
+
+// Get whether the referencing model is (cascade)
+// deleted with the referenced model.
+func (f *FK) cascaded() bool {
+	return f.Cascade || f.Join
 }
@@ -0,0 +1,693 @@
+package model
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	liberr "github.com/konveyor/controller/pkg/error"
+	liblabels "k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+)
+
+// Label field prefix.
+// Example: labels.env = prod
+const LabelPrefix = "labels."
+
+// Filter parse error.
+// Reports the (0-based) position within the expression.
+type ParseErr struct {
+	// The expression.
+	Expr string
+	// Position.
+	Pos int
+	// Reason.
+	Reason string
+}
+
+// Error description.
+func (e *ParseErr) Error() string {
+	return fmt.Sprintf(
+		"filter: %s at position %d in: '%s'",
+		e.Reason,
+		e.Pos,
+		e.Expr)
+}
+
+// Parse a filter expression into a predicate.
+// The referenced fields and values are validated using
+// the model definition. Grammar:
+//
+//	expr    = and { "or" and }
+//	and     = primary { "and" primary }
+//	primary = "(" expr ")" | compare
+//	compare = field ("=" | "!=" | ">" | "<") value
+//	        | field ["not"] "in" "(" value { "," value } ")"
+//	        | "labels." name ["not"] "exists"
+//	value   = "string" | number | true | false | field
+//
+// Fields are prefixed with `labels.` to match labels. Label
+// values may be bare words. A bare word compared to a model
+// field is a reference to another field.
+// Example: name = "x" and age > 3 or labels.env in (prod,stage)
+func Parse(expr string, md *Definition) (p Predicate, err error) {
+	parser := parser{expr: expr, md: md}
+	err = parser.lex()
+	if err != nil {
+		return
+	}
+	p, err = parser.or()
+	if err != nil {
+		return
+	}
+	if tk := parser.peek(); tk.kind != tkEOF {
+		err = parser.error(tk, "unexpected '%s'", tk.text)
+		return
+	}
+
+	return
+}
+
+// Token kinds.
+const (
+	tkEOF = iota
+	tkIdent
+	tkString
+	tkNumber
+	tkOperator
+	tkLParen
+	tkRParen
+	tkComma
+)
+
+// Lexical token.
+type token struct {
+	// Kind.
+	kind int
+	// Text (unquoted).
+	text string
+	// Position.
+	pos int
+}
+
+// Get whether the token is the keyword.
+func (t token) is(keyword string) bool {
+	return t.kind == tkIdent && strings.EqualFold(t.text, keyword)
+}
+
+// Filter expression parser.
+type parser struct {
+	// Expression.
+	expr string
+	// Model definition.
+	md *Definition
+	// Tokens.
+	tokens []token
+	// Next token index.
+	next int
+}
+
+// Tokenize the expression.
+func (r *parser) lex() (err error) {
+	runes := []rune(r.expr)
+	for i := 0; i < len(runes); {
+		ch := runes[i]
+		switch {
+		case unicode.IsSpace(ch):
+			i++
+		case ch == '(':
+			r.tokens = append(r.tokens, token{kind: tkLParen, text: "(", pos: i})
+			i++
+		case ch == ')':
+			r.tokens = append(r.tokens, token{kind: tkRParen, text: ")", pos: i})
+			i++
+		case ch == ',':
+			r.tokens = append(r.tokens, token{kind: tkComma, text: ",", pos: i})
+			i++
+		case ch == '=' || ch == '>' || ch == '<':
+			r.tokens = append(r.tokens, token{kind: tkOperator, text: string(ch), pos: i})
+			i++
+			if ch == '=' && i < len(runes) && runes[i] == '=' {
+				i++
+			}
+		case ch == '!':
+			if i+1 < len(runes) && runes[i+1] == '=' {
+				r.tokens = append(r.tokens, token{kind: tkOperator, text: "!=", pos: i})
+				i += 2
+				break
+			}
+			err = r.error(token{pos: i}, "unexpected '!'")
+			return
+		case ch == '"':
+			start := i
+			i++
+			for i < len(runes) && runes[i] != '"' {
+				if runes[i] == '\\' {
+					i++
+				}
+				i++
+			}
+			if i >= len(runes) {
+				err = r.error(token{pos: start}, "unterminated string")
+				return
+			}
+			i++
+			text, uErr := strconv.Unquote(string(runes[start:i]))
+			if uErr != nil {
+				err = r.error(token{pos: start}, "string not valid")
+				return
+			}
+			r.tokens = append(r.tokens, token{kind: tkString, text: text, pos: start})
+		case unicode.IsDigit(ch) ||
+			(ch == '-' && i+1 < len(runes) && unicode.IsDigit(runes[i+1])):
+			start := i
+			i++
+			for i < len(runes) && unicode.IsDigit(runes[i]) {
+				i++
+			}
+			if i+1 < len(runes) && runes[i] == '.' && unicode.IsDigit(runes[i+1]) {
+				i++
+				for i < len(runes) && unicode.IsDigit(runes[i]) {
+					i++
+				}
+			}
+			r.tokens = append(r.tokens, token{kind: tkNumber, text: string(runes[start:i]), pos: start})
+		case r.isWord(ch):
+			start := i
+			for i < len(runes) && r.isWord(runes[i]) {
+				i++
+			}
+			r.tokens = append(r.tokens, token{kind: tkIdent, text: string(runes[start:i]), pos: start})
+		default:
+			err = r.error(token{pos: i}, "unexpected '%c'", ch)
+			return
+		}
+	}
+	r.tokens = append(r.tokens, token{kind: tkEOF, text: "end", pos: len(runes)})
+	return
+}
+
+// Get whether the rune is part of a word (identifier).
+// Includes characters valid in label names.
+func (r *parser) isWord(ch rune) bool {
+	return unicode.IsLetter(ch) ||
+		unicode.IsDigit(ch) ||
+		strings.ContainsRune("_.-/", ch)
+}
+
+// Peek at the next token.
+func (r *parser) peek() token {
+	return r.tokens[r.next]
+}
+
+// Consume the next token.
+func (r *parser) pop() (tk token) {
+	tk = r.tokens[r.next]
+	if tk.kind != tkEOF {
+		r.next++
+	}
+	return
+}
+
+// Consume the next token of the expected kind.
+func (r *parser) expect(kind int, what string) (tk token, err error) {
+	tk = r.pop()
+	if tk.kind != kind {
+		err = r.error(tk, "expected %s but found '%s'", what, tk.text)
+	}
+	return
+}
+
+// Build a parse error.
+func (r *parser) error(tk token, format string, args ...interface{}) error {
+	return liberr.Wrap(
+		&ParseErr{
+			Expr:   r.expr,
+			Pos:    tk.pos,
+			Reason: fmt.Sprintf(format, args...),
+		})
+}
+
+// Parse: and { "or" and }
+func (r *parser) or() (p Predicate, err error) {
+	list := []Predicate{}
+	for {
+		var and Predicate
+		and, err = r.and()
+		if err != nil {
+			return
+		}
+		list = append(list, and)
+		if !r.peek().is("or") {
+			break
+		}
+		r.pop()
+	}
+	if len(list) == 1 {
+		p = list[0]
+	} else {
+		p = Or(list...)
+	}
+
+	return
+}
+
+// Parse: primary { "and" primary }
+func (r *parser) and() (p Predicate, err error) {
+	list := []Predicate{}
+	for {
+		var primary Predicate
+		primary, err = r.primary()
+		if err != nil {
+			return
+		}
+		list = append(list, primary)
+		if !r.peek().is("and") {
+			break
+		}
+		r.pop()
+	}
+	if len(list) == 1 {
+		p = list[0]
+	} else {
+		p = And(list...)
+	}
+
+	return
+}
+
+// Parse: "(" expr ")" | compare
+func (r *parser) primary() (p Predicate, err error) {
+	if r.peek().kind == tkLParen {
+		r.pop()
+		p, err = r.or()
+		if err != nil {
+			return
+		}
+		_, err = r.expect(tkRParen, "')'")
+		return
+	}
+	field, err := r.expect(tkIdent, "field")
+	if err != nil {
+		return
+	}
+	if strings.HasPrefix(field.text, LabelPrefix) {
+		p, err = r.label(field)
+	} else {
+		p, err = r.compare(field)
+	}
+
+	return
+}
+
+// Parse the operator.
+// Returns: =, !=, >, <, in, notin, exists, notexists
+func (r *parser) operator() (op token, err error) {
+	op = r.pop()
+	switch {
+	case op.kind == tkOperator:
+	case op.is("in"):
+		op.text = "in"
+	case op.is("exists"):
+		op.text = "exists"
+	case op.is("not"):
+		next := r.pop()
+		switch {
+		case next.is("in"):
+			op.text = "notin"
+		case next.is("exists"):
+			op.text = "notexists"
+		default:
+			err = r.error(next, "expected 'in' or 'exists' but found '%s'", next.text)
+		}
+	default:
+		err = r.error(op, "expected operator but found '%s'", op.text)
+	}
+
+	return
+}
+
+// Parse: value | "(" value { "," value } ")"
+func (r *parser) values(list bool) (values []token, err error) {
+	if !list {
+		var tk token
+		tk, err = r.value()
+		if err != nil {
+			return
+		}
+		values = append(values, tk)
+		return
+	}
+	_, err = r.expect(tkLParen, "'('")
+	if err != nil {
+		return
+	}
+	for {
+		var tk token
+		tk, err = r.value()
+		if err != nil {
+			return
+		}
+		values = append(values, tk)
+		next := r.pop()
+		if next.kind == tkRParen {
+			break
+		}
+		if next.kind != tkComma {
+			err = r.error(next, "expected ',' or ')' but found '%s'", next.text)
+			return
+		}
+	}
+
+	return
+}
+
+// Parse a value.
+func (r *parser) value() (tk token, err error) {
+	tk = r.pop()
+	switch tk.kind {
+	case tkString, tkNumber, tkIdent:
+	default:
+		err = r.error(tk, "expected value but found '%s'", tk.text)
+	}
+
+	return
+}
+
+// Parse a model field comparison.
+func (r *parser) compare(field token) (p Predicate, err error) {
+	f := r.md.Field(field.text)
+	if f == nil {
+		err = r.error(field, "field '%s' not found", field.text)
+		return
+	}
+	op, err := r.operator()
+	if err != nil {
+		return
+	}
+	switch op.text {
+	case "in", "notin":
+	case ">", "<":
+		switch f.kind() {
+		case reflect.Int,
+			reflect.Int8,
+			reflect.Int16,
+			reflect.Int32,
+			reflect.Int64,
+			reflect.Float32,
+			reflect.Float64:
+		default:
+			err = r.error(op, "operator '%s' not valid for field '%s'", op.text, f.Name)
+			return
+		}
+	case "=", "!=":
+	default:
+		err = r.error(op, "operator '%s' not valid for field '%s'", op.text, f.Name)
+		return
+	}
+	tokens, err := r.values(op.text == "in" || op.text == "notin")
+	if err != nil {
+		return
+	}
+	values := []interface{}{}
+	for _, tk := range tokens {
+		var v interface{}
+		v, err = r.fieldValue(f, tk)
+		if err != nil {
+			return
+		}
+		values = append(values, v)
+	}
+	switch op.text {
+	case "=":
+		p = Eq(f.Name, values[0])
+	case "!=":
+		p = Neq(f.Name, values[0])
+	case ">":
+		p = Gt(f.Name, values[0])
+	case "<":
+		p = Lt(f.Name, values[0])
+	case "in":
+		p = Eq(f.Name, values)
+	case "notin":
+		p = Neq(f.Name, values)
+	}
+
+	return
+}
+
+// Convert the value token to a field value.
+// A bare word is a field reference.
+func (r *parser) fieldValue(f *Field, tk token) (v interface{}, err error) {
+	if tk.kind == tkIdent && !tk.is("true") && !tk.is("false") {
+		ref := r.md.Field(tk.text)
+		if ref == nil {
+			err = r.error(tk, "field '%s' not found", tk.text)
+			return
+		}
+		v = Field{Name: ref.Name}
+		return
+	}
+	switch f.kind() {
+	case reflect.String:
+		if tk.kind == tkString {
+			v = tk.text
+			return
+		}
+	case reflect.Bool:
+		if tk.kind == tkIdent {
+			v = tk.is("true")
+			return
+		}
+	case reflect.Int,
+		reflect.Int8,
+		reflect.Int16,
+		reflect.Int32,
+		reflect.Int64:
+		if tk.kind == tkNumber {
+			v, err = strconv.ParseInt(tk.text, 10, 64)
+			if err != nil {
+				err = r.error(tk, "number '%s' not valid", tk.text)
+			}
+			return
+		}
+	case reflect.Float32,
+		reflect.Float64:
+		if tk.kind == tkNumber {
+			v, err = strconv.ParseFloat(tk.text, 64)
+			if err != nil {
+				err = r.error(tk, "number '%s' not valid", tk.text)
+			}
+			return
+		}
+	}
+	err = r.error(tk, "value '%s' not valid for field '%s'", tk.text, f.Name)
+	return
+}
+
+// Parse a label comparison.
+func (r *parser) label(field token) (p Predicate, err error) {
+	name := strings.TrimPrefix(field.text, LabelPrefix)
+	op, err := r.operator()
+	if err != nil {
+		return
+	}
+	values := []string{}
+	switch op.text {
+	case "exists", "notexists":
+	default:
+		var tokens []token
+		tokens, err = r.values(op.text == "in" || op.text == "notin")
+		if err != nil {
+			return
+		}
+		for _, tk := range tokens {
+			values = append(values, tk.text)
+		}
+	}
+	operator := map[string]selection.Operator{
+		"=":         selection.Equals,
+		"!=":        selection.NotEquals,
+		">":         selection.GreaterThan,
+		"<":         selection.LessThan,
+		"in":        selection.In,
+		"notin":     selection.NotIn,
+		"exists":    selection.Exists,
+		"notexists": selection.DoesNotExist,
+	}[op.text]
+	requirement, rErr := liblabels.NewRequirement(name, operator, values)
+	if rErr != nil {
+		err = r.error(field, "label requirement not valid: %s", rErr.Error())
+		return
+	}
+	p = MatchSelector(liblabels.NewSelector().Add(*requirement))
+	return
+}
+
+// Format a predicate as a filter expression.
+// Predicates not supported by the filter language
+// are formatted as their SQL expression.
+func Format(p Predicate) string {
+	if s, cast := p.(fmt.Stringer); cast {
+		return s.String()
+	}
+
+	return p.Expr()
+}
+
+// Format the value as a literal.
+func literal(value interface{}) string {
+	switch v := value.(type) {
+	case Field:
+		return v.Name
+	case string:
+		return strconv.Quote(v)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Int,
+		reflect.Int8,
+		reflect.Int16,
+		reflect.Int32,
+		reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10)
+	default:
+		return strconv.Quote(fmt.Sprintf("%v", value))
+	}
+}
+
+// Format the compound predicate.
+// Nested predicates are grouped as needed.
+func (p *CompoundPredicate) format(operator string) string {
+	list := []string{}
+	for _, nested := range p.Predicates {
+		s := Format(nested)
+		switch n := nested.(type) {
+		case *OrPredicate:
+			if len(n.Predicates) > 1 {
+				s = "(" + s + ")"
+			}
+		case *AndPredicate:
+			if len(n.Predicates) > 1 && operator == "and" {
+				s = "(" + s + ")"
+			}
+		case *LabelPredicate:
+			if strings.Contains(s, " and ") {
+				s = "(" + s + ")"
+			}
+		}
+		list = append(list, s)
+	}
+
+	return strings.Join(list, " "+operator+" ")
+}
+
+// Format the (list) predicate.
+func (p *SimplePredicate) formatList(operator string) string {
+	pv := reflect.ValueOf(p.Value)
+	values := []string{}
+	for i := 0; i < pv.Len(); i++ {
+		values = append(values, literal(pv.Index(i).Interface()))
+	}
+
+	return p.Field + " " + operator + " (" + strings.Join(values, ",") + ")"
+}
+
+// Format the predicate.
+func (p *SimplePredicate) format(operator string) string {
+	return strings.Join(
+		[]string{
+			p.Field,
+			operator,
+			literal(p.Value),
+		},
+		" ")
+}
+
+// Format as a filter expression.
+func (p *EqPredicate) String() string {
+	if reflect.ValueOf(p.Value).Kind() == reflect.Slice {
+		return p.formatList("in")
+	}
+
+	return p.format("=")
+}
+
+// Format as a filter expression.
+func (p *NeqPredicate) String() string {
+	if reflect.ValueOf(p.Value).Kind() == reflect.Slice {
+		return p.formatList("not in")
+	}
+
+	return p.format("!=")
+}
+
+// Format as a filter expression.
+func (p *GtPredicate) String() string {
+	return p.format(">")
+}
+
+// Format as a filter expression.
+func (p *LtPredicate) String() string {
+	return p.format("<")
+}
+
+// Format as a filter expression.
+func (p *AndPredicate) String() string {
+	return p.format("and")
+}
+
+// Format as a filter expression.
+func (p *OrPredicate) String() string {
+	return p.format("or")
+}
+
+// Format as a filter expression.
+// The labels (sorted) and selector requirements are
+// joined using `and`.
+func (p *LabelPredicate) String() string {
+	list := []string{}
+	keys := []string{}
+	for k := range p.Labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		list = append(list, LabelPrefix+k+" = "+strconv.Quote(p.Labels[k]))
+	}
+	if p.Selector != nil {
+		selected, _ := p.Selector.Requirements()
+		for _, r := range selected {
+			name := LabelPrefix + r.Key()
+			values := []string{}
+			for _, v := range r.Values().List() {
+				values = append(values, strconv.Quote(v))
+			}
+			switch r.Operator() {
+			case selection.Exists:
+				list = append(list, name+" exists")
+			case selection.DoesNotExist:
+				list = append(list, name+" not exists")
+			case selection.In:
+				list = append(list, name+" in ("+strings.Join(values, ",")+")")
+			case selection.NotIn:
+				list = append(list, name+" not in ("+strings.Join(values, ",")+")")
+			case selection.NotEquals:
+				list = append(list, name+" != "+values[0])
+			case selection.GreaterThan:
+				list = append(list, name+" > "+r.Values().List()[0])
+			case selection.LessThan:
+				list = append(list, name+" < "+r.Values().List()[0])
+			default:
+				list = append(list, name+" = "+values[0])
+			}
+		}
+	}
+
+	return strings.Join(list, " and ")
+}
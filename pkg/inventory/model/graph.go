@@ -0,0 +1,458 @@
+package model
+
+import (
+	"bytes"
+	"database/sql"
+	"sort"
+	"strings"
+	"text/template"
+
+	liberr "github.com/konveyor/controller/pkg/error"
+)
+
+// The default (and max) traversal depth.
+var GraphMaxDepth = 10
+
+// The max number of models fetched per query.
+var GraphFetchBatch = 100
+
+// Graph traversal SQL.
+// A recursive CTE with a recursive SELECT for each FK (edge).
+// Each row is a node and the edge by which it was reached.
+var GraphSQL = `
+WITH RECURSIVE graph(kind,pk,depth,eKind,ePk,eField,eRefKind,eRefPk) AS (
+SELECT {{ .Param.kind }},{{ .Param.pk }},0,'','','','',''
+{{ range .Edges -}}
+UNION
+{{ if $.Ancestors -}}
+SELECT '{{ .RefKind }}',{{ .RefPk }},graph.depth+1,'{{ .Kind }}',graph.pk,'{{ .Field }}','{{ .RefKind }}',{{ .RefPk }}
+FROM {{ .RefKind }} r,{{ .Kind }} m,graph
+WHERE graph.kind = '{{ .Kind }}' AND graph.depth < {{ $.Param.depth }} AND {{ .Pk }} = graph.pk AND {{ .RefPk }} = m.{{ .Field }}
+{{ else -}}
+SELECT '{{ .Kind }}',{{ .Pk }},graph.depth+1,'{{ .Kind }}',{{ .Pk }},'{{ .Field }}','{{ .RefKind }}',graph.pk
+FROM {{ .Kind }} m,graph
+WHERE graph.kind = '{{ .RefKind }}' AND graph.depth < {{ $.Param.depth }} AND m.{{ .Field }} = graph.pk
+{{ end -}}
+{{ end -}}
+)
+SELECT kind,CAST(pk AS TEXT),depth,eKind,CAST(ePk AS TEXT),eField,eRefKind,CAST(eRefPk AS TEXT)
+FROM graph;
+`
+
+// Graph traversal options.
+type GraphOptions struct {
+	// Max depth (0=GraphMaxDepth).
+	Depth int
+	// Report only models of the listed kinds (empty=all).
+	// The root is always reported. Models of all kinds are
+	// traversed so paths through unlisted kinds are followed.
+	Kinds []string
+	// Fetch the models.
+	Models bool
+}
+
+// Model graph.
+// The result of a traversal. Edges are oriented from the
+// referencing model to the referenced model.
+type Graph struct {
+	// The (root) model traversed from.
+	Root GraphNode `json:"root"`
+	// Nodes (including the root) ordered by depth.
+	Nodes []GraphNode `json:"nodes"`
+	// Edges.
+	Edges []GraphEdge `json:"edges"`
+}
+
+// Graph node.
+type GraphNode struct {
+	// Model kind.
+	Kind string `json:"kind"`
+	// Model primary key.
+	Pk string `json:"pk"`
+	// Depth (shortest path from the root).
+	Depth int `json:"depth"`
+	// The model (when fetched).
+	Model Model `json:"model,omitempty"`
+}
+
+// Graph edge.
+// The referencing model references the
+// referenced model by the FK field.
+type GraphEdge struct {
+	// Referencing model kind.
+	Kind string `json:"kind"`
+	// Referencing model primary key.
+	Pk string `json:"pk"`
+	// FK field.
+	Field string `json:"field"`
+	// Referenced model kind.
+	RefKind string `json:"refKind"`
+	// Referenced model primary key.
+	RefPk string `json:"refPk"`
+}
+
+// Graph traversal.
+type traversal struct {
+	// Data model.
+	dm *DataModel
+	// Table (connection).
+	table Table
+}
+
+// Traversal (SQL) edge.
+type traversalEdge struct {
+	// Referencing kind.
+	Kind string
+	// Referencing (m) PK expression.
+	Pk string
+	// FK field.
+	Field string
+	// Referenced kind.
+	RefKind string
+	// Referenced (r) PK expression.
+	RefPk string
+}
+
+// Traverse the graph from the model.
+// Ancestors: models referenced by the model (transitively).
+// Descendants: models referencing the model (transitively).
+func (r *traversal) Traverse(model Model, ancestors bool, options GraphOptions) (graph *Graph, err error) {
+	md, found := r.dm.FindWith(model)
+	if !found {
+		err = liberr.Wrap(
+			KindErr,
+			"kind",
+			Definition{}.kind(model))
+		return
+	}
+	kinds := map[string]bool{}
+	for _, kind := range options.Kinds {
+		kMd, found := r.dm.Find(kind)
+		if !found {
+			err = liberr.Wrap(
+				KindErr,
+				"kind",
+				kind)
+			return
+		}
+		kinds[kMd.Kind] = true
+	}
+	depth := options.Depth
+	if depth <= 0 || depth > GraphMaxDepth {
+		depth = GraphMaxDepth
+	}
+	edges := []traversalEdge{}
+	for _, refMd := range r.dm.Definitions() {
+		for _, fk := range refMd.Fks() {
+			fkMd, found := r.dm.Find(fk.Table)
+			if !found {
+				continue
+			}
+			edges = append(
+				edges,
+				traversalEdge{
+					Kind:    refMd.Kind,
+					Pk:      aliasedPkExpr("m", refMd.Fields),
+					Field:   fk.Owner.Name,
+					RefKind: fkMd.Kind,
+					RefPk:   aliasedPkExpr("r", fkMd.Fields),
+				})
+		}
+	}
+	sort.Slice(
+		edges,
+		func(i, j int) bool {
+			if edges[i].Kind != edges[j].Kind {
+				return edges[i].Kind < edges[j].Kind
+			}
+			return edges[i].Field < edges[j].Field
+		})
+	stmt, err := r.sql(edges, ancestors)
+	if err != nil {
+		return
+	}
+	model = Clone(model)
+	mMd, err := Inspect(model)
+	if err != nil {
+		return
+	}
+	Table{}.EnsurePk(mMd)
+	root := GraphNode{Kind: md.Kind, Pk: ModelPk(model)}
+	graph, err = r.query(
+		stmt,
+		root,
+		sql.Named("kind", root.Kind),
+		sql.Named("pk", root.Pk),
+		sql.Named("depth", depth))
+	if err != nil {
+		return
+	}
+	if len(kinds) > 0 {
+		r.filter(graph, kinds)
+	}
+	if options.Models {
+		err = r.fetch(graph)
+	}
+
+	return
+}
+
+// Build the SQL.
+func (r *traversal) sql(edges []traversalEdge, ancestors bool) (stmt string, err error) {
+	tpl := template.New("")
+	tpl, err = tpl.Parse(GraphSQL)
+	if err != nil {
+		err = liberr.Wrap(err)
+		return
+	}
+	bfr := &bytes.Buffer{}
+	err = tpl.Execute(
+		bfr,
+		struct {
+			Edges     []traversalEdge
+			Ancestors bool
+			Param     map[string]string
+		}{
+			Edges:     edges,
+			Ancestors: ancestors,
+			Param: map[string]string{
+				"kind":  r.table.dialect().Param("kind"),
+				"pk":    r.table.dialect().Param("pk"),
+				"depth": r.table.dialect().Param("depth"),
+			},
+		})
+	if err != nil {
+		err = liberr.Wrap(err)
+		return
+	}
+
+	stmt = bfr.String()
+
+	return
+}
+
+// Query and build the graph.
+// Nodes reached by multiple paths are reported
+// once at the shortest depth.
+func (r *traversal) query(stmt string, root GraphNode, params ...interface{}) (graph *Graph, err error) {
+	rows, err := r.table.DB.Query(stmt, params...)
+	if err != nil {
+		err = liberr.Wrap(
+			r.table.mapErr(err, nil),
+			"sql",
+			stmt)
+		return
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+	nodes := map[string]*GraphNode{}
+	edges := map[GraphEdge]bool{}
+	for rows.Next() {
+		node := GraphNode{}
+		edge := GraphEdge{}
+		err = rows.Scan(
+			&node.Kind,
+			&node.Pk,
+			&node.Depth,
+			&edge.Kind,
+			&edge.Pk,
+			&edge.Field,
+			&edge.RefKind,
+			&edge.RefPk)
+		if err != nil {
+			err = liberr.Wrap(err)
+			return
+		}
+		key := node.Kind + PkSeparator + node.Pk
+		if found, exists := nodes[key]; !exists || node.Depth < found.Depth {
+			nodes[key] = &node
+		}
+		if edge.Kind != "" {
+			edges[edge] = true
+		}
+	}
+	err = rows.Err()
+	if err != nil {
+		err = liberr.Wrap(err)
+		return
+	}
+	graph = &Graph{
+		Root:  root,
+		Nodes: []GraphNode{},
+		Edges: []GraphEdge{},
+	}
+	for _, node := range nodes {
+		graph.Nodes = append(graph.Nodes, *node)
+	}
+	for edge := range edges {
+		graph.Edges = append(graph.Edges, edge)
+	}
+	sort.Slice(
+		graph.Nodes,
+		func(i, j int) bool {
+			a, b := graph.Nodes[i], graph.Nodes[j]
+			if a.Depth != b.Depth {
+				return a.Depth < b.Depth
+			}
+			if a.Kind != b.Kind {
+				return a.Kind < b.Kind
+			}
+			return a.Pk < b.Pk
+		})
+	sort.Slice(
+		graph.Edges,
+		func(i, j int) bool {
+			a, b := graph.Edges[i], graph.Edges[j]
+			if a.Kind != b.Kind {
+				return a.Kind < b.Kind
+			}
+			if a.Pk != b.Pk {
+				return a.Pk < b.Pk
+			}
+			if a.Field != b.Field {
+				return a.Field < b.Field
+			}
+			return a.RefPk < b.RefPk
+		})
+
+	return
+}
+
+// Filter the graph by kind.
+// The root and nodes of the listed kinds are kept along
+// with the edges between them.
+func (r *traversal) filter(graph *Graph, kinds map[string]bool) {
+	kept := map[string]bool{}
+	nodes := []GraphNode{}
+	for _, node := range graph.Nodes {
+		if node.Depth == 0 || kinds[node.Kind] {
+			kept[node.Kind+PkSeparator+node.Pk] = true
+			nodes = append(nodes, node)
+		}
+	}
+	edges := []GraphEdge{}
+	for _, edge := range graph.Edges {
+		if kept[edge.Kind+PkSeparator+edge.Pk] &&
+			kept[edge.RefKind+PkSeparator+edge.RefPk] {
+			edges = append(edges, edge)
+		}
+	}
+	graph.Nodes = nodes
+	graph.Edges = edges
+}
+
+// Fetch the models.
+// Fetched by kind in batches of GraphFetchBatch.
+func (r *traversal) fetch(graph *Graph) (err error) {
+	byKind := map[string][]*GraphNode{}
+	for i := range graph.Nodes {
+		node := &graph.Nodes[i]
+		byKind[node.Kind] = append(byKind[node.Kind], node)
+	}
+	for kind, nodes := range byKind {
+		md, found := r.dm.Find(kind)
+		if !found {
+			continue
+		}
+		for len(nodes) > 0 {
+			n := len(nodes)
+			if n > GraphFetchBatch {
+				n = GraphFetchBatch
+			}
+			err = r.fetchBatch(md, nodes[:n])
+			if err != nil {
+				return
+			}
+			nodes = nodes[n:]
+		}
+	}
+	for _, node := range graph.Nodes {
+		if node.Depth == 0 {
+			graph.Root.Model = node.Model
+			break
+		}
+	}
+
+	return
+}
+
+// Fetch the models for a batch of nodes of the same kind.
+func (r *traversal) fetchBatch(md *Definition, nodes []*GraphNode) (err error) {
+	predicates := []Predicate{}
+	for _, node := range nodes {
+		predicate, valid := pkPredicate(md, node.Pk)
+		if valid {
+			predicates = append(predicates, predicate)
+		}
+	}
+	if len(predicates) == 0 {
+		return
+	}
+	itr, err := r.table.Find(
+		md.NewModel(),
+		ListOptions{
+			Predicate: Or(predicates...),
+			Detail:    MaxDetail,
+		})
+	if err != nil {
+		return
+	}
+	defer itr.Close()
+	models := map[string]Model{}
+	for {
+		object, hasNext := itr.Next()
+		if !hasNext {
+			break
+		}
+		m := object.(Model)
+		models[ModelPk(m)] = m
+	}
+	for _, node := range nodes {
+		if m, found := models[node.Pk]; found {
+			node.Model = m
+		}
+	}
+
+	return
+}
+
+// Primary key SQL expression qualified by the table alias.
+// See: pkExpr().
+func aliasedPkExpr(alias string, fields []*Field) string {
+	names := []string{}
+	for _, f := range fields {
+		if f.Pk() {
+			if alias != "" {
+				names = append(names, alias+"."+f.Name)
+			} else {
+				names = append(names, f.Name)
+			}
+		}
+	}
+	if len(names) == 1 {
+		return names[0]
+	}
+
+	return "(" + strings.Join(names, " || '"+PkSeparator+"' || ") + ")"
+}
+
+// Get the ancestors of the model.
+// Models referenced by the model's FKs (transitively).
+func (r *Client) Ancestors(model Model, options GraphOptions) (graph *Graph, err error) {
+	session := r.pool.Reader()
+	defer session.Return()
+	t := traversal{dm: r.dm, table: r.table(session.db)}
+	graph, err = t.Traverse(model, true, options)
+	return
+}
+
+// Get the descendants of the model.
+// Models referencing the model by FKs (transitively).
+func (r *Client) Descendants(model Model, options GraphOptions) (graph *Graph, err error) {
+	session := r.pool.Reader()
+	defer session.Return()
+	t := traversal{dm: r.dm, table: r.table(session.db)}
+	graph, err = t.Traverse(model, false, options)
+	return
+}
@@ -1,6 +1,7 @@
 package model
 
 import (
+	"fmt"
 	liberr "github.com/konveyor/controller/pkg/error"
 	fb "github.com/konveyor/controller/pkg/filebacked"
 	"reflect"
@@ -16,6 +17,17 @@ func Inspect(model interface{}) (md *Definition, err error) {
 	if err != nil {
 		return
 	}
+	for _, f := range md.Fields {
+		err = f.resolve()
+		if err != nil {
+			return
+		}
+	}
+	if md.IsComposite() {
+		for _, f := range md.PkFields() {
+			f.composite = true
+		}
+	}
 	err = md.validate()
 	if err != nil {
 		return
@@ -26,9 +38,18 @@ func Inspect(model interface{}) (md *Definition, err error) {
 
 // Model definition.
 type Definition struct {
-	Kind   string
-	Fields []*Field
-	model  interface{}
+	Kind    string
+	Fields  []*Field
+	model   interface{}
+	dialect Dialect
+}
+
+// Bind the definition (and fields) to the SQL dialect.
+func (r *Definition) bind(dialect Dialect) {
+	r.dialect = dialect
+	for _, f := range r.Fields {
+		f.dialect = dialect
+	}
 }
 
 // Get the mutable `Fields` for the model.
@@ -68,6 +89,55 @@ func (r *Definition) Fks() []*FK {
 	return list
 }
 
+// Get the many-to-many join foreign keys for the model.
+func (r *Definition) JoinFks() []*FK {
+	list := []*FK{}
+	for _, fk := range r.Fks() {
+		if fk.Join {
+			list = append(list, fk)
+		}
+	}
+
+	return list
+}
+
+// Get whether the model is a many-to-many join model.
+func (r *Definition) IsJoin() bool {
+	return len(r.JoinFks()) == 2
+}
+
+// Get the join FKs referencing the specified kinds.
+// Returns the FKs ordered as the kinds.
+func (r *Definition) Joined(kindA, kindB string) (fkA, fkB *FK, err error) {
+	fks := r.JoinFks()
+	if len(fks) != 2 {
+		err = liberr.Wrap(
+			JoinFkErr,
+			"kind",
+			r.Kind)
+		return
+	}
+	first, second := fks[0], fks[1]
+	lower := strings.ToLower
+	switch {
+	case lower(first.Table) == lower(kindA) &&
+		lower(second.Table) == lower(kindB):
+		fkA, fkB = first, second
+	case lower(second.Table) == lower(kindA) &&
+		lower(first.Table) == lower(kindB):
+		fkA, fkB = second, first
+	default:
+		err = liberr.Wrap(
+			JoinKindErr,
+			"join",
+			r.Kind,
+			"kinds",
+			[]string{kindA, kindB})
+	}
+
+	return
+}
+
 // Get the non-virtual `Fields` for the model.
 func (r *Definition) RealFields(fields []*Field) []*Field {
 	list := []*Field{}
@@ -91,6 +161,64 @@ func (r *Definition) PkField() *Field {
 	return nil
 }
 
+// Get the primary key `Fields`.
+// Composite keys have multiple fields.
+func (r *Definition) PkFields() []*Field {
+	list := []*Field{}
+	for _, f := range r.Fields {
+		if f.Pk() {
+			list = append(list, f)
+		}
+	}
+
+	return list
+}
+
+// Get whether the primary key is composite.
+func (r *Definition) IsComposite() bool {
+	return len(r.PkFields()) > 1
+}
+
+// Get the (canonical) primary key value.
+// Composite keys are the field values joined by PkSeparator.
+func (r *Definition) PkValue() (value interface{}) {
+	fields := r.PkFields()
+	if len(fields) == 1 {
+		value = fields[0].Pull()
+		return
+	}
+	values := []string{}
+	for _, f := range fields {
+		values = append(values, fmt.Sprintf("%v", f.Pull()))
+	}
+	value = strings.Join(values, PkSeparator)
+	return
+}
+
+// Get the expiry (ttl) field.
+// Returns nil when not found.
+func (r *Definition) TtlField() *Field {
+	for _, f := range r.Fields {
+		if _, found := f.TTL(); found {
+			return f
+		}
+	}
+
+	return nil
+}
+
+// Get the field stamped with the commit revision.
+// Returns nil when not defined.
+func (r *Definition) RevisionField() *Field {
+	for _, f := range r.Fields {
+		if f.Revisioned() {
+			return f
+		}
+	}
+
+	return nil
+}
+
 // Field by name.
 func (r *Definition) Field(name string) *Field {
 	name = strings.ToLower(name)
@@ -129,6 +257,27 @@ func (r *Definition) validate() (err error) {
 	pk := r.PkField()
 	if pk == nil {
 		err = liberr.Wrap(MustHavePkErr)
+		return
+	}
+	if r.IsComposite() {
+		for _, f := range r.PkFields() {
+			if len(f.WithFields()) > 0 {
+				err = liberr.Wrap(
+					CompositePkErr,
+					"kind",
+					r.Kind,
+					"field",
+					f.Name)
+				return
+			}
+		}
+	}
+	nJoin := len(r.JoinFks())
+	if nJoin > 0 && nJoin != 2 {
+		err = liberr.Wrap(
+			JoinFkErr,
+			"kind",
+			r.Kind)
 	}
 
 	return
@@ -235,14 +384,24 @@ func NewModel(models []interface{}) (dm *DataModel, err error) {
 // Map of definitions.
 type DataModel struct {
 	content map[string]*Definition
+	dialect Dialect
 }
 
 // Add definition.
 func (r *DataModel) Add(md *Definition) {
 	key := strings.ToLower(md.Kind)
+	md.bind(r.dialect)
 	r.content[key] = md
 }
 
+// Bind the definitions to the SQL dialect.
+func (r *DataModel) bind(dialect Dialect) {
+	r.dialect = dialect
+	for _, md := range r.content {
+		md.bind(dialect)
+	}
+}
+
 // Definitions.
 func (r *DataModel) Definitions() (list Definitions) {
 	list = Definitions{}
@@ -258,7 +417,7 @@ func (r *DataModel) DDL() (list []string, err error) {
 	fkRelation := FkRelation{dm: r}
 	for _, md := range fkRelation.Definitions() {
 		var ddl []string
-		ddl, err = Table{}.DDL(md.model, r)
+		ddl, err = Table{Dialect: r.dialect}.DDL(md.model, r)
 		if err != nil {
 			return
 		}
@@ -283,28 +442,38 @@ func (r *DataModel) FindWith(model interface{}) (md *Definition, found bool) {
 }
 
 // Find models to be (cascade) deleted.
-func (r *DataModel) Deleted(tx *Tx, model interface{}) (cascaded fb.Iterator, err error) {
+// The `nulled` models reference the deleted models (+setnull)
+// and have the referencing field cleared as needed to be updated.
+// Returns RestrictErr when a deleted model is referenced (+restrict).
+func (r *DataModel) Deleted(tx *Tx, model interface{}) (cascaded, nulled fb.Iterator, err error) {
 	md, err := Inspect(model)
 	if err != nil {
 		return
 	}
 	relation := &FkRelation{dm: r}
-	cascaded, err = r.cascade(tx, relation, md)
+	deletedList := fb.NewList()
+	nulledList := fb.NewList()
+	defer func() {
+		deletedList.Close()
+		nulledList.Close()
+	}()
+	err = r.cascade(tx, relation, md, deletedList, nulledList)
 	if err != nil {
 		return
 	}
+	cascaded = deletedList.Iter()
 	cascaded.Reverse()
+	nulled = nulledList.Iter()
 	return
 }
 
 // Find models to be (cascade) deleted.
-func (r *DataModel) cascade(tx *Tx, relation *FkRelation, md *Definition) (cascaded fb.Iterator, err error) {
-	list := fb.NewList()
+func (r *DataModel) cascade(tx *Tx, relation *FkRelation, md *Definition, deleted, nulled *fb.List) (err error) {
 	referencing := relation.Referencing(md)
-	pk := md.PkField()
-	pkID := pk.Pull()
+	pkID := md.PkValue()
+	restricted := []string{}
 	for _, ref := range referencing {
-		if !ref.cascade {
+		if !ref.cascade && !ref.setNull && !ref.restrict {
 			continue
 		}
 		refModel := ref.md.NewModel()
@@ -319,28 +488,50 @@ func (r *DataModel) cascade(tx *Tx, relation *FkRelation, md *Definition) (casca
 		if err != nil {
 			return
 		}
+		if ref.restrict {
+			if iter.Len() > 0 {
+				restricted = append(
+					restricted,
+					fmt.Sprintf(
+						"%s.%s (%d)",
+						ref.md.Kind,
+						ref.field,
+						iter.Len()))
+			}
+			iter.Close()
+			continue
+		}
 		for {
 			var refMd *Definition
 			model, hasNext := iter.Next()
 			if !hasNext {
 				break
 			}
-			list.Append(model)
 			refMd, err = Inspect(model)
 			if err != nil {
 				return
 			}
-			var nIter fb.Iterator
-			nIter, err = r.cascade(tx, relation, refMd)
+			if ref.setNull {
+				f := refMd.Field(ref.field)
+				f.Value.Set(reflect.Zero(f.Value.Type()))
+				nulled.Append(model)
+				continue
+			}
+			deleted.Append(model)
+			err = r.cascade(tx, relation, refMd, deleted, nulled)
 			if err != nil {
 				return
 			}
-			list.Append(nIter)
 		}
 	}
-
-	cascaded = list.Iter()
-	list.Close()
+	if len(restricted) > 0 {
+		err = liberr.Wrap(
+			&RestrictErr{
+				Kind:       md.Kind,
+				Pk:         fmt.Sprintf("%v", pkID),
+				References: restricted,
+			})
+	}
 
 	return
 }
@@ -0,0 +1,247 @@
+package model
+
+import (
+	"bytes"
+	"reflect"
+	"text/template"
+
+	liberr "github.com/konveyor/controller/pkg/error"
+)
+
+// Orphan repair.
+const (
+	// Report only.
+	NoRepair uint8 = iota
+	// Delete the orphans (cascaded).
+	RepairDelete
+	// Clear (zero) the FK field of the orphans.
+	RepairNull
+)
+
+// Orphaned rows SQL.
+// FKs with zero (unset) values are not orphans.
+var OrphanSQL = `
+SELECT CAST({{ .Pk }} AS TEXT)
+FROM {{ .Kind }} m
+WHERE m.{{ .Field }} IS NOT NULL AND m.{{ .Field }} != {{ .Zero }}
+AND NOT EXISTS (SELECT 1 FROM {{ .RefKind }} r WHERE {{ .RefPk }} = m.{{ .Field }})
+ORDER BY 1;
+`
+
+// Integrity check options.
+type IntegrityOptions struct {
+	// Orphan repair (NoRepair|RepairDelete|RepairNull).
+	Repair uint8
+}
+
+// Orphans.
+// Rows referencing (by FK) a model that does not exist.
+type Orphans struct {
+	// Referencing model kind.
+	Kind string `json:"kind"`
+	// FK field.
+	Field string `json:"field"`
+	// Referenced model kind.
+	RefKind string `json:"refKind"`
+	// Primary keys of the orphaned models.
+	Pks []string `json:"pks"`
+	// The orphans have been repaired.
+	Repaired bool `json:"repaired"`
+}
+
+// Orphans check.
+type orphanCheck struct {
+	// Data model.
+	dm *DataModel
+	// Table (connection).
+	table Table
+}
+
+// Find orphans for each FK relation.
+// Relations without orphans are not reported. The repair
+// function (optional) is called for each relation reported.
+func (r *orphanCheck) Run(repair func(*Definition, *Orphans) error) (report []Orphans, err error) {
+	report = []Orphans{}
+	relation := &FkRelation{dm: r.dm}
+	for _, md := range relation.Definitions() {
+		for _, field := range md.Fields {
+			fk := field.Fk()
+			if fk == nil {
+				continue
+			}
+			refMd, found := r.dm.Find(fk.Table)
+			if !found {
+				continue
+			}
+			orphans := Orphans{
+				Kind:    md.Kind,
+				Field:   field.Name,
+				RefKind: refMd.Kind,
+			}
+			orphans.Pks, err = r.find(md, field, refMd)
+			if err != nil {
+				return
+			}
+			if len(orphans.Pks) == 0 {
+				continue
+			}
+			if repair != nil {
+				err = repair(md, &orphans)
+				if err != nil {
+					return
+				}
+			}
+			report = append(report, orphans)
+		}
+	}
+
+	return
+}
+
+// Find the orphans for the relation.
+func (r *orphanCheck) find(md *Definition, field *Field, refMd *Definition) (pks []string, err error) {
+	zero := "0"
+	if field.Value.Kind() == reflect.String {
+		zero = "''"
+	}
+	tpl := template.New("")
+	tpl, err = tpl.Parse(OrphanSQL)
+	if err != nil {
+		err = liberr.Wrap(err)
+		return
+	}
+	bfr := &bytes.Buffer{}
+	err = tpl.Execute(
+		bfr,
+		struct {
+			traversalEdge
+			Zero string
+		}{
+			traversalEdge: traversalEdge{
+				Kind:    md.Kind,
+				Pk:      aliasedPkExpr("m", md.Fields),
+				Field:   field.Name,
+				RefKind: refMd.Kind,
+				RefPk:   aliasedPkExpr("r", refMd.Fields),
+			},
+			Zero: zero,
+		})
+	if err != nil {
+		err = liberr.Wrap(err)
+		return
+	}
+	stmt := bfr.String()
+	rows, err := r.table.DB.Query(stmt)
+	if err != nil {
+		err = liberr.Wrap(
+			r.table.mapErr(err, md),
+			"sql",
+			stmt)
+		return
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+	pks = []string{}
+	for rows.Next() {
+		var pk string
+		err = rows.Scan(&pk)
+		if err != nil {
+			err = liberr.Wrap(err)
+			return
+		}
+		pks = append(pks, pk)
+	}
+	err = rows.Err()
+	if err != nil {
+		err = liberr.Wrap(err)
+	}
+
+	return
+}
+
+// Check referential integrity.
+// FKs without +must are not enforced by the DB. Reports the
+// orphans (by relation) and optionally repairs them. Repairs
+// are made through a (single) transaction so that events are
+// reported to watches.
+func (r *Client) CheckIntegrity(options IntegrityOptions) (report []Orphans, err error) {
+	switch options.Repair {
+	case NoRepair:
+		session := r.pool.Reader()
+		defer session.Return()
+		check := orphanCheck{dm: r.dm, table: r.table(session.db)}
+		report, err = check.Run(nil)
+	case RepairDelete, RepairNull:
+		err = r.With(
+			func(tx *Tx) (err error) {
+				check := orphanCheck{dm: r.dm, table: tx.table()}
+				report, err = check.Run(
+					func(md *Definition, orphans *Orphans) (err error) {
+						err = tx.repair(md, orphans, options.Repair)
+						return
+					})
+				return
+			})
+	default:
+		err = liberr.New(
+			"repair not valid.",
+			"repair",
+			options.Repair)
+	}
+	if err != nil {
+		return
+	}
+
+	for _, orphans := range report {
+		r.log.Info(
+			"orphans found.",
+			"kind",
+			orphans.Kind,
+			"field",
+			orphans.Field,
+			"ref",
+			orphans.RefKind,
+			"count",
+			len(orphans.Pks),
+			"repaired",
+			orphans.Repaired)
+	}
+
+	return
+}
+
+// Repair orphans.
+// Orphans already deleted (cascaded) are ignored.
+func (r *Tx) repair(md *Definition, orphans *Orphans, repair uint8) (err error) {
+	for _, pk := range orphans.Pks {
+		m, found, fErr := findByPk(r.table(), md, pk)
+		if fErr != nil {
+			err = fErr
+			return
+		}
+		if !found {
+			continue
+		}
+		switch repair {
+		case RepairDelete:
+			err = r.Delete(m)
+		case RepairNull:
+			var mMd *Definition
+			mMd, err = Inspect(m)
+			if err != nil {
+				return
+			}
+			f := mMd.Field(orphans.Field)
+			f.Value.Set(reflect.Zero(f.Value.Type()))
+			err = r.Update(m)
+		}
+		if err != nil {
+			return
+		}
+	}
+
+	orphans.Repaired = true
+
+	return
+}
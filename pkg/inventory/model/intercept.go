@@ -0,0 +1,42 @@
+package model
+
+// Operation interceptor.
+// Called for write operations (insert|update|delete)
+// and commits within transactions. Intended for tests.
+// See: modeltest.
+type Interceptor interface {
+	// Before the operation.
+	// An error returned fails the operation. The model
+	// is nil for commit.
+	Before(op string, model Model) error
+	// After the operation has completed.
+	After(op string, model Model, err error)
+}
+
+// Set the operation interceptor.
+// Must be called before transactions are started.
+func (r *Client) Intercept(interceptor Interceptor) {
+	r.interceptor = interceptor
+}
+
+// Call the interceptor before the operation.
+// Fails the operation when the tx has been aborted.
+func (r *Tx) before(op string, model Model) (err error) {
+	err = r.aborted()
+	if err != nil {
+		return
+	}
+	if r.interceptor == nil {
+		return
+	}
+	err = r.interceptor.Before(op, model)
+	return
+}
+
+// Call the interceptor after the operation.
+func (r *Tx) after(op string, model Model, err error) {
+	if r.interceptor == nil {
+		return
+	}
+	r.interceptor.After(op, model, err)
+}
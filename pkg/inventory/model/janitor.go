@@ -0,0 +1,183 @@
+package model
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	liberr "github.com/konveyor/controller/pkg/error"
+)
+
+// The janitor purge interval.
+// Must be set by the application before the DB is opened.
+// (0=disabled).
+var JanitorInterval = time.Minute
+
+// The max number of models purged per transaction.
+var JanitorBatch = 100
+
+// Expired model janitor.
+// Periodically purges models with a `ttl` field
+// older than the TTL. Models are deleted through
+// Tx.Delete() so that cascade, labels and `Deleted`
+// events are handled as usual.
+type janitor struct {
+	// DB client.
+	client *Client
+	// Purge interval.
+	interval time.Duration
+	// Max models purged per transaction.
+	batch int
+	// Stop requested.
+	done chan struct{}
+	// Goroutine ended.
+	wg sync.WaitGroup
+}
+
+// Start the janitor.
+// Not started when disabled or no models have a `ttl` field.
+func (r *janitor) Start() {
+	if r.interval <= 0 || len(r.kinds()) == 0 {
+		return
+	}
+	r.done = make(chan struct{})
+	r.wg.Add(1)
+	go r.run()
+
+	r.client.log.V(3).Info(
+		"janitor started.",
+		"interval",
+		r.interval)
+}
+
+// Shutdown the janitor.
+func (r *janitor) Shutdown() {
+	if r.done == nil {
+		return
+	}
+	close(r.done)
+	r.wg.Wait()
+	r.done = nil
+
+	r.client.log.V(3).Info("janitor stopped.")
+}
+
+// Run.
+func (r *janitor) run() {
+	defer r.wg.Done()
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			_, _ = r.Purge()
+		case <-r.done:
+			return
+		}
+	}
+}
+
+// Purge expired models.
+// A kind that fails to be purged (for example: RestrictErr)
+// is logged and does not prevent other kinds from being
+// purged. Returns the number of (expired) models deleted
+// and the first error.
+func (r *janitor) Purge() (n int, err error) {
+	for _, md := range r.kinds() {
+		purged, pErr := r.purge(md)
+		n += purged
+		if pErr != nil {
+			r.client.log.Error(pErr, "janitor: purge failed.")
+			if err == nil {
+				err = pErr
+			}
+		}
+	}
+
+	return
+}
+
+// Purge expired models of the specified kind.
+// Deleted in batches; one transaction per batch.
+// Models with a zero (unset) timestamp never expire.
+func (r *janitor) purge(md *Definition) (n int, err error) {
+	field := md.TtlField()
+	ttl, _ := field.TTL()
+	expired := time.Now().Add(-ttl).Unix()
+	batch := r.batch
+	if batch < 1 {
+		batch = 1
+	}
+	defer func() {
+		if n > 0 {
+			Metrics.Purged(md.Kind, n)
+			r.client.log.V(3).Info(
+				"janitor: expired models purged.",
+				"kind",
+				md.Kind,
+				"count",
+				n)
+		}
+	}()
+	for {
+		found := 0
+		deleted := 0
+		err = r.client.With(func(tx *Tx) (err error) {
+			itr, err := tx.Find(
+				md.NewModel(),
+				ListOptions{
+					Predicate: And(
+						Gt(field.Name, 0),
+						Lt(field.Name, expired)),
+					Page: &Page{Limit: batch},
+				})
+			if err != nil {
+				return
+			}
+			defer itr.Close()
+			found = itr.Len()
+			for {
+				m, hasNext := itr.Next()
+				if !hasNext {
+					break
+				}
+				err = tx.Delete(m.(Model))
+				if err != nil {
+					if errors.Is(err, NotFound) {
+						err = nil
+						continue
+					}
+					return
+				}
+				deleted++
+			}
+			return
+		})
+		if err != nil {
+			err = liberr.Wrap(err, "kind", md.Kind)
+			return
+		}
+		n += deleted
+		// Models cascade deleted by an earlier model in
+		// the batch are not counted as deleted.
+		if found < batch {
+			break
+		}
+	}
+
+	return
+}
+
+// Definitions with a `ttl` field.
+func (r *janitor) kinds() (list []*Definition) {
+	if r.client.dm == nil {
+		return
+	}
+	for _, md := range r.client.dm.Definitions() {
+		if md.TtlField() != nil {
+			list = append(list, md)
+		}
+	}
+
+	return
+}
@@ -2,6 +2,7 @@ package model
 
 import (
 	"fmt"
+	"strings"
 	"sync"
 
 	"github.com/go-logr/logr"
@@ -37,6 +38,8 @@ type Event struct {
 	Action uint8
 	// The updated model.
 	Updated Model
+	// The commit revision.
+	Revision int64
 }
 
 // Get whether the event has the specified label.
@@ -52,21 +55,7 @@ func (r *Event) HasLabel(label string) bool {
 
 // String representation.
 func (r *Event) String() string {
-	action := "unknown"
-	switch r.Action {
-	case Parity:
-		action = "parity"
-	case Error:
-		action = "error"
-	case End:
-		action = "end"
-	case Created:
-		action = "created"
-	case Updated:
-		action = "updated"
-	case Deleted:
-		action = "deleted"
-	}
+	action := actionName(r.Action)
 	model := ""
 	if r.Model != nil {
 		model = Describe(r.Model)
@@ -78,6 +67,28 @@ func (r *Event) String() string {
 		model)
 }
 
+// Get the name of the action.
+func actionName(action uint8) (name string) {
+	switch action {
+	case Parity:
+		name = "parity"
+	case Error:
+		name = "error"
+	case End:
+		name = "end"
+	case Created:
+		name = "created"
+	case Updated:
+		name = "updated"
+	case Deleted:
+		name = "deleted"
+	default:
+		name = "unknown"
+	}
+
+	return
+}
+
 // Append self to the list.
 // The protocol is to write:
 //
@@ -86,9 +97,10 @@ func (r *Event) String() string {
 //	Event.Updated (optional)
 func (r *Event) append(list *fb.List) {
 	list.Append(Event{
-		ID:     r.ID,
-		Labels: r.Labels,
-		Action: r.Action,
+		ID:       r.ID,
+		Labels:   r.Labels,
+		Action:   r.Action,
+		Revision: r.Revision,
 	})
 	list.Append(r.Model)
 	if r.Action == Updated {
@@ -132,6 +144,11 @@ type WatchOptions struct {
 	// Initial snapshot.
 	// List models and report as `Created` events.
 	Snapshot bool
+	// Stream the snapshot.
+	// The snapshot is streamed (holding a reader session)
+	// rather than detached (copied) before being reported.
+	// Ignored by WatchKinds(); the snapshot is detached.
+	Stream bool
 }
 
 // Event handler.
@@ -159,7 +176,11 @@ type EventHandler interface {
 // Model event watch.
 type Watch struct {
 	// Model to be watched.
+	// Nil when watching multiple kinds.
 	Model Model
+	// Models (kinds) to be watched.
+	// Empty when watching all kinds.
+	Models []Model
 	// Event handler.
 	Handler EventHandler
 	// ID
@@ -174,15 +195,30 @@ type Watch struct {
 	started bool
 	// Done
 	done bool
+	// Watched kinds.
+	kinds map[string]bool
 }
 
 // String representation.
 func (w *Watch) String() string {
-	kind := ref.ToKind(w.Model)
 	return fmt.Sprintf(
 		"watch-%.4d: model=%s",
 		w.id,
-		kind)
+		w.kind())
+}
+
+// Watched kind(s).
+// Comma separated; `*` when watching all kinds.
+func (w *Watch) kind() string {
+	if len(w.Models) == 0 {
+		return "*"
+	}
+	kinds := []string{}
+	for _, m := range w.Models {
+		kinds = append(kinds, ref.ToKind(m))
+	}
+
+	return strings.Join(kinds, ",")
 }
 
 // End the watch.
@@ -196,8 +232,12 @@ func (w *Watch) Alive() bool {
 }
 
 // Match by model `kind`.
+// All kinds are matched when watching all kinds.
 func (w *Watch) Match(model Model) bool {
-	return ref.ToKind(w.Model) == ref.ToKind(model)
+	if len(w.kinds) == 0 {
+		return true
+	}
+	return w.kinds[ref.ToKind(model)]
 }
 
 // Queue event.
@@ -207,6 +247,7 @@ func (w *Watch) notify(itr fb.Iterator) {
 	}()
 	select {
 	case w.queue <- itr:
+		Metrics.Queued(w.kind(), len(w.queue))
 	default:
 		description := "full queue, event discarded"
 		w.Handler.Error(liberr.New(description))
@@ -216,7 +257,8 @@ func (w *Watch) notify(itr fb.Iterator) {
 
 // Run the watch.
 // Forward events to the `handler`.
-func (w *Watch) Start(snapshot fb.Iterator) {
+// The snapshot is closed after being reported.
+func (w *Watch) Start(snapshot Iterator) {
 	if w.started {
 		return
 	}
@@ -238,6 +280,7 @@ func (w *Watch) Start(snapshot fb.Iterator) {
 						Model:  m.(Model),
 					})
 			} else {
+				snapshot.Close()
 				w.log.V(3).Info("has parity.")
 				w.Handler.Parity()
 				break
@@ -293,27 +336,51 @@ type Journal struct {
 	log logr.Logger
 	// List of registered watches.
 	watches []*Watch
+	// List of registered sinks.
+	sinks []EventSink
+	// Sink cursors stored (when opened).
+	cursors bool
+	// Commit (with sinks) notification.
+	notify chan struct{}
 }
 
 // Watch a `watch` of the specified model.
 // The returned watch has not been started.
 // See: Watch.Start().
-func (r *Journal) Watch(model Model, handler EventHandler) (*Watch, error) {
+func (r *Journal) Watch(model Model, handler EventHandler) (watch *Watch, err error) {
+	watch, err = r.WatchKinds([]Model{model}, handler)
+	if err == nil {
+		watch.Model = model
+	}
+
+	return
+}
+
+// Watch a `watch` of the specified models (kinds).
+// All kinds are watched when no models are specified.
+// Events for all of the kinds are delivered (in commit
+// order) using a single queue.
+// The returned watch has not been started.
+// See: Watch.Start().
+func (r *Journal) WatchKinds(models []Model, handler EventHandler) (*Watch, error) {
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
 	id := serial.next(0)
-	log := logging.WithName("journal|watch").Real.WithValues(
-		"id",
-		id,
-		"model",
-		ref.ToKind(model))
 	watch := &Watch{
 		Handler: handler,
-		Model:   model,
+		Models:  models,
 		id:      id,
 		journal: r,
-		log:     log,
+		kinds:   make(map[string]bool),
 	}
+	for _, m := range models {
+		watch.kinds[ref.ToKind(m)] = true
+	}
+	watch.log = logging.WithName("journal|watch").Real.WithValues(
+		"id",
+		id,
+		"model",
+		watch.kind())
 	r.watches = append(r.watches, watch)
 	watch.queue = make(chan fb.Iterator, 250)
 
@@ -347,12 +414,93 @@ func (r *Journal) End(watch *Watch) {
 
 // Transaction committed.
 // Recorded (staged) events are forwarded to watches.
+// Sink delivery is notified.
 func (r *Journal) Report(staged *fb.List) {
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
 	for _, w := range r.watches {
 		w.notify(staged.Iter())
 	}
+	if len(r.sinks) > 0 && r.notify != nil {
+		select {
+		case r.notify <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Register an event sink.
+// Must be registered before the DB is opened for batches
+// committed while opening to be delivered.
+// See: EventSink.
+func (r *Journal) Sink(sink EventSink) (err error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for _, s := range r.sinks {
+		if s.Name() == sink.Name() {
+			err = liberr.Wrap(
+				SinkErr,
+				"reason",
+				"duplicate",
+				"name",
+				sink.Name())
+			return
+		}
+	}
+	r.sinks = append(r.sinks, sink)
+
+	r.log.V(3).Info(
+		"sink registered.",
+		"name",
+		sink.Name())
+
+	return
+}
+
+// Unregister an event sink.
+func (r *Journal) RemoveSink(name string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for i, s := range r.sinks {
+		if s.Name() == name {
+			r.sinks = append(r.sinks[:i:i], r.sinks[i+1:]...)
+			break
+		}
+	}
+}
+
+// Registered sinks.
+func (r *Journal) Sinks() (list []EventSink) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	list = append(list, r.sinks...)
+	return
+}
+
+// Has registered sinks.
+func (r *Journal) hasSink() bool {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return len(r.sinks) > 0
+}
+
+// The outbox is written.
+// Written while sinks are registered or sink cursors
+// were stored when the DB was opened.
+func (r *Journal) outboxed() bool {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return len(r.sinks) > 0 || r.cursors
+}
+
+// Commit (with sinks) notification.
+func (r *Journal) committed() <-chan struct{} {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.notify == nil {
+		r.notify = make(chan struct{}, 1)
+	}
+	return r.notify
 }
 
 // Close the journal.
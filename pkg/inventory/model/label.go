@@ -1,5 +1,8 @@
 package model
 
+// Label table.
+const labelKind = "Label"
+
 // Labels collection.
 type Labels map[string]string
 
@@ -0,0 +1,121 @@
+package model
+
+import (
+	"sync"
+	"time"
+)
+
+// The session leak threshold.
+// Sessions held longer are logged (once) with the caller
+// stack and reported to the metrics hook. (0=disabled).
+var LeakThreshold = time.Minute
+
+// The transaction max lifespan.
+// Sessions with open transactions held longer are aborted:
+// the transactions are rolled back and the session returned
+// to the pool. Subsequent operations on the transaction fail
+// with TxAbortedErr. (0=disabled).
+var TxMaxLifespan time.Duration
+
+// The leak detector check interval.
+// Must be set by the application before the DB is opened.
+var LeakCheckInterval = time.Second * 10
+
+// Session leak detector.
+// Periodically checks for sessions held past the
+// leak threshold and transaction max lifespan.
+type leakDetector struct {
+	// DB client.
+	client *Client
+	// Check interval.
+	interval time.Duration
+	// Leak threshold.
+	threshold time.Duration
+	// Transaction max lifespan.
+	lifespan time.Duration
+	// Stop requested.
+	done chan struct{}
+	// Goroutine ended.
+	wg sync.WaitGroup
+}
+
+// Start the detector.
+// Not started when both the threshold and max
+// lifespan are disabled.
+func (r *leakDetector) Start() {
+	if r.interval <= 0 || (r.threshold <= 0 && r.lifespan <= 0) {
+		return
+	}
+	r.done = make(chan struct{})
+	r.wg.Add(1)
+	go r.run()
+
+	r.client.log.V(3).Info(
+		"leak detector started.",
+		"threshold",
+		r.threshold,
+		"lifespan",
+		r.lifespan)
+}
+
+// Shutdown the detector.
+func (r *leakDetector) Shutdown() {
+	if r.done == nil {
+		return
+	}
+	close(r.done)
+	r.wg.Wait()
+	r.done = nil
+
+	r.client.log.V(3).Info("leak detector stopped.")
+}
+
+// Run.
+func (r *leakDetector) run() {
+	defer r.wg.Done()
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			r.Check()
+		case <-r.done:
+			return
+		}
+	}
+}
+
+// Check for held sessions.
+func (r *leakDetector) Check() {
+	reported, aborted := r.client.pool.held(r.threshold, r.lifespan)
+	for _, s := range reported {
+		Metrics.Held(s.Role, s.Age, false)
+		r.client.log.Info(
+			"session held past the leak threshold.",
+			"session",
+			s.ID,
+			"role",
+			s.Role,
+			"age",
+			s.Age,
+			"tx",
+			s.Tx,
+			"stack",
+			s.Stack)
+	}
+	for _, s := range aborted {
+		Metrics.Held(s.Role, s.Age, true)
+		r.client.log.Info(
+			"session aborted: transaction max lifespan exceeded.",
+			"session",
+			s.ID,
+			"role",
+			s.Role,
+			"age",
+			s.Age,
+			"tx",
+			s.Tx,
+			"stack",
+			s.Stack)
+	}
+}
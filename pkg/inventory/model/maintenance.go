@@ -0,0 +1,238 @@
+package model
+
+import (
+	"sync"
+	"time"
+
+	liberr "github.com/konveyor/controller/pkg/error"
+)
+
+// Maintenance tasks.
+const (
+	TaskCheckpoint = "checkpoint"
+	TaskOptimize   = "optimize"
+	TaskVacuum     = "vacuum"
+	TaskIntegrity  = "integrity"
+)
+
+// The maintenance interval.
+// Must be set by the application before the DB is opened.
+// (0=disabled).
+var MaintenanceInterval = time.Hour
+
+// The integrity check interval.
+// Checked on the first maintenance run after the interval
+// has elapsed. (0=disabled).
+var IntegrityInterval = time.Hour * 24
+
+// Maintenance task.
+type task struct {
+	// Task name.
+	name string
+	// Task function.
+	fn func(*Session) error
+}
+
+// Maintenance scheduler.
+// Periodically runs (using the writer session):
+//   - PRAGMA optimize (ANALYZE as needed)
+//   - incremental vacuum
+//   - wal_checkpoint(TRUNCATE)
+//   - integrity_check
+//
+// The checkpoint follows the tasks that write to the WAL.
+type maintenance struct {
+	// DB client.
+	client *Client
+	// Maintenance interval.
+	interval time.Duration
+	// Integrity check interval.
+	integrity time.Duration
+	// Last integrity check.
+	checked time.Time
+	// Stop requested.
+	done chan struct{}
+	// Goroutine ended.
+	wg sync.WaitGroup
+}
+
+// Start the scheduler.
+// Not started when disabled.
+func (r *maintenance) Start() {
+	if r.interval <= 0 {
+		return
+	}
+	r.checked = time.Now()
+	r.done = make(chan struct{})
+	r.wg.Add(1)
+	go r.run()
+
+	r.client.log.V(3).Info(
+		"maintenance started.",
+		"interval",
+		r.interval)
+}
+
+// Shutdown the scheduler.
+func (r *maintenance) Shutdown() {
+	if r.done == nil {
+		return
+	}
+	close(r.done)
+	r.wg.Wait()
+	r.done = nil
+
+	r.client.log.V(3).Info("maintenance stopped.")
+}
+
+// Run.
+func (r *maintenance) run() {
+	defer r.wg.Done()
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			err := r.Run(false)
+			if err != nil {
+				r.client.log.Error(err, "maintenance failed.")
+			}
+		case <-r.done:
+			return
+		}
+	}
+}
+
+// Run the maintenance tasks.
+// The integrity check is included when forced or
+// the integrity interval has elapsed.
+func (r *maintenance) Run(integrity bool) (err error) {
+	session := r.client.pool.Writer()
+	defer session.Return()
+	if r.integrity > 0 && time.Since(r.checked) >= r.integrity {
+		integrity = true
+	}
+	tasks := []task{
+		{name: TaskOptimize, fn: r.optimize},
+		{name: TaskVacuum, fn: r.vacuum},
+		{name: TaskCheckpoint, fn: r.checkpoint},
+	}
+	if integrity {
+		tasks = append(
+			tasks,
+			task{name: TaskIntegrity, fn: r.check})
+	}
+	for _, t := range tasks {
+		mark := time.Now()
+		err = t.fn(session)
+		Metrics.Maintained(t.name, time.Since(mark), err == nil)
+		if err != nil {
+			err = liberr.Wrap(err, "task", t.name)
+			return
+		}
+		r.client.log.V(3).Info(
+			"maintenance task succeeded.",
+			"task",
+			t.name,
+			"duration",
+			time.Since(mark))
+	}
+
+	return
+}
+
+// Checkpoint the WAL and truncate the `-wal` file.
+// The checkpoint is reported as busy (not an error) when
+// blocked by readers.
+func (r *maintenance) checkpoint(session *Session) (err error) {
+	var busy, pages, checkpointed int
+	row := session.db.QueryRow("PRAGMA wal_checkpoint(TRUNCATE)")
+	err = row.Scan(&busy, &pages, &checkpointed)
+	if err != nil {
+		err = liberr.Wrap(mapErr(r.client.dialect, err, nil))
+		return
+	}
+	if busy != 0 {
+		r.client.log.V(3).Info(
+			"maintenance: checkpoint blocked by readers.",
+			"pages",
+			pages,
+			"checkpointed",
+			checkpointed)
+	}
+
+	return
+}
+
+// Optimize.
+// Runs ANALYZE as needed to maintain query plans.
+func (r *maintenance) optimize(session *Session) (err error) {
+	_, err = session.db.Exec("PRAGMA optimize")
+	if err != nil {
+		err = liberr.Wrap(mapErr(r.client.dialect, err, nil))
+	}
+
+	return
+}
+
+// Incremental vacuum.
+// Free pages are returned to the filesystem. Only effective
+// when the DB was created with auto_vacuum=INCREMENTAL.
+func (r *maintenance) vacuum(session *Session) (err error) {
+	rows, err := session.db.Query("PRAGMA incremental_vacuum")
+	if err != nil {
+		err = liberr.Wrap(mapErr(r.client.dialect, err, nil))
+		return
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+	for rows.Next() {
+		// A page is freed per step.
+	}
+	err = rows.Err()
+	if err != nil {
+		err = liberr.Wrap(mapErr(r.client.dialect, err, nil))
+	}
+
+	return
+}
+
+// Integrity check.
+// Returns IntegrityErr with the reported problems.
+func (r *maintenance) check(session *Session) (err error) {
+	r.checked = time.Now()
+	rows, err := session.db.Query("PRAGMA integrity_check")
+	if err != nil {
+		err = liberr.Wrap(mapErr(r.client.dialect, err, nil))
+		return
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+	problems := []string{}
+	for rows.Next() {
+		var line string
+		err = rows.Scan(&line)
+		if err != nil {
+			err = liberr.Wrap(err)
+			return
+		}
+		if line != "ok" {
+			problems = append(problems, line)
+		}
+	}
+	err = rows.Err()
+	if err != nil {
+		err = liberr.Wrap(mapErr(r.client.dialect, err, nil))
+		return
+	}
+	if len(problems) > 0 {
+		err = liberr.Wrap(
+			IntegrityErr,
+			"problems",
+			problems)
+	}
+
+	return
+}
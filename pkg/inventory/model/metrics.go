@@ -0,0 +1,281 @@
+package model
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Metrics namespace.
+const (
+	MetricsNamespace = "inventory"
+	MetricsSubsystem = "model"
+)
+
+// Operations.
+const (
+	OpInsert  = "insert"
+	OpUpdate  = "update"
+	OpDelete  = "delete"
+	OpGet     = "get"
+	OpList    = "list"
+	OpFind    = "find"
+	OpStream  = "stream"
+	OpCount   = "count"
+	OpExecute = "execute"
+	OpCommit  = "commit"
+)
+
+// Session roles.
+const (
+	RoleWriter = "writer"
+	RoleReader = "reader"
+)
+
+// The metrics hook.
+// Must be set by the application before the DB is opened.
+// Example:
+//
+//	func init() {
+//	  model.Metrics = model.NewPrometheusMetrics(metrics.Registry)
+//	}
+var Metrics MetricsHook = &StockMetrics{}
+
+// The slow query threshold.
+// Operations taking longer are logged with the
+// rendered SQL and query plan. (0=disabled).
+var SlowQueryThreshold time.Duration
+
+// Metrics hook.
+type MetricsHook interface {
+	// An operation has completed.
+	Operation(op, kind string, duration time.Duration, rows int64)
+	// A slow operation has completed.
+	Slow(op, kind string, duration time.Duration)
+	// A session has been reserved after waiting.
+	Waited(role string, duration time.Duration)
+	// A transaction has ended.
+	TxEnded(committed bool, lifespan time.Duration)
+	// An event batch has been queued for a watch.
+	Queued(kind string, depth int)
+	// Expired models have been purged.
+	Purged(kind string, count int)
+	// A maintenance task has completed.
+	Maintained(task string, duration time.Duration, succeeded bool)
+	// A session has been held past the leak threshold
+	// or aborted (transaction max lifespan exceeded).
+	Held(role string, age time.Duration, aborted bool)
+}
+
+// Stock metrics hook.
+// Provides default (no-op) methods.
+type StockMetrics struct{}
+
+// An operation has completed.
+func (m *StockMetrics) Operation(string, string, time.Duration, int64) {}
+
+// A slow operation has completed.
+func (m *StockMetrics) Slow(string, string, time.Duration) {}
+
+// A session has been reserved after waiting.
+func (m *StockMetrics) Waited(string, time.Duration) {}
+
+// A transaction has ended.
+func (m *StockMetrics) TxEnded(bool, time.Duration) {}
+
+// An event batch has been queued for a watch.
+func (m *StockMetrics) Queued(string, int) {}
+
+// Expired models have been purged.
+func (m *StockMetrics) Purged(string, int) {}
+
+// A maintenance task has completed.
+func (m *StockMetrics) Maintained(string, time.Duration, bool) {}
+
+// A session has been held past the leak threshold.
+func (m *StockMetrics) Held(string, time.Duration, bool) {}
+
+// Prometheus metrics hook.
+type PrometheusMetrics struct {
+	// Operation latency by op and kind.
+	latency *prometheus.HistogramVec
+	// Rows affected/returned by op and kind.
+	rows *prometheus.CounterVec
+	// Slow operations by op and kind.
+	slow *prometheus.CounterVec
+	// Pool (session) wait by role.
+	poolWait *prometheus.HistogramVec
+	// Transaction lifespan by outcome.
+	txLifespan *prometheus.HistogramVec
+	// Watch queue depth by kind.
+	queueDepth *prometheus.HistogramVec
+	// Purged (expired) models by kind.
+	purged *prometheus.CounterVec
+	// Maintenance task duration by task and outcome.
+	maintenance *prometheus.HistogramVec
+	// Held (leaked) sessions by role and action.
+	held *prometheus.CounterVec
+}
+
+// Build prometheus metrics.
+// The collectors are registered with the registerer.
+// Collectors already registered are reused.
+func NewPrometheusMetrics(registerer prometheus.Registerer) (m *PrometheusMetrics) {
+	m = &PrometheusMetrics{
+		latency: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace: MetricsNamespace,
+				Subsystem: MetricsSubsystem,
+				Name:      "operation_duration_seconds",
+				Help:      "Model operation latency.",
+				Buckets:   prometheus.ExponentialBuckets(0.0001, 4, 10),
+			},
+			[]string{"op", "kind"}),
+		rows: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: MetricsNamespace,
+				Subsystem: MetricsSubsystem,
+				Name:      "operation_rows_total",
+				Help:      "Rows affected or returned by model operations.",
+			},
+			[]string{"op", "kind"}),
+		slow: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: MetricsNamespace,
+				Subsystem: MetricsSubsystem,
+				Name:      "slow_operations_total",
+				Help:      "Model operations exceeding the slow query threshold.",
+			},
+			[]string{"op", "kind"}),
+		poolWait: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace: MetricsNamespace,
+				Subsystem: MetricsSubsystem,
+				Name:      "pool_wait_seconds",
+				Help:      "Time waiting for a pool session.",
+				Buckets:   prometheus.ExponentialBuckets(0.0001, 4, 10),
+			},
+			[]string{"role"}),
+		txLifespan: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace: MetricsNamespace,
+				Subsystem: MetricsSubsystem,
+				Name:      "tx_lifespan_seconds",
+				Help:      "Transaction lifespan.",
+				Buckets:   prometheus.ExponentialBuckets(0.0001, 4, 10),
+			},
+			[]string{"outcome"}),
+		queueDepth: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace: MetricsNamespace,
+				Subsystem: MetricsSubsystem,
+				Name:      "watch_queue_depth",
+				Help:      "Watch event queue depth.",
+				Buckets:   []float64{0, 1, 5, 10, 50, 100, 250},
+			},
+			[]string{"kind"}),
+		purged: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: MetricsNamespace,
+				Subsystem: MetricsSubsystem,
+				Name:      "purged_total",
+				Help:      "Expired models purged by the janitor.",
+			},
+			[]string{"kind"}),
+		maintenance: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace: MetricsNamespace,
+				Subsystem: MetricsSubsystem,
+				Name:      "maintenance_duration_seconds",
+				Help:      "Maintenance task duration.",
+				Buckets:   prometheus.ExponentialBuckets(0.001, 4, 10),
+			},
+			[]string{"task", "outcome"}),
+		held: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: MetricsNamespace,
+				Subsystem: MetricsSubsystem,
+				Name:      "held_sessions_total",
+				Help:      "Sessions held past the leak threshold or aborted.",
+			},
+			[]string{"role", "action"}),
+	}
+	m.latency = register(registerer, m.latency).(*prometheus.HistogramVec)
+	m.rows = register(registerer, m.rows).(*prometheus.CounterVec)
+	m.slow = register(registerer, m.slow).(*prometheus.CounterVec)
+	m.poolWait = register(registerer, m.poolWait).(*prometheus.HistogramVec)
+	m.txLifespan = register(registerer, m.txLifespan).(*prometheus.HistogramVec)
+	m.queueDepth = register(registerer, m.queueDepth).(*prometheus.HistogramVec)
+	m.purged = register(registerer, m.purged).(*prometheus.CounterVec)
+	m.maintenance = register(registerer, m.maintenance).(*prometheus.HistogramVec)
+	m.held = register(registerer, m.held).(*prometheus.CounterVec)
+
+	return
+}
+
+// An operation has completed.
+func (m *PrometheusMetrics) Operation(op, kind string, duration time.Duration, rows int64) {
+	m.latency.WithLabelValues(op, kind).Observe(duration.Seconds())
+	m.rows.WithLabelValues(op, kind).Add(float64(rows))
+}
+
+// A slow operation has completed.
+func (m *PrometheusMetrics) Slow(op, kind string, duration time.Duration) {
+	m.slow.WithLabelValues(op, kind).Inc()
+}
+
+// A session has been reserved after waiting.
+func (m *PrometheusMetrics) Waited(role string, duration time.Duration) {
+	m.poolWait.WithLabelValues(role).Observe(duration.Seconds())
+}
+
+// A transaction has ended.
+func (m *PrometheusMetrics) TxEnded(committed bool, lifespan time.Duration) {
+	outcome := "rollback"
+	if committed {
+		outcome = "commit"
+	}
+	m.txLifespan.WithLabelValues(outcome).Observe(lifespan.Seconds())
+}
+
+// An event batch has been queued for a watch.
+func (m *PrometheusMetrics) Queued(kind string, depth int) {
+	m.queueDepth.WithLabelValues(kind).Observe(float64(depth))
+}
+
+// Expired models have been purged.
+func (m *PrometheusMetrics) Purged(kind string, count int) {
+	m.purged.WithLabelValues(kind).Add(float64(count))
+}
+
+// A maintenance task has completed.
+func (m *PrometheusMetrics) Maintained(task string, duration time.Duration, succeeded bool) {
+	outcome := "failed"
+	if succeeded {
+		outcome = "succeeded"
+	}
+	m.maintenance.WithLabelValues(task, outcome).Observe(duration.Seconds())
+}
+
+// A session has been held past the leak threshold.
+func (m *PrometheusMetrics) Held(role string, age time.Duration, aborted bool) {
+	action := "reported"
+	if aborted {
+		action = "aborted"
+	}
+	m.held.WithLabelValues(role, action).Inc()
+}
+
+// Register the collector.
+// Returns the already registered collector as needed.
+func register(registerer prometheus.Registerer, c prometheus.Collector) prometheus.Collector {
+	err := registerer.Register(c)
+	if err != nil {
+		if already, cast := err.(prometheus.AlreadyRegisteredError); cast {
+			return already.ExistingCollector
+		}
+		log.Error(err, "metrics collector not registered.")
+	}
+
+	return c
+}
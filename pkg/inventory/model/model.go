@@ -5,6 +5,7 @@ import (
 	"github.com/konveyor/controller/pkg/logging"
 	"github.com/konveyor/controller/pkg/ref"
 	"reflect"
+	"strings"
 )
 
 // Package logger.
@@ -113,3 +114,83 @@ func Describe(model Model) (s string) {
 
 	return
 }
+
+// Get the (canonical) primary key of the model.
+// Composite keys are the pk field values joined
+// by the PkSeparator. Used to key labels and
+// relations. Defaults to Model.Pk().
+func ModelPk(model Model) (pk string) {
+	md, err := Inspect(model)
+	if err == nil && md.IsComposite() {
+		pk = md.PkValue().(string)
+		return
+	}
+
+	pk = model.Pk()
+	return
+}
+
+// Internal (table) kind.
+// Revision and sink tables.
+func internal(kind string) bool {
+	switch kind {
+	case revisionKind, outboxKind, cursorKind:
+		return true
+	}
+
+	return false
+}
+
+// Application (model) kind.
+// Internal, label and audit tables are excluded.
+func application(kind string) bool {
+	return !internal(kind) &&
+		kind != auditKind &&
+		kind != labelKind
+}
+
+// Find a model by (canonical) primary key.
+// Matched on the primary key field(s) rather than using
+// Get() which (re)generates generated primary keys.
+func findByPk(table Table, md *Definition, pk string) (model Model, found bool, err error) {
+	predicate, valid := pkPredicate(md, pk)
+	if !valid {
+		return
+	}
+	itr, err := table.Find(
+		md.NewModel(),
+		ListOptions{
+			Predicate: predicate,
+			Detail:    MaxDetail,
+		})
+	if err != nil {
+		return
+	}
+	defer itr.Close()
+	object, found := itr.Next()
+	if found {
+		model = object.(Model)
+	}
+
+	return
+}
+
+// Predicate matching the (canonical) primary key.
+// Not valid when the PK does not match the PK fields.
+func pkPredicate(md *Definition, pk string) (predicate Predicate, valid bool) {
+	fields := md.PkFields()
+	values := []string{pk}
+	if len(fields) > 1 {
+		values = strings.SplitN(pk, PkSeparator, len(fields))
+	}
+	if len(values) != len(fields) {
+		return
+	}
+	predicates := []Predicate{}
+	for n, f := range fields {
+		predicates = append(predicates, Eq(f.Name, values[n]))
+	}
+	predicate = And(predicates...)
+	valid = true
+	return
+}
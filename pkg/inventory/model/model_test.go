@@ -1,12 +1,23 @@
 package model
 
 import (
+	"bytes"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
 	"errors"
 	"fmt"
 	liberr "github.com/konveyor/controller/pkg/error"
 	"github.com/konveyor/controller/pkg/ref"
 	"github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus"
 	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -124,6 +135,342 @@ func (m *TestObject) Labels() Labels {
 	return m.labels
 }
 
+type Host struct {
+	ID   int    `sql:"pk"`
+	Name string `sql:""`
+}
+
+func (m *Host) Pk() string {
+	return fmt.Sprintf("%d", m.ID)
+}
+
+type Datastore struct {
+	ID   int    `sql:"pk"`
+	Name string `sql:""`
+}
+
+func (m *Datastore) Pk() string {
+	return fmt.Sprintf("%d", m.ID)
+}
+
+type HostDatastore struct {
+	PK        string `sql:"pk(host;datastore)"`
+	Host      int    `sql:"fk(Host +join)"`
+	Datastore int    `sql:"fk(Datastore +join)"`
+}
+
+func (m *HostDatastore) Pk() string {
+	return m.PK
+}
+
+type DetailE struct {
+	PK int `sql:"pk"`
+	FK int `sql:"fk(Host +setnull)"`
+}
+
+func (m *DetailE) Pk() string {
+	return fmt.Sprintf("%d", m.PK)
+}
+
+type DetailF struct {
+	PK int `sql:"pk"`
+	FK int `sql:"fk(Datastore +restrict)"`
+}
+
+func (m *DetailF) Pk() string {
+	return fmt.Sprintf("%d", m.PK)
+}
+
+type DetailG struct {
+	PK int `sql:"pk"`
+	FK int `sql:"fk(Host +setnull +must)"`
+}
+
+func (m *DetailG) Pk() string {
+	return fmt.Sprintf("%d", m.PK)
+}
+
+type UniqueObject struct {
+	ID   int    `sql:"pk"`
+	Name string `sql:"unique(a)"`
+}
+
+func (m *UniqueObject) Pk() string {
+	return fmt.Sprintf("%d", m.ID)
+}
+
+type Lease struct {
+	ID      int   `sql:"pk"`
+	Renewed int64 `sql:"ttl(1h)"`
+}
+
+func (m *Lease) Pk() string {
+	return fmt.Sprintf("%d", m.ID)
+}
+
+type LeaseDetail struct {
+	ID    int `sql:"pk"`
+	Lease int `sql:"fk(Lease +cascade)"`
+}
+
+func (m *LeaseDetail) Pk() string {
+	return fmt.Sprintf("%d", m.ID)
+}
+
+type LeaseHold struct {
+	ID    int `sql:"pk"`
+	Lease int `sql:"fk(Lease +restrict)"`
+}
+
+func (m *LeaseHold) Pk() string {
+	return fmt.Sprintf("%d", m.ID)
+}
+
+type LeaseTree struct {
+	ID      int   `sql:"pk"`
+	Parent  int   `sql:"fk(LeaseTree +cascade)"`
+	Renewed int64 `sql:"ttl(1h)"`
+}
+
+func (m *LeaseTree) Pk() string {
+	return fmt.Sprintf("%d", m.ID)
+}
+
+type BadLease struct {
+	ID      int    `sql:"pk"`
+	Renewed string `sql:"ttl(1h)"`
+}
+
+func (m *BadLease) Pk() string {
+	return fmt.Sprintf("%d", m.ID)
+}
+
+type BadLeaseTTL struct {
+	ID      int   `sql:"pk"`
+	Renewed int64 `sql:"ttl(1x)"`
+}
+
+func (m *BadLeaseTTL) Pk() string {
+	return fmt.Sprintf("%d", m.ID)
+}
+
+type RevObject struct {
+	ID   int    `sql:"pk"`
+	Name string `sql:""`
+	Rev  int64  `sql:"revision"`
+}
+
+func (m *RevObject) Pk() string {
+	return fmt.Sprintf("%d", m.ID)
+}
+
+type ProjectedVM struct {
+	ID   int `sql:"pk"`
+	Host int `sql:""`
+}
+
+func (m *ProjectedVM) Pk() string {
+	return fmt.Sprintf("%d", m.ID)
+}
+
+type HostSummary struct {
+	Host int `sql:"pk"`
+	VMs  int `sql:""`
+}
+
+func (m *HostSummary) Pk() string {
+	return fmt.Sprintf("%d", m.Host)
+}
+
+type BadRevObject struct {
+	ID  int    `sql:"pk"`
+	Rev string `sql:"revision"`
+}
+
+func (m *BadRevObject) Pk() string {
+	return fmt.Sprintf("%d", m.ID)
+}
+
+// Stored as INTEGER using a registered codec.
+type Quantity struct {
+	Milli int64
+}
+
+type QuantityCodec struct{}
+
+func (c *QuantityCodec) Storage() string {
+	return StorageInteger
+}
+
+func (c *QuantityCodec) Encode(value interface{}) (interface{}, error) {
+	return value.(Quantity).Milli, nil
+}
+
+func (c *QuantityCodec) Decode(stored interface{}, ptr interface{}) error {
+	ptr.(*Quantity).Milli = stored.(int64)
+	return nil
+}
+
+// Stored as TEXT using driver.Valuer and sql.Scanner.
+type Level int
+
+const (
+	LevelLow Level = iota
+	LevelHigh
+)
+
+var levels = []string{"low", "high"}
+
+func (l Level) Value() (driver.Value, error) {
+	return levels[l], nil
+}
+
+func (l *Level) Scan(stored interface{}) error {
+	for i, name := range levels {
+		if name == stored.(string) {
+			*l = Level(i)
+			return nil
+		}
+	}
+	return errors.New("level not valid")
+}
+
+// Stored as INTEGER (declared) using driver.Valuer and sql.Scanner.
+// Negative scores are not valid.
+type Score struct {
+	N int64
+}
+
+func (s Score) Value() (driver.Value, error) {
+	if s.N < 0 {
+		return nil, errors.New("score not valid")
+	}
+	return s.N, nil
+}
+
+func (s *Score) Scan(stored interface{}) error {
+	s.N = stored.(int64)
+	if s.N < 0 {
+		return errors.New("score not valid")
+	}
+	return nil
+}
+
+type NullObject struct {
+	ID    int             `sql:"pk"`
+	Count sql.NullInt64   `sql:""`
+	Flag  sql.NullBool    `sql:""`
+	Ratio sql.NullFloat64 `sql:""`
+	Score Score           `sql:"storage(integer)"`
+	Level Level           `sql:""`
+}
+
+func (m *NullObject) Pk() string {
+	return fmt.Sprintf("%d", m.ID)
+}
+
+type BadStorage struct {
+	ID   int    `sql:"pk"`
+	Name string `sql:"storage(integer)"`
+}
+
+func (m *BadStorage) Pk() string {
+	return fmt.Sprintf("%d", m.ID)
+}
+
+type CodecObject struct {
+	PK    string   `sql:"pk(size;level)"`
+	Size  Quantity `sql:"key"`
+	Level Level    `sql:"key"`
+	Name  string   `sql:""`
+}
+
+func (m *CodecObject) Pk() string {
+	return m.PK
+}
+
+type Zoned struct {
+	Zone   string `sql:"pk"`
+	ID     int    `sql:"pk"`
+	Name   string `sql:""`
+	labels Labels
+}
+
+func (m *Zoned) Pk() string {
+	return fmt.Sprintf("%s/%d", m.Zone, m.ID)
+}
+
+func (m *Zoned) Labels() Labels {
+	return m.labels
+}
+
+type ZonedDetail struct {
+	ID     int    `sql:"pk"`
+	Parent string `sql:"fk(Zoned +cascade)"`
+}
+
+func (m *ZonedDetail) Pk() string {
+	return fmt.Sprintf("%d", m.ID)
+}
+
+type ZonedMust struct {
+	ID     int    `sql:"pk"`
+	Parent string `sql:"fk(Zoned +must)"`
+}
+
+func (m *ZonedMust) Pk() string {
+	return fmt.Sprintf("%d", m.ID)
+}
+
+type GenObject struct {
+	PK   string `sql:"pk(name;n)"`
+	Name string
+	N    int
+}
+
+type Sha256Object struct {
+	PK   string `sql:"pk(name;n +sha256)"`
+	Name string
+	N    int
+}
+
+type UuidObject struct {
+	PK   string `sql:"pk(name;n +uuid5)"`
+	Name string
+	N    int
+}
+
+type UuidNsObject struct {
+	PK   string `sql:"pk(name;n +uuid5=6ba7b810-9dad-11d1-80b4-00c04fd430c8)"`
+	Name string
+	N    int
+}
+
+type ConcatObject struct {
+	PK   string `sql:"pk(name; n +concat)"`
+	Name string
+	N    int
+}
+
+type BadGen struct {
+	PK   string `sql:"pk(name +md5)"`
+	Name string
+}
+
+func (m *BadGen) Pk() string {
+	return m.PK
+}
+
+type BadComposite struct {
+	PK   string `sql:"pk(name)"`
+	ID   int    `sql:"pk"`
+	Name string
+}
+
+func (m *BadComposite) Pk() string {
+	return m.PK
+}
+
 // received event.
 type TestEvent struct {
 	action  uint8
@@ -131,9 +478,8 @@ type TestEvent struct {
 	updated *TestObject
 }
 
-type TestHandler struct {
-	options WatchOptions
-	name    string
+// Events recorded by the TestHandler.
+type TestRecord struct {
 	started bool
 	parity  bool
 	all     []TestEvent
@@ -144,19 +490,40 @@ type TestHandler struct {
 	done    bool
 }
 
+type TestHandler struct {
+	options WatchOptions
+	name    string
+	mutex   sync.Mutex
+	TestRecord
+}
+
+// Copy of the recorded events.
+func (w *TestHandler) snapshot() (r TestRecord) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	r = w.TestRecord
+	return
+}
+
 func (w *TestHandler) Options() WatchOptions {
 	return w.options
 }
 
 func (w *TestHandler) Started(uint64) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
 	w.started = true
 }
 
 func (w *TestHandler) Parity() {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
 	w.parity = true
 }
 
 func (w *TestHandler) Created(e Event) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
 	if object, cast := e.Model.(*TestObject); cast {
 		w.all = append(w.all, TestEvent{action: e.Action, model: object})
 		w.created = append(w.created, object.ID)
@@ -164,6 +531,8 @@ func (w *TestHandler) Created(e Event) {
 }
 
 func (w *TestHandler) Updated(e Event) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
 	if object, cast := e.Model.(*TestObject); cast {
 		w.all = append(w.all, TestEvent{
 			action:  e.Action,
@@ -174,6 +543,8 @@ func (w *TestHandler) Updated(e Event) {
 	}
 }
 func (w *TestHandler) Deleted(e Event) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
 	if object, cast := e.Model.(*TestObject); cast {
 		w.all = append(w.all, TestEvent{action: e.Action, model: object})
 		w.deleted = append(w.deleted, object.ID)
@@ -181,17 +552,69 @@ func (w *TestHandler) Deleted(e Event) {
 }
 
 func (w *TestHandler) Error(err error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
 	w.err = append(w.err, err)
 }
 
 func (w *TestHandler) End() {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
 	w.done = true
 }
 
+// Records events (all kinds) as: action:kind:pk.
+type KindHandler struct {
+	StockEventHandler
+	options WatchOptions
+	parity  int
+	all     []string
+	mutex   sync.Mutex
+}
+
+func (w *KindHandler) Options() WatchOptions {
+	return w.options
+}
+
+func (w *KindHandler) Parity() {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.parity++
+	w.all = append(w.all, "parity")
+}
+
+func (w *KindHandler) Created(e Event) {
+	w.record(e)
+}
+
+func (w *KindHandler) Updated(e Event) {
+	w.record(e)
+}
+
+func (w *KindHandler) Deleted(e Event) {
+	w.record(e)
+}
+
+func (w *KindHandler) record(e Event) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.all = append(
+		w.all,
+		actionName(e.Action)+":"+ref.ToKind(e.Model)+":"+e.Model.Pk())
+}
+
+func (w *KindHandler) events() (all []string) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	all = append(all, w.all...)
+	return
+}
+
 type MutatingHandler struct {
 	options WatchOptions
 	DB
 	name    string
+	mutex   sync.Mutex
 	started bool
 	parity  bool
 	created []int
@@ -203,19 +626,36 @@ func (w *MutatingHandler) Options() WatchOptions {
 }
 
 func (w *MutatingHandler) Started(uint64) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
 	w.started = true
 }
 
 func (w *MutatingHandler) Parity() {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
 	w.parity = true
 }
 
+// Count of updated models.
+func (w *MutatingHandler) nUpdated() int {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return len(w.updated)
+}
+
 func (w *MutatingHandler) Created(e Event) {
-	tx, _ := w.DB.Begin()
+	tx, err := w.DB.Begin()
+	if err != nil {
+		// closed.
+		return
+	}
 	tx.Get(e.Model)
 	e.Model.(*TestObject).Age++
 	_ = tx.Update(e.Model)
 	_ = tx.Commit()
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
 	w.created = append(w.created, e.Model.(*TestObject).ID)
 }
 
@@ -225,11 +665,17 @@ func (w *MutatingHandler) Updated(e Event) {
 		// ignore the echo event.
 		return
 	}
-	tx, _ := w.DB.Begin(label)
+	tx, err := w.DB.Begin(label)
+	if err != nil {
+		// closed.
+		return
+	}
 	tx.Get(e.Model)
 	e.Model.(*TestObject).Age++
 	_ = tx.Update(e.Model)
 	_ = tx.Commit()
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
 	w.updated = append(w.updated, e.Model.(*TestObject).ID)
 }
 
@@ -246,15 +692,43 @@ func (w *MutatingHandler) End() {
 // Used for cascade delete event testing.
 type DetailHandler struct {
 	StockEventHandler
+	mutex   sync.Mutex
+	updated []string
 	deleted []string
 }
 
+func (h *DetailHandler) Updated(e Event) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.updated = append(
+		h.updated,
+		e.Model.Pk())
+}
+
 func (h *DetailHandler) Deleted(e Event) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
 	h.deleted = append(
 		h.deleted,
 		e.Model.Pk())
 }
 
+// Copy of the updated pks.
+func (h *DetailHandler) updatedPks() (pks []string) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	pks = append(pks, h.updated...)
+	return
+}
+
+// Copy of the deleted pks.
+func (h *DetailHandler) deletedPks() (pks []string) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	pks = append(pks, h.deleted...)
+	return
+}
+
 func TestDefinition(t *testing.T) {
 	var err error
 	g := gomega.NewGomegaWithT(t)
@@ -298,6 +772,9 @@ func TestCRUD(t *testing.T) {
 		&PlainObject{},
 		&TestObject{})
 	err = DB.Open(true)
+	defer func() {
+		_ = DB.Close(true)
+	}()
 	g.Expect(err).To(gomega.BeNil())
 
 	plainA := &PlainObject{
@@ -406,6 +883,9 @@ func TestCascade(t *testing.T) {
 		&DetailB{},
 		&DetailA{})
 	err = DB.Open(true)
+	defer func() {
+		_ = DB.Close(true)
+	}()
 	g.Expect(err).To(gomega.BeNil())
 
 	id := func() int {
@@ -510,861 +990,2137 @@ func TestCascade(t *testing.T) {
 
 	for i := 0; i < 10; i++ {
 		time.Sleep(time.Millisecond * 10)
-		if len(handler.deleted) != 40 {
+		if len(handler.deletedPks()) != 40 {
 			continue
 		} else {
 			break
 		}
 	}
-	g.Expect(len(handler.deleted)).To(gomega.Equal(40))
+	g.Expect(len(handler.deletedPks())).To(gomega.Equal(40))
 
 }
 
-func TestTransactions(t *testing.T) {
+func TestManyToMany(t *testing.T) {
+	var err error
 	g := gomega.NewGomegaWithT(t)
 	DB := New(
-		"/tmp/test-transactions.db",
-		&TestObject{})
-	err := DB.Open(true)
+		"/tmp/test-m2m.db",
+		&Host{},
+		&Datastore{},
+		&HostDatastore{})
+	err = DB.Open(true)
 	g.Expect(err).To(gomega.BeNil())
-	for i := 0; i < 10; i++ {
-		// Begin
-		tx, err := DB.Begin()
-		defer tx.End()
-		g.Expect(err).To(gomega.BeNil())
-		object := &TestObject{
-			ID:   i,
-			Name: "Elmer",
+	defer func() {
+		_ = DB.Close(true)
+	}()
+	md, err := Inspect(&HostDatastore{})
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(md.IsJoin()).To(gomega.BeTrue())
+	hosts := []*Host{{ID: 1}, {ID: 2}}
+	datastores := []*Datastore{{ID: 1}, {ID: 2}, {ID: 3}}
+	handler := &DetailHandler{}
+	w, err := DB.Watch(&HostDatastore{}, handler)
+	g.Expect(err).To(gomega.BeNil())
+	// Link.
+	err = DB.With(func(tx *Tx) (err error) {
+		for _, m := range hosts {
+			err = tx.Insert(m)
+			if err != nil {
+				return
+			}
 		}
-		err = tx.Insert(object)
-		g.Expect(err).To(gomega.BeNil())
-		// Get (not found)
-		object = &TestObject{ID: object.ID}
-		err = DB.Get(object)
-		g.Expect(errors.Is(err, NotFound)).To(gomega.BeTrue())
-		tx.Commit()
-		// Get (found)
-		object = &TestObject{ID: object.ID}
-		err = DB.Get(object)
+		for _, m := range datastores {
+			err = tx.Insert(m)
+			if err != nil {
+				return
+			}
+		}
+		links := [][2]int{{0, 0}, {0, 1}, {1, 1}, {1, 2}, {0, 0}}
+		for _, link := range links {
+			err = tx.Link(
+				&HostDatastore{},
+				hosts[link[0]],
+				datastores[link[1]])
+			if err != nil {
+				return
+			}
+		}
+		return
+	})
+	g.Expect(err).To(gomega.BeNil())
+	n, err := DB.Count(&HostDatastore{}, nil)
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(n).To(gomega.Equal(int64(4)))
+	// Related.
+	dsList := []Datastore{}
+	err = DB.List(
+		&dsList,
+		ListOptions{
+			Predicate: Related(&HostDatastore{}, hosts[0]),
+		})
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(len(dsList)).To(gomega.Equal(2))
+	g.Expect(dsList[0].ID).To(gomega.Equal(1))
+	g.Expect(dsList[1].ID).To(gomega.Equal(2))
+	hostList := []Host{}
+	err = DB.List(
+		&hostList,
+		ListOptions{
+			Predicate: Related(&HostDatastore{}, datastores[1]),
+		})
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(len(hostList)).To(gomega.Equal(2))
+	// Unlink.
+	err = DB.With(func(tx *Tx) error {
+		return tx.Unlink(&HostDatastore{}, datastores[1], hosts[0])
+	})
+	g.Expect(err).To(gomega.BeNil())
+	dsList = []Datastore{}
+	err = DB.List(
+		&dsList,
+		ListOptions{
+			Predicate: Related(&HostDatastore{}, hosts[0]),
+		})
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(len(dsList)).To(gomega.Equal(1))
+	// Cascade.
+	err = DB.Delete(hosts[1])
+	g.Expect(err).To(gomega.BeNil())
+	n, err = DB.Count(&HostDatastore{}, nil)
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(n).To(gomega.Equal(int64(1)))
+	for i := 0; i < 10; i++ {
+		if len(handler.deletedPks()) == 3 {
+			break
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	g.Expect(len(handler.deletedPks())).To(gomega.Equal(3))
+	w.End()
+	// Not joined.
+	err = DB.With(func(tx *Tx) error {
+		return tx.Link(&HostDatastore{}, hosts[0], &PlainObject{})
+	})
+	g.Expect(errors.Is(err, JoinKindErr)).To(gomega.BeTrue())
+}
+
+func TestSetNullRestrict(t *testing.T) {
+	var err error
+	g := gomega.NewGomegaWithT(t)
+	DB := New(
+		"/tmp/test-setnull.db",
+		&Host{},
+		&Datastore{},
+		&DetailE{},
+		&DetailF{})
+	err = DB.Open(true)
+	defer func() {
+		_ = DB.Close(true)
+	}()
+	g.Expect(err).To(gomega.BeNil())
+	handler := &DetailHandler{}
+	w, err := DB.Watch(&DetailE{}, handler)
+	g.Expect(err).To(gomega.BeNil())
+	// Set null.
+	err = DB.Insert(&Host{ID: 1})
+	g.Expect(err).To(gomega.BeNil())
+	for i := 1; i < 3; i++ {
+		err = DB.Insert(&DetailE{PK: i, FK: 1})
 		g.Expect(err).To(gomega.BeNil())
 	}
+	err = DB.Delete(&Host{ID: 1})
+	g.Expect(err).To(gomega.BeNil())
+	for i := 1; i < 3; i++ {
+		m := &DetailE{PK: i}
+		err = DB.Get(m)
+		g.Expect(err).To(gomega.BeNil())
+		g.Expect(m.FK).To(gomega.Equal(0))
+	}
+	for i := 0; i < 10; i++ {
+		if len(handler.updatedPks()) == 2 {
+			break
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	g.Expect(handler.updatedPks()).To(gomega.Equal([]string{"1", "2"}))
+	w.End()
+	// Restrict.
+	err = DB.Insert(&Datastore{ID: 1})
+	g.Expect(err).To(gomega.BeNil())
+	err = DB.Insert(&DetailF{PK: 1, FK: 1})
+	g.Expect(err).To(gomega.BeNil())
+	err = DB.Delete(&Datastore{ID: 1})
+	restrictErr := &RestrictErr{}
+	g.Expect(errors.As(err, &restrictErr)).To(gomega.BeTrue())
+	g.Expect(restrictErr.Kind).To(gomega.Equal("Datastore"))
+	g.Expect(restrictErr.References).To(gomega.Equal([]string{"DetailF.FK (1)"}))
+	err = DB.Get(&Datastore{ID: 1})
+	g.Expect(err).To(gomega.BeNil())
+	err = DB.Delete(&DetailF{PK: 1})
+	g.Expect(err).To(gomega.BeNil())
+	err = DB.Delete(&Datastore{ID: 1})
+	g.Expect(err).To(gomega.BeNil())
+	// Not compatible.
+	_, err = Inspect(&DetailG{})
+	g.Expect(errors.Is(err, FkFlagErr)).To(gomega.BeTrue())
 }
 
-func TestWithTxSucceeded(t *testing.T) {
+func TestExpiry(t *testing.T) {
+	var err error
 	g := gomega.NewGomegaWithT(t)
+	metrics := &RecordedMetrics{operation: map[string]int64{}}
+	Metrics = metrics
+	JanitorBatch = 2
+	defer func() {
+		Metrics = &StockMetrics{}
+		JanitorInterval = time.Minute
+		JanitorBatch = 100
+	}()
 	DB := New(
-		"/tmp/test-withtx-succeeded.db",
-		&TestObject{})
-	err := DB.Open(true)
+		"/tmp/test-expiry.db",
+		&Lease{},
+		&LeaseDetail{})
+	err = DB.Open(true)
 	g.Expect(err).To(gomega.BeNil())
-	labels := []string{"A", "B"}
-	n := 10
-	//
-	// Insert in TX.
-	insert := func(tx *Tx) (err error) {
-		g.Expect(tx.labels).To(gomega.Equal(labels))
-		for i := 0; i < n; i++ {
-			object := &TestObject{
-				ID:   i,
-				Name: "Elmer",
-			}
-			err = tx.Insert(object)
+	now := time.Now()
+	for i := 0; i < 10; i++ {
+		renewed := now
+		if i%2 == 0 {
+			renewed = now.Add(-time.Hour * 2)
+		}
+		err = DB.Insert(&Lease{ID: i, Renewed: renewed.Unix()})
+		g.Expect(err).To(gomega.BeNil())
+		err = DB.Insert(&LeaseDetail{ID: i, Lease: i})
+		g.Expect(err).To(gomega.BeNil())
+	}
+	n, err := DB.Purge()
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(n).To(gomega.Equal(5))
+	g.Expect(metrics.purged).To(gomega.Equal(5))
+	for i := 0; i < 10; i++ {
+		err = DB.Get(&Lease{ID: i})
+		err2 := DB.Get(&LeaseDetail{ID: i})
+		if i%2 == 0 {
+			g.Expect(errors.Is(err, NotFound)).To(gomega.BeTrue())
+			g.Expect(errors.Is(err2, NotFound)).To(gomega.BeTrue())
+		} else {
 			g.Expect(err).To(gomega.BeNil())
-			object = &TestObject{ID: object.ID}
+			g.Expect(err2).To(gomega.BeNil())
 		}
-		return
 	}
-	//
-	// Test committed.
-	err = DB.With(insert, labels...)
-	for i := 0; i < n; i++ {
-		object := &TestObject{ID: i}
-		err = DB.Get(object)
+	n, err = DB.Purge()
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(n).To(gomega.Equal(0))
+	err = DB.Close(false)
+	g.Expect(err).To(gomega.BeNil())
+	// Janitor.
+	JanitorInterval = time.Millisecond * 10
+	err = DB.Open(false)
+	g.Expect(err).To(gomega.BeNil())
+	err = DB.Update(&Lease{ID: 1, Renewed: now.Add(-time.Hour * 2).Unix()})
+	g.Expect(err).To(gomega.BeNil())
+	for i := 0; i < 100; i++ {
+		err = DB.Get(&Lease{ID: 1})
+		if err != nil {
+			break
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	g.Expect(errors.Is(err, NotFound)).To(gomega.BeTrue())
+	err = DB.Close(true)
+	g.Expect(err).To(gomega.BeNil())
+	// Cascaded within the batch (self referencing).
+	JanitorInterval = 0
+	DB = New(
+		"/tmp/test-expiry.db",
+		&LeaseTree{})
+	err = DB.Open(true)
+	g.Expect(err).To(gomega.BeNil())
+	expired := now.Add(-time.Hour * 2).Unix()
+	err = DB.Insert(&LeaseTree{ID: 1, Renewed: expired})
+	g.Expect(err).To(gomega.BeNil())
+	err = DB.Insert(&LeaseTree{ID: 2, Parent: 1, Renewed: expired})
+	g.Expect(err).To(gomega.BeNil())
+	err = DB.Insert(&LeaseTree{ID: 3, Renewed: expired})
+	g.Expect(err).To(gomega.BeNil())
+	_, err = DB.Purge()
+	g.Expect(err).To(gomega.BeNil())
+	count, err := DB.Count(&LeaseTree{}, nil)
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(count).To(gomega.Equal(int64(0)))
+	err = DB.Close(true)
+	g.Expect(err).To(gomega.BeNil())
+	// Restricted kind does not block other kinds.
+	// Zero timestamp not expired.
+	DB = New(
+		"/tmp/test-expiry.db",
+		&Lease{},
+		&LeaseHold{},
+		&LeaseTree{})
+	err = DB.Open(true)
+	g.Expect(err).To(gomega.BeNil())
+	err = DB.Insert(&Lease{ID: 1, Renewed: expired})
+	g.Expect(err).To(gomega.BeNil())
+	err = DB.Insert(&LeaseHold{ID: 1, Lease: 1})
+	g.Expect(err).To(gomega.BeNil())
+	err = DB.Insert(&Lease{ID: 2})
+	g.Expect(err).To(gomega.BeNil())
+	err = DB.Insert(&LeaseTree{ID: 1, Renewed: expired})
+	g.Expect(err).To(gomega.BeNil())
+	n, err = DB.Purge()
+	restrictErr := &RestrictErr{}
+	g.Expect(errors.As(err, &restrictErr)).To(gomega.BeTrue())
+	g.Expect(n).To(gomega.Equal(1))
+	count, err = DB.Count(&LeaseTree{}, nil)
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(count).To(gomega.Equal(int64(0)))
+	count, err = DB.Count(&Lease{}, nil)
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(count).To(gomega.Equal(int64(2)))
+	err = DB.Close(true)
+	g.Expect(err).To(gomega.BeNil())
+	// Not valid.
+	_, err = Inspect(&BadLease{})
+	g.Expect(errors.Is(err, TtlTypeErr)).To(gomega.BeTrue())
+	_, err = Inspect(&BadLeaseTTL{})
+	g.Expect(errors.Is(err, TtlErr)).To(gomega.BeTrue())
+}
+
+func TestMaintenance(t *testing.T) {
+	var err error
+	g := gomega.NewGomegaWithT(t)
+	metrics := &RecordedMetrics{
+		operation: map[string]int64{},
+		tasks:     map[string]int{},
+	}
+	Metrics = metrics
+	defer func() {
+		Metrics = &StockMetrics{}
+		MaintenanceInterval = time.Hour
+	}()
+	path := "/tmp/test-maintenance.db"
+	DB := New(path, &TestObject{})
+	err = DB.Open(true)
+	g.Expect(err).To(gomega.BeNil())
+	for i := 0; i < 100; i++ {
+		err = DB.Insert(&TestObject{ID: i, Name: "Elmer"})
+		g.Expect(err).To(gomega.BeNil())
+	}
+	for i := 0; i < 100; i++ {
+		err = DB.Delete(&TestObject{ID: i})
 		g.Expect(err).To(gomega.BeNil())
 	}
+	err = DB.Maintain()
+	g.Expect(err).To(gomega.BeNil())
+	st, err := os.Stat(path + "-wal")
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(st.Size()).To(gomega.Equal(int64(0)))
+	metrics.mutex.Lock()
+	g.Expect(metrics.tasks[TaskIntegrity]).To(gomega.Equal(1))
+	metrics.mutex.Unlock()
+	err = DB.Close(false)
+	g.Expect(err).To(gomega.BeNil())
+	// Scheduled.
+	MaintenanceInterval = time.Millisecond * 10
+	DB = New(path, &TestObject{})
+	err = DB.Open(false)
+	g.Expect(err).To(gomega.BeNil())
+	for i := 0; i < 100; i++ {
+		metrics.mutex.Lock()
+		n := metrics.tasks[TaskCheckpoint]
+		metrics.mutex.Unlock()
+		if n > 2 {
+			break
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	metrics.mutex.Lock()
+	g.Expect(metrics.tasks[TaskCheckpoint] > 2).To(gomega.BeTrue())
+	g.Expect(metrics.tasks[TaskOptimize] > 2).To(gomega.BeTrue())
+	g.Expect(metrics.tasks[TaskVacuum] > 2).To(gomega.BeTrue())
+	g.Expect(metrics.tasks[TaskIntegrity]).To(gomega.Equal(1))
+	metrics.mutex.Unlock()
+	err = DB.Close(true)
+	g.Expect(err).To(gomega.BeNil())
 }
 
-func TestWithTxFailed(t *testing.T) {
+func TestSchema(t *testing.T) {
+	var err error
 	g := gomega.NewGomegaWithT(t)
 	DB := New(
-		"/tmp/test-withtx-failed.db",
-		&TestObject{})
-	err := DB.Open(true)
+		"/tmp/test-schema.db",
+		&Host{},
+		&Datastore{},
+		&HostDatastore{},
+		&Lease{},
+		&UniqueObject{})
+	err = DB.Open(true)
 	g.Expect(err).To(gomega.BeNil())
-	//
-	// Insert in TX with duplicate key error.
-	fakeErr := liberr.New("Faked")
-	insert := func(tx *Tx) (err error) {
-		object := &TestObject{}
-		err = tx.Insert(object)
-		g.Expect(err).To(gomega.BeNil())
-		err = fakeErr
-		return
+	defer func() {
+		_ = DB.Close(true)
+	}()
+	schema := DB.Schema()
+	kinds := []string{}
+	for _, m := range schema.Models {
+		kinds = append(kinds, m.Kind)
 	}
-	//
-	// Test not committed.
-	err = DB.With(insert)
-	g.Expect(errors.Is(err, fakeErr)).To(gomega.BeTrue())
-	n, err := DB.Count(&TestObject{}, nil)
+	g.Expect(kinds).To(gomega.Equal(
+		[]string{
+			"Datastore",
+			"Host",
+			"HostDatastore",
+			"Label",
+			"Lease",
+			"UniqueObject",
+		}))
+	m, found := schema.Find("HostDatastore")
+	g.Expect(found).To(gomega.BeTrue())
+	g.Expect(m.Join).To(gomega.BeTrue())
+	g.Expect(m.Fields[0].Name).To(gomega.Equal("PK"))
+	g.Expect(m.Fields[0].Pk).To(gomega.BeTrue())
+	g.Expect(m.Fields[0].Type).To(gomega.Equal("TEXT"))
+	g.Expect(m.Fields[1].Type).To(gomega.Equal("INTEGER"))
+	g.Expect(*m.Fields[1].Fk).To(gomega.Equal(
+		FkSchema{
+			Kind:  "Host",
+			Field: "ID",
+			Join:  true,
+		}))
+	m, found = schema.Find("Lease")
+	g.Expect(found).To(gomega.BeTrue())
+	g.Expect(m.Fields[1].TTL).To(gomega.Equal("1h0m0s"))
+	g.Expect(m.Fields[1].Detail).To(gomega.Equal(DefaultDetail))
+	m, found = schema.Find("UniqueObject")
+	g.Expect(found).To(gomega.BeTrue())
+	g.Expect(m.Fields[1].Unique).To(gomega.Equal([]string{"a"}))
+	// Serializable.
+	b, err := json.Marshal(schema)
 	g.Expect(err).To(gomega.BeNil())
-	g.Expect(n).To(gomega.Equal(int64(0)))
+	decoded := Schema{}
+	err = json.Unmarshal(b, &decoded)
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(decoded).To(gomega.Equal(schema))
 }
 
-func TestList(t *testing.T) {
+func TestFilter(t *testing.T) {
 	var err error
 	g := gomega.NewGomegaWithT(t)
 	DB := New(
-		"/tmp/test-list.db",
+		"/tmp/test-filter.db",
 		&TestObject{})
 	err = DB.Open(true)
 	g.Expect(err).To(gomega.BeNil())
-	N := 10
-	for i := 0; i < N; i++ {
+	defer func() {
+		_ = DB.Close(true)
+	}()
+	for i := 0; i < 10; i++ {
 		object := &TestObject{
-			ID:     i,
-			Name:   "Elmer",
-			Age:    18,
-			Int8:   8,
-			Int16:  16,
-			Int32:  32,
-			Bool:   true,
-			Object: TestEncoded{Name: "json"},
-			Slice:  []string{"hello", "world"},
-			Map:    map[string]int{"A": 1, "B": 2},
-			D1:     "d-1",
-			D2:     "d-2",
-			D3:     "d-3",
-			D4:     "d-4",
+			ID:   i,
+			Name: "Elmer",
+			Int8: 8,
+			Bool: true,
 			labels: Labels{
 				"id": fmt.Sprintf("v%d", i),
+				"n":  fmt.Sprintf("%d", i),
 			},
 		}
+		if i%2 == 0 {
+			object.labels["even"] = ""
+		}
 		err = DB.Insert(object)
 		g.Expect(err).To(gomega.BeNil())
 	}
-	// List detail level=0
-	list := []TestObject{}
-	err = DB.List(&list, ListOptions{})
+	md, err := Inspect(&TestObject{})
 	g.Expect(err).To(gomega.BeNil())
-	g.Expect(len(list)).To(gomega.Equal(10))
-	g.Expect(list[0].Name).To(gomega.Equal(""))
-	g.Expect(list[0].Slice).To(gomega.BeNil())
-	g.Expect(list[0].D1).To(gomega.Equal(""))
-	g.Expect(list[0].D2).To(gomega.Equal(""))
-	g.Expect(list[0].D3).To(gomega.Equal(""))
-	g.Expect(list[0].D4).To(gomega.Equal(""))
-	// List detail level=1
-	list = []TestObject{}
-	err = DB.List(&list, ListOptions{Detail: 1})
+	cases := []struct {
+		expr   string
+		ids    []int
+		format string
+	}{
+		{
+			expr:   "id > 2 and id < 6",
+			ids:    []int{3, 4, 5},
+			format: "ID > 2 and ID < 6",
+		},
+		{
+			expr:   "id in (1,3) or labels.n = 8",
+			ids:    []int{1, 3, 8},
+			format: `ID in (1,3) or labels.n = "8"`,
+		},
+		{
+			expr:   "(id = 1 OR id == 2) and labels.even exists",
+			ids:    []int{2},
+			format: `(ID = 1 or ID = 2) and labels.even exists`,
+		},
+		{
+			expr:   `name = "Elmer" and labels.id not in (v1, "v2") and labels.n != 3`,
+			ids:    []int{0, 4, 5, 6, 7, 8, 9},
+			format: `Name = "Elmer" and labels.id not in ("v1","v2") and labels.n != "3"`,
+		},
+		{
+			expr:   "labels.n > 7 or labels.even not exists and id < 2",
+			ids:    []int{1, 8, 9},
+			format: "labels.n > 7 or labels.even not exists and ID < 2",
+		},
+		{
+			expr:   "id not in (1,3,5,7,9) and id != 0",
+			ids:    []int{2, 4, 6, 8},
+			format: "ID not in (1,3,5,7,9) and ID != 0",
+		},
+		{
+			expr:   "int8 = int8 and bool = true and id < 2",
+			ids:    []int{0, 1},
+			format: "Int8 = Int8 and Bool = true and ID < 2",
+		},
+	}
+	for _, c := range cases {
+		p, err := Parse(c.expr, md)
+		g.Expect(err).To(gomega.BeNil(), c.expr)
+		list := []TestObject{}
+		err = DB.List(&list, ListOptions{Predicate: p, Sort: []int{2}})
+		g.Expect(err).To(gomega.BeNil(), c.expr)
+		ids := []int{}
+		for _, m := range list {
+			ids = append(ids, m.ID)
+		}
+		g.Expect(ids).To(gomega.Equal(c.ids), c.expr)
+		// Format.
+		s := Format(p)
+		g.Expect(s).To(gomega.Equal(c.format))
+		p2, err := Parse(s, md)
+		g.Expect(err).To(gomega.BeNil(), s)
+		g.Expect(Format(p2)).To(gomega.Equal(s))
+	}
+	// Errors.
+	errCases := []struct {
+		expr string
+		pos  int
+	}{
+		{expr: `id > "x"`, pos: 5},
+		{expr: "nope = 1", pos: 0},
+		{expr: `name > "a"`, pos: 5},
+		{expr: "id = ", pos: 5},
+		{expr: "(id = 1", pos: 7},
+		{expr: "id = 1 id = 2", pos: 7},
+		{expr: `name = "x`, pos: 7},
+		{expr: "id ! 1", pos: 3},
+		{expr: "labels.n in 1", pos: 12},
+		{expr: "id = other", pos: 5},
+	}
+	for _, c := range errCases {
+		_, err := Parse(c.expr, md)
+		parseErr := &ParseErr{}
+		g.Expect(errors.As(err, &parseErr)).To(gomega.BeTrue(), c.expr)
+		g.Expect(parseErr.Pos).To(gomega.Equal(c.pos), c.expr)
+	}
+}
+
+func TestCodec(t *testing.T) {
+	var err error
+	g := gomega.NewGomegaWithT(t)
+	RegisterCodec(Quantity{}, &QuantityCodec{})
+	DB := New(
+		"/tmp/test-codec.db",
+		&CodecObject{})
+	err = DB.Open(true)
 	g.Expect(err).To(gomega.BeNil())
-	g.Expect(len(list)).To(gomega.Equal(10))
-	g.Expect(list[0].Name).To(gomega.Equal(""))
-	g.Expect(list[0].Slice).To(gomega.BeNil())
-	g.Expect(list[0].D1).To(gomega.Equal("d-1"))
-	g.Expect(list[0].D2).To(gomega.Equal(""))
-	g.Expect(list[0].D3).To(gomega.Equal(""))
-	g.Expect(list[0].D4).To(gomega.Equal(""))
-	// List detail level=2
-	list = []TestObject{}
-	err = DB.List(&list, ListOptions{Detail: 2})
+	defer func() {
+		_ = DB.Close(true)
+	}()
+	schema := DB.Schema()
+	m, found := schema.Find("CodecObject")
+	g.Expect(found).To(gomega.BeTrue())
+	g.Expect(m.Fields[1].Type).To(gomega.Equal(StorageInteger))
+	g.Expect(m.Fields[2].Type).To(gomega.Equal(StorageText))
+	pks := map[string]bool{}
+	for i := 0; i < 10; i++ {
+		object := &CodecObject{
+			Size:  Quantity{Milli: int64(i * 1000)},
+			Level: Level(i % 2),
+			Name:  fmt.Sprintf("n%d", i),
+		}
+		err = DB.Insert(object)
+		g.Expect(err).To(gomega.BeNil())
+		g.Expect(object.PK).ToNot(gomega.BeEmpty())
+		pks[object.PK] = true
+	}
+	g.Expect(len(pks)).To(gomega.Equal(10))
+	// Get (natural key).
+	object := &CodecObject{
+		Size:  Quantity{Milli: 3000},
+		Level: LevelHigh,
+	}
+	err = DB.Get(object)
 	g.Expect(err).To(gomega.BeNil())
-	g.Expect(len(list)).To(gomega.Equal(10))
-	g.Expect(list[0].Name).To(gomega.Equal(""))
-	g.Expect(list[0].Slice).To(gomega.BeNil())
-	g.Expect(list[0].D1).To(gomega.Equal("d-1"))
-	g.Expect(list[0].D2).To(gomega.Equal("d-2"))
-	g.Expect(list[0].D3).To(gomega.Equal(""))
-	g.Expect(list[0].D4).To(gomega.Equal(""))
-	// List detail level=3
-	list = []TestObject{}
-	err = DB.List(&list, ListOptions{Detail: 3})
-	g.Expect(err).To(gomega.BeNil())
-	g.Expect(len(list)).To(gomega.Equal(10))
-	g.Expect(list[0].Name).To(gomega.Equal(""))
-	g.Expect(list[0].Slice).To(gomega.BeNil())
-	g.Expect(list[0].D1).To(gomega.Equal("d-1"))
-	g.Expect(list[0].D2).To(gomega.Equal("d-2"))
-	g.Expect(list[0].D3).To(gomega.Equal("d-3"))
-	g.Expect(list[0].D4).To(gomega.Equal(""))
-	// List detail level=4
-	list = []TestObject{}
-	err = DB.List(&list, ListOptions{Detail: 4})
-	g.Expect(err).To(gomega.BeNil())
-	g.Expect(len(list)).To(gomega.Equal(10))
-	g.Expect(list[0].Name).To(gomega.Equal(""))
-	g.Expect(list[0].Slice).To(gomega.BeNil())
-	g.Expect(list[0].D1).To(gomega.Equal("d-1"))
-	g.Expect(list[0].D2).To(gomega.Equal("d-2"))
-	g.Expect(list[0].D3).To(gomega.Equal("d-3"))
-	g.Expect(list[0].D4).To(gomega.Equal("d-4"))
-	// List detail level=10
-	list = []TestObject{}
-	err = DB.List(&list, ListOptions{Detail: MaxDetail})
-	g.Expect(err).To(gomega.BeNil())
-	g.Expect(len(list)).To(gomega.Equal(10))
-	g.Expect(list[0].Name).To(gomega.Equal("Elmer"))
-	g.Expect(len(list[0].Slice)).To(gomega.Equal(2))
-	g.Expect(list[0].D1).To(gomega.Equal("d-1"))
-	g.Expect(list[0].D2).To(gomega.Equal("d-2"))
-	g.Expect(list[0].D3).To(gomega.Equal("d-3"))
-	g.Expect(list[0].D4).To(gomega.Equal("d-4"))
-	// List = (single).
-	list = []TestObject{}
+	g.Expect(object.Name).To(gomega.Equal("n3"))
+	// Raw storage.
+	list := []CodecObject{}
 	err = DB.List(
 		&list,
 		ListOptions{
-			Predicate: Eq("ID", 0),
+			Detail: MaxDetail,
+			Predicate: And(
+				Gt("Size", Quantity{Milli: 4500}),
+				Eq("Level", LevelHigh)),
 		})
 	g.Expect(err).To(gomega.BeNil())
-	g.Expect(len(list)).To(gomega.Equal(1))
-	g.Expect(list[0].ID).To(gomega.Equal(0))
-	// List = (multiple).
-	list = []TestObject{}
-	err = DB.List(
-		&list,
-		ListOptions{
-			Predicate: Eq("ID", []int{2, 4}),
-		})
+	names := []string{}
+	for _, m := range list {
+		g.Expect(m.Level).To(gomega.Equal(LevelHigh))
+		names = append(names, m.Name)
+	}
+	g.Expect(names).To(gomega.Equal([]string{"n5", "n7", "n9"}))
+	// Filter.
+	md, err := Inspect(&CodecObject{})
 	g.Expect(err).To(gomega.BeNil())
-	g.Expect(len(list)).To(gomega.Equal(2))
-	g.Expect(list[0].ID).To(gomega.Equal(2))
-	g.Expect(list[1].ID).To(gomega.Equal(4))
-	// List != AND
-	list = []TestObject{}
-	err = DB.List(
-		&list,
-		ListOptions{
-			Detail: 2,
-			Predicate: And( // Even only.
-				Neq("ID", 1),
-				Neq("ID", 3),
-				Neq("ID", 5),
-				Neq("ID", 7),
-				Neq("ID", 9)),
-		})
+	p, err := Parse(`size < 2000 or level = "high" and size > 8000`, md)
 	g.Expect(err).To(gomega.BeNil())
-	g.Expect(len(list)).To(gomega.Equal(5))
-	g.Expect(list[0].ID).To(gomega.Equal(0))
-	g.Expect(list[1].ID).To(gomega.Equal(2))
-	g.Expect(list[2].ID).To(gomega.Equal(4))
-	g.Expect(list[3].ID).To(gomega.Equal(6))
-	g.Expect(list[4].ID).To(gomega.Equal(8))
-	// List OR =.
-	list = []TestObject{}
-	err = DB.List(
-		&list,
-		ListOptions{
-			Predicate: Or(
-				Eq("ID", 0),
-				Eq("ID", 6)),
-		})
+	list = []CodecObject{}
+	err = DB.List(&list, ListOptions{Detail: MaxDetail, Predicate: p})
 	g.Expect(err).To(gomega.BeNil())
-	g.Expect(len(list)).To(gomega.Equal(2))
-	g.Expect(list[0].ID).To(gomega.Equal(0))
-	g.Expect(list[1].ID).To(gomega.Equal(6))
-	// List < (lt).
-	list = []TestObject{}
-	err = DB.List(
-		&list,
-		ListOptions{
-			Predicate: Lt("ID", 2),
-		})
+	names = []string{}
+	for _, m := range list {
+		names = append(names, m.Name)
+	}
+	g.Expect(names).To(gomega.ConsistOf("n0", "n1", "n9"))
+}
+
+func TestNullable(t *testing.T) {
+	var err error
+	g := gomega.NewGomegaWithT(t)
+	DB := New(
+		"/tmp/test-nullable.db",
+		&NullObject{})
+	err = DB.Open(true)
 	g.Expect(err).To(gomega.BeNil())
-	g.Expect(len(list)).To(gomega.Equal(2))
-	g.Expect(list[0].ID).To(gomega.Equal(0))
-	g.Expect(list[1].ID).To(gomega.Equal(1))
-	// List > (gt).
-	list = []TestObject{}
-	err = DB.List(
-		&list,
-		ListOptions{
-			Predicate: Gt("ID", 7),
-		})
+	defer func() {
+		_ = DB.Close(true)
+	}()
+	schema := DB.Schema()
+	m, found := schema.Find("NullObject")
+	g.Expect(found).To(gomega.BeTrue())
+	g.Expect(m.Fields[1].Type).To(gomega.Equal(StorageInteger))
+	g.Expect(m.Fields[2].Type).To(gomega.Equal(StorageInteger))
+	g.Expect(m.Fields[3].Type).To(gomega.Equal(StorageReal))
+	g.Expect(m.Fields[4].Type).To(gomega.Equal(StorageInteger))
+	// Round trip.
+	object := &NullObject{
+		ID:    1,
+		Count: sql.NullInt64{Int64: 42, Valid: true},
+		Flag:  sql.NullBool{Bool: true, Valid: true},
+		Ratio: sql.NullFloat64{Float64: 0.5, Valid: true},
+		Score: Score{N: 7},
+		Level: LevelHigh,
+	}
+	err = DB.Insert(object)
 	g.Expect(err).To(gomega.BeNil())
-	g.Expect(len(list)).To(gomega.Equal(2))
-	g.Expect(list[0].ID).To(gomega.Equal(8))
-	g.Expect(list[1].ID).To(gomega.Equal(9))
-	// List > (gt) virtual.
-	list = []TestObject{}
-	err = DB.List(
-		&list,
-		ListOptions{
-			Predicate: Gt("RowID", N/2),
-			Detail:    MaxDetail,
-		})
+	got := &NullObject{ID: 1}
+	err = DB.Get(got)
 	g.Expect(err).To(gomega.BeNil())
-	g.Expect(len(list)).To(gomega.Equal(N / 2))
-	g.Expect(list[0].RowID).To(gomega.Equal(int64(N/2) + 1))
-	// List (Eq) Field values.
-	list = []TestObject{}
+	g.Expect(got).To(gomega.Equal(object))
+	list := []NullObject{}
 	err = DB.List(
 		&list,
 		ListOptions{
-			Predicate: Eq("RowID", Field{Name: "int8"}),
 			Detail:    MaxDetail,
+			Predicate: Gt("Count", sql.NullInt64{Int64: 41, Valid: true}),
 		})
 	g.Expect(err).To(gomega.BeNil())
-	g.Expect(len(list)).To(gomega.Equal(1))
-	g.Expect(list[0].RowID).To(gomega.Equal(int64(8)))
-	// List (nEq) Field values.
-	list = []TestObject{}
-	err = DB.List(
-		&list,
-		ListOptions{
-			Predicate: Neq("RowID", Field{Name: "int8"}),
-		})
+	g.Expect(list).To(gomega.HaveLen(1))
+	// NULL round trip.
+	null := &NullObject{ID: 3}
+	err = DB.Insert(null)
 	g.Expect(err).To(gomega.BeNil())
-	g.Expect(len(list)).To(gomega.Equal(N - 1))
-	// List (Lt) Field values.
-	list = []TestObject{}
-	err = DB.List(
-		&list,
-		ListOptions{
-			Predicate: Lt("int8", Field{Name: "int16"}),
+	got = &NullObject{ID: 3}
+	err = DB.Get(got)
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(got).To(gomega.Equal(null))
+	tx, err := DB.Begin()
+	g.Expect(err).To(gomega.BeNil())
+	result, err := tx.Execute(
+		"UPDATE NullObject SET ID = ID " +
+			"WHERE Count IS NULL AND Flag IS NULL AND Ratio IS NULL;")
+	g.Expect(err).To(gomega.BeNil())
+	n, _ := result.RowsAffected()
+	g.Expect(n).To(gomega.Equal(int64(1)))
+	err = tx.Commit()
+	g.Expect(err).To(gomega.BeNil())
+	// Float (REAL) predicates.
+	err = DB.Insert(
+		&NullObject{
+			ID:    4,
+			Ratio: sql.NullFloat64{Float64: 0.25, Valid: true},
 		})
 	g.Expect(err).To(gomega.BeNil())
-	g.Expect(len(list)).To(gomega.Equal(N))
-	// List (Gt) Field values.
-	list = []TestObject{}
+	list = []NullObject{}
 	err = DB.List(
 		&list,
 		ListOptions{
-			Predicate: Gt("RowID", Field{Name: "int8"}),
+			Detail:    MaxDetail,
+			Predicate: Gt("Ratio", sql.NullFloat64{Float64: 0.3, Valid: true}),
 		})
 	g.Expect(err).To(gomega.BeNil())
-	g.Expect(len(list)).To(gomega.Equal(2))
-	// By label.
-	list = []TestObject{}
+	g.Expect(list).To(gomega.HaveLen(1))
+	g.Expect(list[0].ID).To(gomega.Equal(1))
+	list = []NullObject{}
 	err = DB.List(
 		&list,
 		ListOptions{
-			Sort: []int{2},
-			Predicate: Or(
-				Match(Labels{"id": "v4"}),
-				Eq("ID", 8)),
+			Detail:    MaxDetail,
+			Predicate: Lt("Ratio", 0.3),
 		})
 	g.Expect(err).To(gomega.BeNil())
-	g.Expect(len(list)).To(gomega.Equal(2))
+	g.Expect(list).To(gomega.HaveLen(1))
 	g.Expect(list[0].ID).To(gomega.Equal(4))
-	g.Expect(list[1].ID).To(gomega.Equal(8))
-	// Test count all.
-	count, err := DB.Count(&TestObject{}, nil)
+	md, err := Inspect(&NullObject{})
 	g.Expect(err).To(gomega.BeNil())
-	g.Expect(count).To(gomega.Equal(int64(10)))
-	// Test count with predicate.
-	count, err = DB.Count(&TestObject{}, Gt("ID", 0))
+	p, err := Parse("ratio > 0.1 and ratio < 0.4", md)
 	g.Expect(err).To(gomega.BeNil())
-	g.Expect(count).To(gomega.Equal(int64(9)))
+	n2, err := DB.Count(&NullObject{}, p)
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(n2).To(gomega.Equal(int64(1)))
+	// Encode error.
+	err = DB.Insert(&NullObject{ID: 2, Score: Score{N: -1}})
+	g.Expect(err).ToNot(gomega.BeNil())
+	err = DB.Update(&NullObject{ID: 1, Score: Score{N: -1}})
+	g.Expect(err).ToNot(gomega.BeNil())
+	err = DB.Get(&NullObject{ID: 2})
+	g.Expect(errors.Is(err, NotFound)).To(gomega.BeTrue())
+	// Decode error.
+	tx, err = DB.Begin()
+	g.Expect(err).To(gomega.BeNil())
+	_, err = tx.Execute("UPDATE NullObject SET Level = 'none' WHERE ID = 1;")
+	g.Expect(err).To(gomega.BeNil())
+	err = tx.Commit()
+	g.Expect(err).To(gomega.BeNil())
+	err = DB.Get(&NullObject{ID: 1})
+	g.Expect(err).ToNot(gomega.BeNil())
+	// Declared storage not valid.
+	_, err = Inspect(&BadStorage{})
+	g.Expect(errors.Is(err, StorageErr)).To(gomega.BeTrue())
+	err = New("/tmp/test-bad-storage.db", &BadStorage{}).Open(true)
+	g.Expect(errors.Is(err, StorageErr)).To(gomega.BeTrue())
 }
 
-func TestFind(t *testing.T) {
+func TestCompositePk(t *testing.T) {
 	var err error
 	g := gomega.NewGomegaWithT(t)
 	DB := New(
-		"/tmp/test-iter.db",
-		&TestObject{})
+		"/tmp/test-composite.db",
+		&Zoned{},
+		&ZonedDetail{})
 	err = DB.Open(true)
 	g.Expect(err).To(gomega.BeNil())
-	N := 10
-	for i := 0; i < N; i++ {
-		object := &TestObject{
-			ID:     i,
-			Name:   "Elmer",
-			Age:    18,
-			Int8:   8,
-			Int16:  16,
-			Int32:  32,
-			Bool:   true,
-			Object: TestEncoded{Name: "json"},
-			Slice:  []string{"hello", "world"},
-			Map:    map[string]int{"A": 1, "B": 2},
-			D4:     "d-4",
-			labels: Labels{
-				"id": fmt.Sprintf("v%d", i),
-			},
-		}
-		err = DB.Insert(object)
-		g.Expect(err).To(gomega.BeNil())
-	}
-	// List all; detail level=0
-	itr, err := DB.Find(
-		&TestObject{},
-		ListOptions{})
-	g.Expect(err).To(gomega.BeNil())
-	g.Expect(itr.Len()).To(gomega.Equal(10))
-	var list []TestObject
-	for {
-		object := TestObject{}
-		if itr.NextWith(&object) {
+	defer func() {
+		_ = DB.Close(true)
+	}()
+	for _, zone := range []string{"east", "west"} {
+		for i := 0; i < 3; i++ {
+			err = DB.Insert(
+				&Zoned{
+					Zone:   zone,
+					ID:     i,
+					Name:   zone,
+					labels: Labels{"zone": zone},
+				})
 			g.Expect(err).To(gomega.BeNil())
-			list = append(list, object)
-		} else {
-			break
 		}
 	}
-	g.Expect(len(list)).To(gomega.Equal(10))
-	// List all; detail level=0
-	itr, err = DB.Find(
-		&TestObject{},
-		ListOptions{})
+	err = DB.Insert(&Zoned{Zone: "east", ID: 1})
 	g.Expect(err).To(gomega.BeNil())
-	for object, hasNext := itr.Next(); hasNext; object, hasNext = itr.Next() {
+	m := &Zoned{Zone: "west", ID: 1}
+	err = DB.Get(m)
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(m.Name).To(gomega.Equal("west"))
+	m.Name = "updated"
+	err = DB.Update(m)
+	g.Expect(err).To(gomega.BeNil())
+	m = &Zoned{Zone: "east", ID: 2}
+	err = DB.Get(m)
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(m.Name).To(gomega.Equal("east"))
+	g.Expect(ModelPk(m)).To(gomega.Equal("east/2"))
+	// Labels (replaced on update).
+	list := []Zoned{}
+	err = DB.List(
+		&list,
+		ListOptions{
+			Predicate: Match(Labels{"zone": "west"}),
+		})
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(len(list)).To(gomega.Equal(2))
+	// Cascade.
+	err = DB.Insert(&ZonedDetail{ID: 1, Parent: "west/1"})
+	g.Expect(err).To(gomega.BeNil())
+	err = DB.Insert(&ZonedDetail{ID: 2, Parent: "east/1"})
+	g.Expect(err).To(gomega.BeNil())
+	err = DB.Delete(&Zoned{Zone: "west", ID: 1})
+	g.Expect(err).To(gomega.BeNil())
+	err = DB.Get(&ZonedDetail{ID: 1})
+	g.Expect(errors.Is(err, NotFound)).To(gomega.BeTrue())
+	err = DB.Get(&ZonedDetail{ID: 2})
+	g.Expect(err).To(gomega.BeNil())
+	n, err := DB.Count(&Label{}, Eq("Parent", "west/1"))
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(n).To(gomega.Equal(int64(0)))
+	// Not valid.
+	dm, err := NewModel([]interface{}{&Zoned{}, &ZonedMust{}})
+	g.Expect(err).To(gomega.BeNil())
+	_, err = dm.DDL()
+	g.Expect(errors.Is(err, CompositePkErr)).To(gomega.BeTrue())
+	_, err = Inspect(&BadComposite{})
+	g.Expect(errors.Is(err, CompositePkErr)).To(gomega.BeTrue())
+}
+
+func TestPkGenerator(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	generate := func(m interface{}) string {
+		md, err := Inspect(m)
 		g.Expect(err).To(gomega.BeNil())
-		_, cast := object.(Model)
-		g.Expect(cast).To(gomega.BeTrue())
+		Table{}.EnsurePk(md)
+		return md.PkField().Value.String()
 	}
+	sha1 := generate(&GenObject{Name: "elmer", N: 8})
+	g.Expect(sha1).To(gomega.HaveLen(40))
+	sha256 := generate(&Sha256Object{Name: "elmer", N: 8})
+	g.Expect(sha256).To(gomega.HaveLen(64))
+	id := generate(&UuidObject{Name: "elmer", N: 8})
+	g.Expect(id).To(gomega.HaveLen(36))
+	g.Expect(generate(&UuidObject{Name: "elmer", N: 8})).To(gomega.Equal(id))
+	g.Expect(generate(&UuidObject{Name: "elmer", N: 9})).ToNot(gomega.Equal(id))
+	idNs := generate(&UuidNsObject{Name: "elmer", N: 8})
+	g.Expect(idNs).To(gomega.HaveLen(36))
+	g.Expect(idNs).ToNot(gomega.Equal(id))
+	g.Expect(generate(&ConcatObject{Name: "elmer", N: 8})).To(gomega.Equal("elmer/8"))
+	// Not valid.
+	_, err := Inspect(&BadGen{})
+	g.Expect(errors.Is(err, PkGenErr)).To(gomega.BeTrue())
 }
 
-func TestWatch(t *testing.T) {
+func TestSnapshot(t *testing.T) {
+	var err error
 	g := gomega.NewGomegaWithT(t)
-	DB := New("/tmp/test-watch.db", &TestObject{})
-	err := DB.Open(true)
+	DB := New(
+		"/tmp/test-snapshot.db",
+		&PlainObject{})
+	err = DB.Open(true)
+	g.Expect(err).To(gomega.BeNil())
 	defer func() {
-		_ = DB.Close(false)
+		_ = DB.Close(true)
 	}()
+	err = DB.Insert(&PlainObject{ID: 0})
 	g.Expect(err).To(gomega.BeNil())
-	// Handler A
-	handlerA := &TestHandler{
-		options: WatchOptions{Snapshot: true},
-		name:    "A",
-	}
-	watchA, err := DB.Watch(&TestObject{}, handlerA)
-	g.Expect(err).To(gomega.BeNil())
-	g.Expect(watchA).ToNot(gomega.BeNil())
-	g.Expect(watchA.Alive()).To(gomega.BeTrue())
-	N := 10
-	// Insert
-	for i := 0; i < N; i++ {
-		object := &TestObject{
-			ID:   i,
-			Name: "Elmer",
-		}
-		err = DB.Insert(object)
-		g.Expect(err).To(gomega.BeNil())
-	}
-	// Handler B
-	handlerB := &TestHandler{
-		options: WatchOptions{Snapshot: true},
-		name:    "B",
-	}
-	watchB, err := DB.Watch(&TestObject{}, handlerB)
-	g.Expect(err).To(gomega.BeNil())
-	g.Expect(watchB).ToNot(gomega.BeNil())
-	// Update
-	for i := 0; i < N; i++ {
-		object := &TestObject{ID: i}
-		_ = DB.Get(object)
-		object.Name = "Fudd"
-		object.Age = 18
-		object.Int8 = 8
-		object.Int16 = 16
-		object.Int32 = 32
-		object.Bool = true
-		object.Object = TestEncoded{Name: "json"}
-		object.Slice = []string{"hello", "world"}
-		object.Map = map[string]int{"A": 1, "B": 2}
-		object.D4 = "d-4"
-		object.labels = Labels{
-			"id": fmt.Sprintf("v%d", i),
-		}
-		err = DB.Update(object)
-		g.Expect(err).To(gomega.BeNil())
-	}
-	// Handler C
-	handlerC := &TestHandler{
-		options: WatchOptions{Snapshot: true},
-		name:    "C",
-	}
-	watchC, err := DB.Watch(&TestObject{}, handlerC)
-	g.Expect(err).To(gomega.BeNil())
-	g.Expect(watchC).ToNot(gomega.BeNil())
-	// Handler D (no snapshot)
-	handlerD := &TestHandler{name: "D"}
-	watchD, err := DB.Watch(&TestObject{}, handlerD)
-	g.Expect(err).To(gomega.BeNil())
-	g.Expect(watchC).ToNot(gomega.BeNil())
-	// Delete
-	for i := 0; i < N; i++ {
-		object := &TestObject{
-			ID: i,
-		}
-		err = DB.Delete(object)
+	err = DB.Snapshot(func(r Reader) (err error) {
+		n, err := r.Count(&PlainObject{}, nil)
 		g.Expect(err).To(gomega.BeNil())
-	}
-	for i := 0; i < N; i++ {
-		time.Sleep(time.Millisecond * 10)
-		if len(handlerA.created) != N ||
-			len(handlerA.updated) != N ||
-			len(handlerA.created) != N ||
-			len(handlerB.created) != N ||
-			len(handlerB.updated) != N ||
-			len(handlerB.created) != N ||
-			len(handlerC.created) != N ||
-			len(handlerC.created) != N {
-			continue
-		} else {
-			break
-		}
-	}
-	g.Expect(handlerA.started).To(gomega.BeTrue())
-	g.Expect(handlerB.started).To(gomega.BeTrue())
-	g.Expect(handlerC.started).To(gomega.BeTrue())
-	g.Expect(handlerD.started).To(gomega.BeTrue())
-	g.Expect(handlerA.parity).To(gomega.BeTrue())
-	g.Expect(handlerB.parity).To(gomega.BeTrue())
-	g.Expect(handlerC.parity).To(gomega.BeTrue())
-	g.Expect(handlerD.parity).To(gomega.BeTrue())
-	//
-	// The scenario is:
-	// 1. handler A created
-	// 2. (N) models created. handler A should get (N) CREATE events.
-	// 3. handler B created.  handler B should get (N) CREATE events.
-	// 4. (N) models updated. handler A & B should get (N) UPDATE events.
-	// 5. Handler C created.  handler C should get (N) CREATE events.
-	// 6. (N) models deleted. handler A,B,C should get (N) DELETE events.
-	all := []TestEvent{}
-	created := []TestEvent{}
-	updated := []TestEvent{}
-	deleted := []TestEvent{}
-	for _, action := range []uint8{Created, Updated, Deleted} {
-		for i := 0; i < N; i++ {
-			switch action {
-			case Created:
-				created = append(
-					created,
-					TestEvent{
-						action: action,
-						model:  &TestObject{ID: i},
-					})
-			case Updated:
-				updated = append(
-					updated,
-					TestEvent{
-						action: action,
-						model:  &TestObject{ID: i},
-					})
-			case Deleted:
-				deleted = append(
-					deleted,
-					TestEvent{
-						action: action,
-						model:  &TestObject{ID: i},
-					})
-			}
-			all = append(
-				all,
-				TestEvent{
-					action: action,
-					model:  &TestObject{ID: i},
-				})
-		}
-	}
-	g.Expect(func() (eq bool) {
-		h := handlerA
-		if len(all) != len(h.all) {
-			return
-		}
-		for i := 0; i < len(all); i++ {
-			if h.all[i].action == Updated {
-				if h.all[i].updated.Rev != h.all[i].model.Rev+1 ||
-					h.all[i].updated.Name != "Fudd" {
+		g.Expect(n).To(gomega.Equal(int64(1)))
+		// Committed after the snapshot.
+		err = DB.With(func(tx *Tx) (err error) {
+			for i := 1; i < 5; i++ {
+				err = tx.Insert(&PlainObject{ID: i})
+				if err != nil {
 					return
 				}
 			}
-			if all[i].action != h.all[i].action ||
-				all[i].model.ID != h.all[i].model.ID {
-				return
-			}
-		}
-		return true
-	}()).To(gomega.BeTrue())
-	g.Expect(func() (eq bool) {
-		h := handlerB
-		if len(all) != len(h.all) {
 			return
-		}
-		for i := 0; i < len(all); i++ {
-			if all[i].action != h.all[i].action ||
-				all[i].model.ID != h.all[i].model.ID {
-				return
+		})
+		g.Expect(err).To(gomega.BeNil())
+		n, err = DB.Count(&PlainObject{}, nil)
+		g.Expect(err).To(gomega.BeNil())
+		g.Expect(n).To(gomega.Equal(int64(5)))
+		list := []PlainObject{}
+		err = r.List(&list, ListOptions{})
+		g.Expect(err).To(gomega.BeNil())
+		g.Expect(len(list)).To(gomega.Equal(1))
+		err = r.Get(&PlainObject{ID: 1})
+		g.Expect(errors.Is(err, NotFound)).To(gomega.BeTrue())
+		cursor, err := r.Stream(&PlainObject{}, ListOptions{})
+		g.Expect(err).To(gomega.BeNil())
+		defer cursor.Close()
+		n = 0
+		for {
+			_, hasNext := cursor.Next()
+			if !hasNext {
+				break
 			}
+			n++
 		}
-		return true
-	}()).To(gomega.BeTrue())
-	all = []TestEvent{}
-	for _, action := range []uint8{Created, Deleted} {
-		for i := 0; i < N; i++ {
-			all = append(
-				all,
-				TestEvent{
-					action: action,
-					model:  &TestObject{ID: i},
-				})
-		}
+		g.Expect(n).To(gomega.Equal(int64(1)))
+		return
+	})
+	g.Expect(err).To(gomega.BeNil())
+	// Error returned.
+	err = DB.Snapshot(func(r Reader) error {
+		return r.Get(&PlainObject{ID: 100})
+	})
+	g.Expect(errors.Is(err, NotFound)).To(gomega.BeTrue())
+}
+
+// Used for metrics testing.
+type RecordedMetrics struct {
+	StockMetrics
+	mutex     sync.Mutex
+	operation map[string]int64
+	slow      int
+	waited    int
+	committed int
+	purged    int
+	tasks     map[string]int
+	held      int
+	aborted   int
+}
+
+func (m *RecordedMetrics) Held(role string, age time.Duration, aborted bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if aborted {
+		m.aborted++
+	} else {
+		m.held++
 	}
-	g.Expect(func() (eq bool) {
-		h := handlerC
-		if len(all) != len(h.all) {
-			return
-		}
-		for i := 0; i < len(all); i++ {
-			if all[i].action != h.all[i].action ||
-				all[i].model.ID != h.all[i].model.ID {
-				return
-			}
-		}
-		return true
-	}()).To(gomega.BeTrue())
-	g.Expect(func() (eq bool) {
-		h := handlerD
-		if len(deleted) != len(h.deleted) {
-			return
-		}
-		for i := 0; i < len(deleted); i++ {
-			if deleted[i].model.ID != h.deleted[i] {
-				return
-			}
-		}
-		return true
-	}()).To(gomega.BeTrue())
+}
 
-	//
-	// Test watch end.
-	watchA.End()
-	watchB.End()
-	watchC.End()
-	watchD.End()
-	ended := false
-	for i := 0; i < 10; i++ {
-		if watchA.started || watchB.started || watchC.started || watchD.started {
-			time.Sleep(50 * time.Millisecond)
-		} else {
-			ended = true
-			break
-		}
+func (m *RecordedMetrics) Maintained(task string, d time.Duration, succeeded bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if succeeded {
+		m.tasks[task]++
 	}
-	g.Expect(len(watchA.journal.watches)).To(gomega.Equal(0))
-	g.Expect(ended).To(gomega.BeTrue())
-	g.Expect(handlerA.done).To(gomega.BeTrue())
-	g.Expect(handlerB.done).To(gomega.BeTrue())
-	g.Expect(handlerC.done).To(gomega.BeTrue())
-	g.Expect(handlerD.done).To(gomega.BeTrue())
 }
 
-func TestCloseDB(t *testing.T) {
+func (m *RecordedMetrics) Purged(kind string, n int) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.purged += n
+}
+
+func (m *RecordedMetrics) Operation(op, kind string, d time.Duration, rows int64) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.operation[op+"|"+kind] += rows
+}
+
+func (m *RecordedMetrics) Slow(string, string, time.Duration) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.slow++
+}
+
+func (m *RecordedMetrics) Waited(string, time.Duration) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.waited++
+}
+
+func (m *RecordedMetrics) TxEnded(committed bool, d time.Duration) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if committed {
+		m.committed++
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	var err error
 	g := gomega.NewGomegaWithT(t)
-	DB := New("/tmp/test-close-db.db", &TestObject{})
-	err := DB.Open(true)
+	metrics := &RecordedMetrics{operation: map[string]int64{}}
+	Metrics = metrics
+	SlowQueryThreshold = time.Nanosecond
 	defer func() {
-		_ = DB.Close(false)
+		Metrics = &StockMetrics{}
+		SlowQueryThreshold = 0
+	}()
+	DB := New(
+		"/tmp/test-metrics.db",
+		&PlainObject{})
+	err = DB.Open(true)
+	defer func() {
+		_ = DB.Close(true)
 	}()
 	g.Expect(err).To(gomega.BeNil())
-	handler := &TestHandler{
-		options: WatchOptions{Snapshot: true},
-		name:    "A",
-	}
-	watch, err := DB.Watch(&TestObject{}, handler)
-	for i := 0; i < 10; i++ {
-		if !watch.started {
-			time.Sleep(50 * time.Millisecond)
-		} else {
-			break
-		}
-	}
-	g.Expect(handler.started).To(gomega.BeTrue())
-	g.Expect(handler.done).To(gomega.BeFalse())
-	_ = DB.Close(true)
-	for _, session := range DB.(*Client).pool.sessions {
-		g.Expect(session.closed).To(gomega.BeTrue())
+	for i := 0; i < 3; i++ {
+		err = DB.Insert(&PlainObject{ID: i})
+		g.Expect(err).To(gomega.BeNil())
 	}
-	for i := 0; i < 100; i++ {
-		if !watch.done {
-			time.Sleep(50 * time.Millisecond)
-		} else {
+	list := []PlainObject{}
+	err = DB.List(&list, ListOptions{})
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(metrics.operation["insert|PlainObject"]).To(gomega.Equal(int64(3)))
+	g.Expect(metrics.operation["list|PlainObject"]).To(gomega.Equal(int64(3)))
+	// Counted (reconciled) on open.
+	g.Expect(metrics.operation["count|PlainObject"]).To(gomega.Equal(int64(1)))
+	g.Expect(metrics.slow).To(gomega.Equal(5))
+	g.Expect(metrics.committed).To(gomega.Equal(3))
+	g.Expect(metrics.waited > 4).To(gomega.BeTrue())
+	// Stream (consumer time not included).
+	SlowQueryThreshold = time.Millisecond * 50
+	cursor, err := DB.Stream(&PlainObject{}, ListOptions{})
+	g.Expect(err).To(gomega.BeNil())
+	for {
+		_, hasNext := cursor.Next()
+		if !hasNext {
 			break
 		}
+		time.Sleep(time.Millisecond * 20)
 	}
-
-	g.Expect(handler.done).To(gomega.BeTrue())
+	cursor.Close()
+	g.Expect(cursor.Err()).To(gomega.BeNil())
+	g.Expect(metrics.operation["stream|PlainObject"]).To(gomega.Equal(int64(3)))
+	g.Expect(metrics.slow).To(gomega.Equal(5))
+	// Prometheus.
+	registry := prometheus.NewRegistry()
+	pm := NewPrometheusMetrics(registry)
+	pm.Operation(OpGet, "PlainObject", time.Millisecond, 1)
+	pm.TxEnded(true, time.Millisecond)
+	families, err := registry.Gather()
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(len(families)).To(gomega.Equal(3))
+	g.Expect(NewPrometheusMetrics(registry)).ToNot(gomega.BeNil())
 }
 
-func TestMutatingWatch(t *testing.T) {
+func TestExportImport(t *testing.T) {
+	var err error
 	g := gomega.NewGomegaWithT(t)
-	DB := New("/tmp/test-mutating-watch.db", &TestObject{})
-	err := DB.Open(true)
-
+	LabelCounters = true
+	defer func() {
+		LabelCounters = false
+	}()
+	models := []interface{}{
+		&DetailA{},
+		&PlainObject{},
+		&TestObject{},
+	}
+	DB := New("/tmp/test-export.db", models...)
+	err = DB.Open(true)
+	defer func() {
+		_ = DB.Close(true)
+	}()
 	g.Expect(err).To(gomega.BeNil())
-
-	// Handler A
-	handlerA := &MutatingHandler{
-		options: WatchOptions{Snapshot: true},
-		name:    "A",
-		DB:      DB,
+	for i := 0; i < 3; i++ {
+		err = DB.Insert(&PlainObject{ID: i, Name: "Elmer"})
+		g.Expect(err).To(gomega.BeNil())
+		err = DB.Insert(&DetailA{PK: i, FK: i})
+		g.Expect(err).To(gomega.BeNil())
+		err = DB.Insert(
+			&TestObject{
+				ID:     i,
+				Name:   "Elmer",
+				Slice:  []string{"hello"},
+				labels: Labels{"id": fmt.Sprintf("v%d", i)},
+			})
+		g.Expect(err).To(gomega.BeNil())
 	}
-	watchA, err := DB.Watch(&TestObject{}, handlerA)
+	// Export (all).
+	bfr := &bytes.Buffer{}
+	err = DB.Export(bfr)
 	g.Expect(err).To(gomega.BeNil())
-	g.Expect(watchA).ToNot(gomega.BeNil())
-	// Handler B
-	handlerB := &MutatingHandler{
-		options: WatchOptions{Snapshot: true},
-		name:    "B",
-		DB:      DB,
+	kinds := []string{}
+	exported := map[string]int{}
+	decoder := json.NewDecoder(bytes.NewReader(bfr.Bytes()))
+	for decoder.More() {
+		line := Exported{}
+		err = decoder.Decode(&line)
+		g.Expect(err).To(gomega.BeNil())
+		kinds = append(kinds, line.Kind)
+		exported[line.Kind]++
+		if line.Kind == "TestObject" {
+			g.Expect(line.Labels).To(gomega.HaveLen(1))
+		} else {
+			g.Expect(line.Labels).To(gomega.BeEmpty())
+		}
 	}
-	watchB, err := DB.Watch(&TestObject{}, handlerB)
+	g.Expect(exported).To(
+		gomega.Equal(
+			map[string]int{
+				"PlainObject": 3,
+				"DetailA":     3,
+				"TestObject":  3,
+			}))
+	g.Expect(strings.Join(kinds, ",")).To(
+		gomega.ContainSubstring("PlainObject,PlainObject,PlainObject,DetailA"))
+	// Export (kind).
+	bfr2 := &bytes.Buffer{}
+	err = DB.Export(bfr2, "plainObject")
 	g.Expect(err).To(gomega.BeNil())
-	g.Expect(watchB).ToNot(gomega.BeNil())
-	N := 10
-	// Insert
-	for i := 0; i < N; i++ {
-		object := &TestObject{
-			ID:   i,
-			Name: "Elmer",
-		}
-		err = DB.Insert(object)
+	g.Expect(strings.Count(bfr2.String(), "\n")).To(gomega.Equal(3))
+	err = DB.Export(bfr2, "Unknown")
+	g.Expect(errors.Is(err, KindErr)).To(gomega.BeTrue())
+	// Import.
+	DB2 := New("/tmp/test-import.db", models...)
+	err = DB2.Open(true)
+	defer func() {
+		_ = DB2.Close(true)
+	}()
+	g.Expect(err).To(gomega.BeNil())
+	handler := &TestHandler{}
+	w, err := DB2.Watch(&TestObject{}, handler)
+	g.Expect(err).To(gomega.BeNil())
+	err = DB2.Import(bfr)
+	g.Expect(err).To(gomega.BeNil())
+	for _, m := range models {
+		n, err := DB2.Count(m.(Model), nil)
 		g.Expect(err).To(gomega.BeNil())
+		g.Expect(n).To(gomega.Equal(int64(3)))
+		g.Expect(DB2.Tally(m.(Model))).To(gomega.Equal(int64(3)))
 	}
-
-	for {
-		time.Sleep(time.Millisecond * 10)
-		if len(handlerA.updated) == N*2 {
+	n, err := DB2.Count(&Label{}, nil)
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(n).To(gomega.Equal(int64(3)))
+	for i := 0; i < 3; i++ {
+		value := fmt.Sprintf("v%d", i)
+		g.Expect(DB2.TallyLabel(&TestObject{}, "id", value)).To(gomega.Equal(int64(1)))
+	}
+	list := []TestObject{}
+	err = DB2.List(
+		&list,
+		ListOptions{
+			Detail:    MaxDetail,
+			Predicate: Match(Labels{"id": "v1"}),
+		})
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(len(list)).To(gomega.Equal(1))
+	g.Expect(list[0].Slice).To(gomega.Equal([]string{"hello"}))
+	for i := 0; i < 10; i++ {
+		if len(handler.snapshot().created) == 3 {
 			break
 		}
+		time.Sleep(time.Millisecond * 10)
 	}
+	g.Expect(len(handler.snapshot().created)).To(gomega.Equal(3))
+	w.End()
 }
 
-func TestExecute(t *testing.T) {
+func TestErrors(t *testing.T) {
+	var err error
 	g := gomega.NewGomegaWithT(t)
-
-	type Person struct {
-		ID   int    `sql:"pk"`
-		Name string `sql:""`
-	}
-	DB := New("/tmp/test-execute.db", &Person{})
-	err := DB.Open(true)
+	DB := New(
+		"/tmp/test-errors.db",
+		&PlainObject{},
+		&DetailA{},
+		&UniqueObject{})
+	err = DB.Open(true)
 	defer func() {
-		_ = DB.Close(false)
+		_ = DB.Close(true)
 	}()
-
 	g.Expect(err).To(gomega.BeNil())
-
-	result, err := DB.Execute(
-		"INSERT INTO Person (id, name) values (0, 'john');")
+	// PK conflict (updated).
+	err = DB.Insert(&UniqueObject{ID: 1, Name: "A"})
 	g.Expect(err).To(gomega.BeNil())
-	g.Expect(result.RowsAffected()).To(gomega.Equal(int64(1)))
+	err = DB.Insert(&UniqueObject{ID: 1, Name: "B"})
+	g.Expect(err).To(gomega.BeNil())
+	// Unique conflict (not updated).
+	err = DB.Insert(&UniqueObject{ID: 2, Name: "B"})
+	g.Expect(errors.Is(err, ConflictErr)).To(gomega.BeTrue())
+	dbErr := &DbErr{}
+	g.Expect(errors.As(err, &dbErr)).To(gomega.BeTrue())
+	g.Expect(dbErr.Kind).To(gomega.Equal("UniqueObject"))
+	g.Expect(dbErr.Fields).To(gomega.Equal([]string{"Name"}))
+	err = DB.Get(&UniqueObject{ID: 2})
+	g.Expect(errors.Is(err, NotFound)).To(gomega.BeTrue())
+	// FK violation.
+	err = DB.Insert(&DetailA{PK: 1, FK: 1})
+	g.Expect(errors.Is(err, FkViolationErr)).To(gomega.BeTrue())
+	g.Expect(errors.Is(err, ConflictErr)).To(gomega.BeFalse())
+	g.Expect(errors.As(err, &dbErr)).To(gomega.BeTrue())
+	g.Expect(dbErr.Kind).To(gomega.Equal("DetailA"))
+	g.Expect(dbErr.Fields).To(gomega.BeEmpty())
+	// Not mapped.
+	err = DB.Get(&UniqueObject{ID: 3})
+	g.Expect(errors.Is(err, NotFound)).To(gomega.BeTrue())
+	g.Expect(errors.As(err, &dbErr)).To(gomega.BeFalse())
 }
 
-func TestSession(t *testing.T) {
+func TestTransactions(t *testing.T) {
 	g := gomega.NewGomegaWithT(t)
-	DB := New("/tmp/test-session.db", &TestObject{})
-	DB.Open(true)
+	DB := New(
+		"/tmp/test-transactions.db",
+		&TestObject{})
+	err := DB.Open(true)
 	defer func() {
-		_ = DB.Close(false)
+		_ = DB.Close(true)
 	}()
-
-	pool := DB.(*Client).pool
-
-	w := pool.Writer()
-	g.Expect(w.id).To(gomega.Equal(0))
-	for n := 1; n < 11; n++ {
-		r := pool.Reader()
-		g.Expect(r.id).To(gomega.Equal(n))
+	g.Expect(err).To(gomega.BeNil())
+	for i := 0; i < 10; i++ {
+		// Begin
+		tx, err := DB.Begin()
+		defer tx.End()
+		g.Expect(err).To(gomega.BeNil())
+		object := &TestObject{
+			ID:   i,
+			Name: "Elmer",
+		}
+		err = tx.Insert(object)
+		g.Expect(err).To(gomega.BeNil())
+		// Get (not found)
+		object = &TestObject{ID: object.ID}
+		err = DB.Get(object)
+		g.Expect(errors.Is(err, NotFound)).To(gomega.BeTrue())
+		tx.Commit()
+		// Get (found)
+		object = &TestObject{ID: object.ID}
+		err = DB.Get(object)
+		g.Expect(err).To(gomega.BeNil())
 	}
 }
 
-// Remove leading __ to enable.
-func __TestDbLocked(t *testing.T) {
+func TestWithTxSucceeded(t *testing.T) {
 	g := gomega.NewGomegaWithT(t)
-	DB := New("/tmp/test-db-locked.db", &TestObject{}, &PlainObject{})
+	DB := New(
+		"/tmp/test-withtx-succeeded.db",
+		&TestObject{})
 	err := DB.Open(true)
 	defer func() {
-		_ = DB.Close(false)
+		_ = DB.Close(true)
 	}()
-	errChan := make(chan error)
-	endChan := make(chan int)
-	go func() {
-		tx, _ := DB.Begin()
-		defer func() {
-			errChan <- err
-			close(errChan)
-			_ = tx.End()
-		}()
-		for i := 0; i < 20000; i++ {
+	g.Expect(err).To(gomega.BeNil())
+	labels := []string{"A", "B"}
+	n := 10
+	//
+	// Insert in TX.
+	insert := func(tx *Tx) (err error) {
+		g.Expect(tx.labels).To(gomega.Equal(labels))
+		for i := 0; i < n; i++ {
 			object := &TestObject{
 				ID:   i,
 				Name: "Elmer",
 			}
 			err = tx.Insert(object)
-			errChan <- err
-			if err != nil {
-				return
-			}
-		}
-		err = tx.Commit()
-	}()
-	go func() {
-		defer close(endChan)
-		n := int64(0)
-		for err = range errChan {
-			g.Expect(err).To(gomega.BeNil())
-			n, err = DB.Count(&TestObject{}, nil)
 			g.Expect(err).To(gomega.BeNil())
+			object = &TestObject{ID: object.ID}
 		}
-		fmt.Printf("Count:%d", n)
-	}()
+		return
+	}
+	//
+	// Test committed.
+	err = DB.With(insert, labels...)
+	for i := 0; i < n; i++ {
+		object := &TestObject{ID: i}
+		err = DB.Get(object)
+		g.Expect(err).To(gomega.BeNil())
+	}
+}
 
-	for _ = range endChan {
+func TestWithTxFailed(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	DB := New(
+		"/tmp/test-withtx-failed.db",
+		&TestObject{})
+	err := DB.Open(true)
+	defer func() {
+		_ = DB.Close(true)
+	}()
+	g.Expect(err).To(gomega.BeNil())
+	//
+	// Insert in TX with duplicate key error.
+	fakeErr := liberr.New("Faked")
+	insert := func(tx *Tx) (err error) {
+		object := &TestObject{}
+		err = tx.Insert(object)
+		g.Expect(err).To(gomega.BeNil())
+		err = fakeErr
+		return
 	}
+	//
+	// Test not committed.
+	err = DB.With(insert)
+	g.Expect(errors.Is(err, fakeErr)).To(gomega.BeTrue())
+	n, err := DB.Count(&TestObject{}, nil)
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(n).To(gomega.Equal(int64(0)))
 }
 
-// Remove leading __ to enable.
-func __TestConcurrency(t *testing.T) {
+func TestList(t *testing.T) {
 	var err error
-
-	DB := New("/tmp/test-concurrency.db", &TestObject{})
-	DB.Open(true)
+	g := gomega.NewGomegaWithT(t)
+	DB := New(
+		"/tmp/test-list.db",
+		&TestObject{})
+	err = DB.Open(true)
 	defer func() {
-		_ = DB.Close(false)
+		_ = DB.Close(true)
 	}()
-
-	N := 1000
-
-	direct := func(done chan int) {
-		for i := 0; i < N; i++ {
-			m := &TestObject{
-				ID:   i,
-				Name: "direct",
-			}
-			err := DB.Insert(m)
-			if err != nil {
-				panic(err)
-			}
-			fmt.Printf("direct|%d\n", i)
-			time.Sleep(time.Millisecond * 10)
+	g.Expect(err).To(gomega.BeNil())
+	N := 10
+	for i := 0; i < N; i++ {
+		object := &TestObject{
+			ID:     i,
+			Name:   "Elmer",
+			Age:    18,
+			Int8:   8,
+			Int16:  16,
+			Int32:  32,
+			Bool:   true,
+			Object: TestEncoded{Name: "json"},
+			Slice:  []string{"hello", "world"},
+			Map:    map[string]int{"A": 1, "B": 2},
+			D1:     "d-1",
+			D2:     "d-2",
+			D3:     "d-3",
+			D4:     "d-4",
+			labels: Labels{
+				"id": fmt.Sprintf("v%d", i),
+				"n":  fmt.Sprintf("%d", i),
+			},
 		}
-		done <- 0
-	}
-	read := func(done chan int) {
-		time.Sleep(time.Second)
-		for i := 0; i < N; i++ {
-			m := &TestObject{
-				ID:   i,
-				Name: "direct",
-			}
-			go func() {
-				err := DB.Get(m)
-				if err != nil {
-					if errors.Is(err, NotFound) {
-						fmt.Printf("read|%d _____%s\n", i, err)
-					} else {
-						panic(err)
-					}
-				}
-				fmt.Printf("read|%d\n", i)
-			}()
-			time.Sleep(time.Millisecond * 100)
+		if i%2 == 0 {
+			object.labels["even"] = ""
 		}
-		done <- 0
-	}
+		err = DB.Insert(object)
+		g.Expect(err).To(gomega.BeNil())
+	}
+	// List detail level=0
+	list := []TestObject{}
+	err = DB.List(&list, ListOptions{})
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(len(list)).To(gomega.Equal(10))
+	g.Expect(list[0].Name).To(gomega.Equal(""))
+	g.Expect(list[0].Slice).To(gomega.BeNil())
+	g.Expect(list[0].D1).To(gomega.Equal(""))
+	g.Expect(list[0].D2).To(gomega.Equal(""))
+	g.Expect(list[0].D3).To(gomega.Equal(""))
+	g.Expect(list[0].D4).To(gomega.Equal(""))
+	// List detail level=1
+	list = []TestObject{}
+	err = DB.List(&list, ListOptions{Detail: 1})
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(len(list)).To(gomega.Equal(10))
+	g.Expect(list[0].Name).To(gomega.Equal(""))
+	g.Expect(list[0].Slice).To(gomega.BeNil())
+	g.Expect(list[0].D1).To(gomega.Equal("d-1"))
+	g.Expect(list[0].D2).To(gomega.Equal(""))
+	g.Expect(list[0].D3).To(gomega.Equal(""))
+	g.Expect(list[0].D4).To(gomega.Equal(""))
+	// List detail level=2
+	list = []TestObject{}
+	err = DB.List(&list, ListOptions{Detail: 2})
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(len(list)).To(gomega.Equal(10))
+	g.Expect(list[0].Name).To(gomega.Equal(""))
+	g.Expect(list[0].Slice).To(gomega.BeNil())
+	g.Expect(list[0].D1).To(gomega.Equal("d-1"))
+	g.Expect(list[0].D2).To(gomega.Equal("d-2"))
+	g.Expect(list[0].D3).To(gomega.Equal(""))
+	g.Expect(list[0].D4).To(gomega.Equal(""))
+	// List detail level=3
+	list = []TestObject{}
+	err = DB.List(&list, ListOptions{Detail: 3})
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(len(list)).To(gomega.Equal(10))
+	g.Expect(list[0].Name).To(gomega.Equal(""))
+	g.Expect(list[0].Slice).To(gomega.BeNil())
+	g.Expect(list[0].D1).To(gomega.Equal("d-1"))
+	g.Expect(list[0].D2).To(gomega.Equal("d-2"))
+	g.Expect(list[0].D3).To(gomega.Equal("d-3"))
+	g.Expect(list[0].D4).To(gomega.Equal(""))
+	// List detail level=4
+	list = []TestObject{}
+	err = DB.List(&list, ListOptions{Detail: 4})
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(len(list)).To(gomega.Equal(10))
+	g.Expect(list[0].Name).To(gomega.Equal(""))
+	g.Expect(list[0].Slice).To(gomega.BeNil())
+	g.Expect(list[0].D1).To(gomega.Equal("d-1"))
+	g.Expect(list[0].D2).To(gomega.Equal("d-2"))
+	g.Expect(list[0].D3).To(gomega.Equal("d-3"))
+	g.Expect(list[0].D4).To(gomega.Equal("d-4"))
+	// List detail level=10
+	list = []TestObject{}
+	err = DB.List(&list, ListOptions{Detail: MaxDetail})
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(len(list)).To(gomega.Equal(10))
+	g.Expect(list[0].Name).To(gomega.Equal("Elmer"))
+	g.Expect(len(list[0].Slice)).To(gomega.Equal(2))
+	g.Expect(list[0].D1).To(gomega.Equal("d-1"))
+	g.Expect(list[0].D2).To(gomega.Equal("d-2"))
+	g.Expect(list[0].D3).To(gomega.Equal("d-3"))
+	g.Expect(list[0].D4).To(gomega.Equal("d-4"))
+	// List = (single).
+	list = []TestObject{}
+	err = DB.List(
+		&list,
+		ListOptions{
+			Predicate: Eq("ID", 0),
+		})
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(len(list)).To(gomega.Equal(1))
+	g.Expect(list[0].ID).To(gomega.Equal(0))
+	// List = (multiple).
+	list = []TestObject{}
+	err = DB.List(
+		&list,
+		ListOptions{
+			Predicate: Eq("ID", []int{2, 4}),
+		})
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(len(list)).To(gomega.Equal(2))
+	g.Expect(list[0].ID).To(gomega.Equal(2))
+	g.Expect(list[1].ID).To(gomega.Equal(4))
+	// List != AND
+	list = []TestObject{}
+	err = DB.List(
+		&list,
+		ListOptions{
+			Detail: 2,
+			Predicate: And( // Even only.
+				Neq("ID", 1),
+				Neq("ID", 3),
+				Neq("ID", 5),
+				Neq("ID", 7),
+				Neq("ID", 9)),
+		})
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(len(list)).To(gomega.Equal(5))
+	g.Expect(list[0].ID).To(gomega.Equal(0))
+	g.Expect(list[1].ID).To(gomega.Equal(2))
+	g.Expect(list[2].ID).To(gomega.Equal(4))
+	g.Expect(list[3].ID).To(gomega.Equal(6))
+	g.Expect(list[4].ID).To(gomega.Equal(8))
+	// List OR =.
+	list = []TestObject{}
+	err = DB.List(
+		&list,
+		ListOptions{
+			Predicate: Or(
+				Eq("ID", 0),
+				Eq("ID", 6)),
+		})
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(len(list)).To(gomega.Equal(2))
+	g.Expect(list[0].ID).To(gomega.Equal(0))
+	g.Expect(list[1].ID).To(gomega.Equal(6))
+	// List < (lt).
+	list = []TestObject{}
+	err = DB.List(
+		&list,
+		ListOptions{
+			Predicate: Lt("ID", 2),
+		})
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(len(list)).To(gomega.Equal(2))
+	g.Expect(list[0].ID).To(gomega.Equal(0))
+	g.Expect(list[1].ID).To(gomega.Equal(1))
+	// List > (gt).
+	list = []TestObject{}
+	err = DB.List(
+		&list,
+		ListOptions{
+			Predicate: Gt("ID", 7),
+		})
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(len(list)).To(gomega.Equal(2))
+	g.Expect(list[0].ID).To(gomega.Equal(8))
+	g.Expect(list[1].ID).To(gomega.Equal(9))
+	// List > (gt) virtual.
+	list = []TestObject{}
+	err = DB.List(
+		&list,
+		ListOptions{
+			Predicate: Gt("RowID", N/2),
+			Detail:    MaxDetail,
+		})
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(len(list)).To(gomega.Equal(N / 2))
+	g.Expect(list[0].RowID).To(gomega.Equal(int64(N/2) + 1))
+	// List (Eq) Field values.
+	list = []TestObject{}
+	err = DB.List(
+		&list,
+		ListOptions{
+			Predicate: Eq("RowID", Field{Name: "int8"}),
+			Detail:    MaxDetail,
+		})
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(len(list)).To(gomega.Equal(1))
+	g.Expect(list[0].RowID).To(gomega.Equal(int64(8)))
+	// List (nEq) Field values.
+	list = []TestObject{}
+	err = DB.List(
+		&list,
+		ListOptions{
+			Predicate: Neq("RowID", Field{Name: "int8"}),
+		})
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(len(list)).To(gomega.Equal(N - 1))
+	// List (Lt) Field values.
+	list = []TestObject{}
+	err = DB.List(
+		&list,
+		ListOptions{
+			Predicate: Lt("int8", Field{Name: "int16"}),
+		})
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(len(list)).To(gomega.Equal(N))
+	// List (Gt) Field values.
+	list = []TestObject{}
+	err = DB.List(
+		&list,
+		ListOptions{
+			Predicate: Gt("RowID", Field{Name: "int8"}),
+		})
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(len(list)).To(gomega.Equal(2))
+	// By label.
+	list = []TestObject{}
+	err = DB.List(
+		&list,
+		ListOptions{
+			Sort: []int{2},
+			Predicate: Or(
+				Match(Labels{"id": "v4"}),
+				Eq("ID", 8)),
+		})
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(len(list)).To(gomega.Equal(2))
+	g.Expect(list[0].ID).To(gomega.Equal(4))
+	g.Expect(list[1].ID).To(gomega.Equal(8))
+	// By label selector (in).
+	selector, err := ParseSelector("id in (v2,v4,v6)")
+	g.Expect(err).To(gomega.BeNil())
+	list = []TestObject{}
+	err = DB.List(&list, ListOptions{Predicate: selector})
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(len(list)).To(gomega.Equal(3))
+	g.Expect(list[0].ID).To(gomega.Equal(2))
+	g.Expect(list[1].ID).To(gomega.Equal(4))
+	g.Expect(list[2].ID).To(gomega.Equal(6))
+	// By label selector (notin,!=).
+	selector, err = ParseSelector("id notin (v2,v4),id!=v6")
+	g.Expect(err).To(gomega.BeNil())
+	list = []TestObject{}
+	err = DB.List(&list, ListOptions{Predicate: selector})
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(len(list)).To(gomega.Equal(N - 3))
+	// By label selector (exists,!exists).
+	selector, err = ParseSelector("even")
+	g.Expect(err).To(gomega.BeNil())
+	list = []TestObject{}
+	err = DB.List(&list, ListOptions{Predicate: selector})
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(len(list)).To(gomega.Equal(N / 2))
+	g.Expect(list[1].ID).To(gomega.Equal(2))
+	selector, err = ParseSelector("!even")
+	g.Expect(err).To(gomega.BeNil())
+	list = []TestObject{}
+	err = DB.List(&list, ListOptions{Predicate: selector})
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(len(list)).To(gomega.Equal(N / 2))
+	g.Expect(list[1].ID).To(gomega.Equal(3))
+	// By label selector (gt,lt) combined with labels.
+	selector, err = ParseSelector("n>2,n<7")
+	g.Expect(err).To(gomega.BeNil())
+	selector.Labels = Labels{"even": ""}
+	list = []TestObject{}
+	err = DB.List(&list, ListOptions{Predicate: selector})
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(len(list)).To(gomega.Equal(2))
+	g.Expect(list[0].ID).To(gomega.Equal(4))
+	g.Expect(list[1].ID).To(gomega.Equal(6))
+	// By label selector (lt) non-numeric values not matched.
+	selector, err = ParseSelector("id<1")
+	g.Expect(err).To(gomega.BeNil())
+	list = []TestObject{}
+	err = DB.List(&list, ListOptions{Predicate: selector})
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(len(list)).To(gomega.Equal(0))
+	// By label selector (invalid).
+	_, err = ParseSelector("id in (")
+	g.Expect(err).ToNot(gomega.BeNil())
+	// Test count all.
+	count, err := DB.Count(&TestObject{}, nil)
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(count).To(gomega.Equal(int64(10)))
+	// Test count with predicate.
+	count, err = DB.Count(&TestObject{}, Gt("ID", 0))
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(count).To(gomega.Equal(int64(9)))
+}
+
+func TestFind(t *testing.T) {
+	var err error
+	g := gomega.NewGomegaWithT(t)
+	DB := New(
+		"/tmp/test-iter.db",
+		&TestObject{})
+	err = DB.Open(true)
+	defer func() {
+		_ = DB.Close(true)
+	}()
+	g.Expect(err).To(gomega.BeNil())
+	N := 10
+	for i := 0; i < N; i++ {
+		object := &TestObject{
+			ID:     i,
+			Name:   "Elmer",
+			Age:    18,
+			Int8:   8,
+			Int16:  16,
+			Int32:  32,
+			Bool:   true,
+			Object: TestEncoded{Name: "json"},
+			Slice:  []string{"hello", "world"},
+			Map:    map[string]int{"A": 1, "B": 2},
+			D4:     "d-4",
+			labels: Labels{
+				"id": fmt.Sprintf("v%d", i),
+			},
+		}
+		err = DB.Insert(object)
+		g.Expect(err).To(gomega.BeNil())
+	}
+	// List all; detail level=0
+	itr, err := DB.Find(
+		&TestObject{},
+		ListOptions{})
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(itr.Len()).To(gomega.Equal(10))
+	var list []TestObject
+	for {
+		object := TestObject{}
+		if itr.NextWith(&object) {
+			g.Expect(err).To(gomega.BeNil())
+			list = append(list, object)
+		} else {
+			break
+		}
+	}
+	g.Expect(len(list)).To(gomega.Equal(10))
+	// List all; detail level=0
+	itr, err = DB.Find(
+		&TestObject{},
+		ListOptions{})
+	g.Expect(err).To(gomega.BeNil())
+	for object, hasNext := itr.Next(); hasNext; object, hasNext = itr.Next() {
+		g.Expect(err).To(gomega.BeNil())
+		_, cast := object.(Model)
+		g.Expect(cast).To(gomega.BeTrue())
+	}
+}
+
+func TestStream(t *testing.T) {
+	var err error
+	g := gomega.NewGomegaWithT(t)
+	DB := New(
+		"/tmp/test-stream.db",
+		&TestObject{})
+	err = DB.Open(true)
+	defer func() {
+		_ = DB.Close(true)
+	}()
+	g.Expect(err).To(gomega.BeNil())
+	N := 10
+	for i := 0; i < N; i++ {
+		err = DB.Insert(&TestObject{ID: i, Name: "Elmer"})
+		g.Expect(err).To(gomega.BeNil())
+	}
+	// Exhausted (auto-closed).
+	cursor, err := DB.Stream(
+		&TestObject{},
+		ListOptions{
+			Detail:    MaxDetail,
+			Predicate: Gt("ID", 4),
+		})
+	g.Expect(err).To(gomega.BeNil())
+	ids := []int{}
+	for {
+		m, hasNext := cursor.Next()
+		if !hasNext {
+			break
+		}
+		object := m.(*TestObject)
+		g.Expect(object.Name).To(gomega.Equal("Elmer"))
+		ids = append(ids, object.ID)
+	}
+	g.Expect(cursor.Err()).To(gomega.BeNil())
+	g.Expect(ids).To(gomega.Equal([]int{5, 6, 7, 8, 9}))
+	g.Expect(cursor.closed).To(gomega.BeTrue())
+	// Closed early (session returned).
+	for i := 0; i < 20; i++ {
+		cursor, err = DB.Stream(&TestObject{}, ListOptions{})
+		g.Expect(err).To(gomega.BeNil())
+		object := &TestObject{}
+		g.Expect(cursor.NextWith(object)).To(gomega.BeTrue())
+		cursor.Close()
+		g.Expect(cursor.Next()).To(gomega.BeNil())
+	}
+	// Invalid.
+	_, err = DB.Stream(&TestObject{}, ListOptions{Predicate: Eq("x", 0)})
+	g.Expect(errors.Is(err, PredicateRefErr)).To(gomega.BeTrue())
+	// Watch (streamed) snapshot.
+	handler := &TestHandler{
+		options: WatchOptions{
+			Snapshot: true,
+			Stream:   true,
+		},
+	}
+	w, err := DB.Watch(&TestObject{}, handler)
+	g.Expect(err).To(gomega.BeNil())
+	for i := 0; i < 10; i++ {
+		if handler.snapshot().parity {
+			break
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	g.Expect(len(handler.snapshot().created)).To(gomega.Equal(N))
+	w.End()
+}
+
+func TestWatch(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	DB := New("/tmp/test-watch.db", &TestObject{})
+	err := DB.Open(true)
+	defer func() {
+		_ = DB.Close(false)
+	}()
+	g.Expect(err).To(gomega.BeNil())
+	// Handler A
+	handlerA := &TestHandler{
+		options: WatchOptions{Snapshot: true},
+		name:    "A",
+	}
+	watchA, err := DB.Watch(&TestObject{}, handlerA)
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(watchA).ToNot(gomega.BeNil())
+	g.Expect(watchA.Alive()).To(gomega.BeTrue())
+	N := 10
+	// Insert
+	for i := 0; i < N; i++ {
+		object := &TestObject{
+			ID:   i,
+			Name: "Elmer",
+		}
+		err = DB.Insert(object)
+		g.Expect(err).To(gomega.BeNil())
+	}
+	// Handler B
+	handlerB := &TestHandler{
+		options: WatchOptions{Snapshot: true},
+		name:    "B",
+	}
+	watchB, err := DB.Watch(&TestObject{}, handlerB)
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(watchB).ToNot(gomega.BeNil())
+	// Update
+	for i := 0; i < N; i++ {
+		object := &TestObject{ID: i}
+		_ = DB.Get(object)
+		object.Name = "Fudd"
+		object.Age = 18
+		object.Int8 = 8
+		object.Int16 = 16
+		object.Int32 = 32
+		object.Bool = true
+		object.Object = TestEncoded{Name: "json"}
+		object.Slice = []string{"hello", "world"}
+		object.Map = map[string]int{"A": 1, "B": 2}
+		object.D4 = "d-4"
+		object.labels = Labels{
+			"id": fmt.Sprintf("v%d", i),
+		}
+		err = DB.Update(object)
+		g.Expect(err).To(gomega.BeNil())
+	}
+	// Handler C
+	handlerC := &TestHandler{
+		options: WatchOptions{Snapshot: true},
+		name:    "C",
+	}
+	watchC, err := DB.Watch(&TestObject{}, handlerC)
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(watchC).ToNot(gomega.BeNil())
+	// Handler D (no snapshot)
+	handlerD := &TestHandler{name: "D"}
+	watchD, err := DB.Watch(&TestObject{}, handlerD)
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(watchC).ToNot(gomega.BeNil())
+	// Delete
+	for i := 0; i < N; i++ {
+		object := &TestObject{
+			ID: i,
+		}
+		err = DB.Delete(object)
+		g.Expect(err).To(gomega.BeNil())
+	}
+	for i := 0; i < N; i++ {
+		time.Sleep(time.Millisecond * 10)
+		if len(handlerA.snapshot().created) != N ||
+			len(handlerA.snapshot().updated) != N ||
+			len(handlerA.snapshot().deleted) != N ||
+			len(handlerB.snapshot().created) != N ||
+			len(handlerB.snapshot().updated) != N ||
+			len(handlerB.snapshot().deleted) != N ||
+			len(handlerC.snapshot().created) != N ||
+			len(handlerC.snapshot().deleted) != N {
+			continue
+		} else {
+			break
+		}
+	}
+	g.Expect(handlerA.snapshot().started).To(gomega.BeTrue())
+	g.Expect(handlerB.snapshot().started).To(gomega.BeTrue())
+	g.Expect(handlerC.snapshot().started).To(gomega.BeTrue())
+	g.Expect(handlerD.snapshot().started).To(gomega.BeTrue())
+	g.Expect(handlerA.snapshot().parity).To(gomega.BeTrue())
+	g.Expect(handlerB.snapshot().parity).To(gomega.BeTrue())
+	g.Expect(handlerC.snapshot().parity).To(gomega.BeTrue())
+	g.Expect(handlerD.snapshot().parity).To(gomega.BeTrue())
+	//
+	// The scenario is:
+	// 1. handler A created
+	// 2. (N) models created. handler A should get (N) CREATE events.
+	// 3. handler B created.  handler B should get (N) CREATE events.
+	// 4. (N) models updated. handler A & B should get (N) UPDATE events.
+	// 5. Handler C created.  handler C should get (N) CREATE events.
+	// 6. (N) models deleted. handler A,B,C should get (N) DELETE events.
+	all := []TestEvent{}
+	created := []TestEvent{}
+	updated := []TestEvent{}
+	deleted := []TestEvent{}
+	for _, action := range []uint8{Created, Updated, Deleted} {
+		for i := 0; i < N; i++ {
+			switch action {
+			case Created:
+				created = append(
+					created,
+					TestEvent{
+						action: action,
+						model:  &TestObject{ID: i},
+					})
+			case Updated:
+				updated = append(
+					updated,
+					TestEvent{
+						action: action,
+						model:  &TestObject{ID: i},
+					})
+			case Deleted:
+				deleted = append(
+					deleted,
+					TestEvent{
+						action: action,
+						model:  &TestObject{ID: i},
+					})
+			}
+			all = append(
+				all,
+				TestEvent{
+					action: action,
+					model:  &TestObject{ID: i},
+				})
+		}
+	}
+	g.Expect(func() (eq bool) {
+		h := handlerA.snapshot()
+		if len(all) != len(h.all) {
+			return
+		}
+		for i := 0; i < len(all); i++ {
+			if h.all[i].action == Updated {
+				if h.all[i].updated.Rev != h.all[i].model.Rev+1 ||
+					h.all[i].updated.Name != "Fudd" {
+					return
+				}
+			}
+			if all[i].action != h.all[i].action ||
+				all[i].model.ID != h.all[i].model.ID {
+				return
+			}
+		}
+		return true
+	}()).To(gomega.BeTrue())
+	g.Expect(func() (eq bool) {
+		h := handlerB.snapshot()
+		if len(all) != len(h.all) {
+			return
+		}
+		for i := 0; i < len(all); i++ {
+			if all[i].action != h.all[i].action ||
+				all[i].model.ID != h.all[i].model.ID {
+				return
+			}
+		}
+		return true
+	}()).To(gomega.BeTrue())
+	all = []TestEvent{}
+	for _, action := range []uint8{Created, Deleted} {
+		for i := 0; i < N; i++ {
+			all = append(
+				all,
+				TestEvent{
+					action: action,
+					model:  &TestObject{ID: i},
+				})
+		}
+	}
+	g.Expect(func() (eq bool) {
+		h := handlerC.snapshot()
+		if len(all) != len(h.all) {
+			return
+		}
+		for i := 0; i < len(all); i++ {
+			if all[i].action != h.all[i].action ||
+				all[i].model.ID != h.all[i].model.ID {
+				return
+			}
+		}
+		return true
+	}()).To(gomega.BeTrue())
+	g.Expect(func() (eq bool) {
+		h := handlerD.snapshot()
+		if len(deleted) != len(h.deleted) {
+			return
+		}
+		for i := 0; i < len(deleted); i++ {
+			if deleted[i].model.ID != h.deleted[i] {
+				return
+			}
+		}
+		return true
+	}()).To(gomega.BeTrue())
+
+	//
+	// Test watch end.
+	watchA.End()
+	watchB.End()
+	watchC.End()
+	watchD.End()
+	ended := false
+	for i := 0; i < 10; i++ {
+		if !handlerA.snapshot().done ||
+			!handlerB.snapshot().done ||
+			!handlerC.snapshot().done ||
+			!handlerD.snapshot().done {
+			time.Sleep(50 * time.Millisecond)
+		} else {
+			ended = true
+			break
+		}
+	}
+	g.Expect(len(watchA.journal.watches)).To(gomega.Equal(0))
+	g.Expect(ended).To(gomega.BeTrue())
+	g.Expect(handlerA.snapshot().done).To(gomega.BeTrue())
+	g.Expect(handlerB.snapshot().done).To(gomega.BeTrue())
+	g.Expect(handlerC.snapshot().done).To(gomega.BeTrue())
+	g.Expect(handlerD.snapshot().done).To(gomega.BeTrue())
+}
+
+func TestCloseDB(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	DB := New("/tmp/test-close-db.db", &TestObject{})
+	err := DB.Open(true)
+	defer func() {
+		_ = DB.Close(false)
+	}()
+	g.Expect(err).To(gomega.BeNil())
+	handler := &TestHandler{
+		options: WatchOptions{Snapshot: true},
+		name:    "A",
+	}
+	_, err = DB.Watch(&TestObject{}, handler)
+	g.Expect(err).To(gomega.BeNil())
+	for i := 0; i < 10; i++ {
+		if !handler.snapshot().started {
+			time.Sleep(50 * time.Millisecond)
+		} else {
+			break
+		}
+	}
+	g.Expect(handler.snapshot().started).To(gomega.BeTrue())
+	g.Expect(handler.snapshot().done).To(gomega.BeFalse())
+	_ = DB.Close(true)
+	for _, session := range DB.(*Client).pool.sessions {
+		g.Expect(session.closed).To(gomega.BeTrue())
+	}
+	for i := 0; i < 100; i++ {
+		if !handler.snapshot().done {
+			time.Sleep(50 * time.Millisecond)
+		} else {
+			break
+		}
+	}
+
+	g.Expect(handler.snapshot().done).To(gomega.BeTrue())
+}
+
+func TestMutatingWatch(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	DB := New("/tmp/test-mutating-watch.db", &TestObject{})
+	err := DB.Open(true)
+	defer func() {
+		_ = DB.Close(true)
+	}()
+
+	g.Expect(err).To(gomega.BeNil())
+
+	// Handler A
+	handlerA := &MutatingHandler{
+		options: WatchOptions{Snapshot: true},
+		name:    "A",
+		DB:      DB,
+	}
+	watchA, err := DB.Watch(&TestObject{}, handlerA)
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(watchA).ToNot(gomega.BeNil())
+	// Handler B
+	handlerB := &MutatingHandler{
+		options: WatchOptions{Snapshot: true},
+		name:    "B",
+		DB:      DB,
+	}
+	watchB, err := DB.Watch(&TestObject{}, handlerB)
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(watchB).ToNot(gomega.BeNil())
+	N := 10
+	// Insert
+	for i := 0; i < N; i++ {
+		object := &TestObject{
+			ID:   i,
+			Name: "Elmer",
+		}
+		err = DB.Insert(object)
+		g.Expect(err).To(gomega.BeNil())
+	}
+
+	for {
+		time.Sleep(time.Millisecond * 10)
+		if handlerA.nUpdated() == N*2 {
+			break
+		}
+	}
+}
+
+func TestExecute(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	type Person struct {
+		ID   int    `sql:"pk"`
+		Name string `sql:""`
+	}
+	DB := New("/tmp/test-execute.db", &Person{})
+	err := DB.Open(true)
+	defer func() {
+		_ = DB.Close(false)
+	}()
+
+	g.Expect(err).To(gomega.BeNil())
+
+	result, err := DB.Execute(
+		"INSERT INTO Person (id, name) values (0, 'john');")
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(result.RowsAffected()).To(gomega.Equal(int64(1)))
+}
+
+func TestSession(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	DB := New("/tmp/test-session.db", &TestObject{})
+	DB.Open(true)
+	defer func() {
+		_ = DB.Close(false)
+	}()
+
+	pool := &DB.(*Client).pool
+
+	w := pool.Writer()
+	g.Expect(w.id).To(gomega.Equal(0))
+	for n := 1; n < 11; n++ {
+		r := pool.Reader()
+		g.Expect(r.id).To(gomega.Equal(n))
+	}
+}
+
+// Remove leading __ to enable.
+func __TestDbLocked(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	DB := New("/tmp/test-db-locked.db", &TestObject{}, &PlainObject{})
+	err := DB.Open(true)
+	defer func() {
+		_ = DB.Close(false)
+	}()
+	errChan := make(chan error)
+	endChan := make(chan int)
+	go func() {
+		tx, _ := DB.Begin()
+		defer func() {
+			errChan <- err
+			close(errChan)
+			_ = tx.End()
+		}()
+		for i := 0; i < 20000; i++ {
+			object := &TestObject{
+				ID:   i,
+				Name: "Elmer",
+			}
+			err = tx.Insert(object)
+			errChan <- err
+			if err != nil {
+				return
+			}
+		}
+		err = tx.Commit()
+	}()
+	go func() {
+		defer close(endChan)
+		n := int64(0)
+		for err = range errChan {
+			g.Expect(err).To(gomega.BeNil())
+			n, err = DB.Count(&TestObject{}, nil)
+			g.Expect(err).To(gomega.BeNil())
+		}
+		fmt.Printf("Count:%d", n)
+	}()
+
+	for _ = range endChan {
+	}
+}
+
+// Remove leading __ to enable.
+func __TestConcurrency(t *testing.T) {
+	var err error
+
+	DB := New("/tmp/test-concurrency.db", &TestObject{})
+	DB.Open(true)
+	defer func() {
+		_ = DB.Close(false)
+	}()
+
+	N := 1000
+
+	direct := func(done chan int) {
+		for i := 0; i < N; i++ {
+			m := &TestObject{
+				ID:   i,
+				Name: "direct",
+			}
+			err := DB.Insert(m)
+			if err != nil {
+				panic(err)
+			}
+			fmt.Printf("direct|%d\n", i)
+			time.Sleep(time.Millisecond * 10)
+		}
+		done <- 0
+	}
+	read := func(done chan int) {
+		time.Sleep(time.Second)
+		for i := 0; i < N; i++ {
+			m := &TestObject{
+				ID:   i,
+				Name: "direct",
+			}
+			go func() {
+				err := DB.Get(m)
+				if err != nil {
+					if errors.Is(err, NotFound) {
+						fmt.Printf("read|%d _____%s\n", i, err)
+					} else {
+						panic(err)
+					}
+				}
+				fmt.Printf("read|%d\n", i)
+			}()
+			time.Sleep(time.Millisecond * 100)
+		}
+		done <- 0
+	}
 	del := func(done chan int) {
 		time.Sleep(time.Second * 3)
 		for i := 0; i < N/2; i++ {
@@ -1384,169 +3140,1410 @@ func __TestConcurrency(t *testing.T) {
 			}()
 			time.Sleep(time.Millisecond * 300)
 		}
-		done <- 0
+		done <- 0
+	}
+	update := func(done chan int) {
+		for i := 0; i < N; i++ {
+			m := &TestObject{
+				ID:   i,
+				Name: "direct",
+			}
+			go func() {
+				err := DB.Update(m)
+				if err != nil {
+					if errors.Is(err, NotFound) {
+						fmt.Printf("update|%d _____%s\n", i, err)
+					} else {
+						panic(err)
+					}
+				}
+				fmt.Printf("update|%d\n", i)
+			}()
+			time.Sleep(time.Millisecond * 20)
+		}
+		done <- 0
+	}
+	transaction := func(done chan int) {
+		time.Sleep(time.Millisecond * 100)
+		var tx *Tx
+		defer func() {
+			if tx != nil {
+				err := tx.Commit()
+				if err != nil {
+					panic(err)
+				}
+			}
+		}()
+		threshold := float64(10)
+		for i := N; i < N*2; i++ {
+			if tx == nil {
+				tx, err = DB.Begin()
+				if err != nil {
+					panic(err)
+				}
+			}
+			m := &TestObject{
+				ID:   i,
+				Name: "transaction",
+			}
+			err = tx.Insert(m)
+			if err != nil {
+				panic(err)
+			}
+			//time.Sleep(time.Second*3)
+			if math.Mod(float64(i), threshold) == 0 {
+				err = tx.Commit()
+				if err != nil {
+					panic(err)
+				}
+				tx = nil
+				fmt.Printf("commit|%d\n", i)
+			}
+			fmt.Printf("transaction|%d\n", i)
+			time.Sleep(time.Millisecond * 100)
+		}
+		done <- 0
+	}
+
+	mark := time.Now()
+
+	done := make(chan int)
+	fnList := []func(chan int){
+		direct,
+		transaction,
+		read,
+		update,
+		del,
+	}
+	for _, fn := range fnList {
+		go fn(done)
+	}
+	for range fnList {
+		<-done
+	}
+
+	fmt.Println(time.Since(mark))
+}
+
+func TestDefinitions(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	list := Definitions{}
+	// Push
+	list.Push(&Definition{Kind: "0"})
+	list.Push(&Definition{Kind: "1"})
+	list.Push(&Definition{Kind: "2"})
+	g.Expect(list).To(gomega.Equal(
+		Definitions{
+			&Definition{Kind: "0"},
+			&Definition{Kind: "1"},
+			&Definition{Kind: "2"},
+		}))
+	// Pop
+	d2 := list.Pop()
+	g.Expect(d2.Kind).To(gomega.Equal("2"))
+	g.Expect(list).To(gomega.Equal(
+		Definitions{
+			&Definition{Kind: "0"},
+			&Definition{Kind: "1"},
+		}))
+	// Append
+	list.Push(&Definition{Kind: "2"})
+	g.Expect(list).To(gomega.Equal(
+		Definitions{
+			&Definition{Kind: "0"},
+			&Definition{Kind: "1"},
+			&Definition{Kind: "2"},
+		}))
+	// Delete
+	list.Delete(1)
+	g.Expect(list).To(gomega.Equal(
+		Definitions{
+			&Definition{Kind: "0"},
+			&Definition{Kind: "2"},
+		}))
+	list = Definitions{
+		&Definition{Kind: "0"},
+		&Definition{Kind: "1"},
+		&Definition{Kind: "2"},
+	}
+	list.Delete(0)
+	g.Expect(list).To(gomega.Equal(
+		Definitions{
+			&Definition{Kind: "1"},
+			&Definition{Kind: "2"},
+		}))
+	list = Definitions{
+		&Definition{Kind: "0"},
+		&Definition{Kind: "1"},
+		&Definition{Kind: "2"},
+	}
+	list.Delete(2)
+	g.Expect(list).To(gomega.Equal(
+		Definitions{
+			&Definition{Kind: "0"},
+			&Definition{Kind: "1"},
+		}))
+	// Head and Top.
+	list = Definitions{
+		&Definition{Kind: "0"},
+		&Definition{Kind: "1"},
+		&Definition{Kind: "2"},
+	}
+	g.Expect(list.Top().Kind).To(gomega.Equal("2"))
+	g.Expect(list.Head(false).Kind).To(gomega.Equal("0"))
+	g.Expect(list.Head(true).Kind).To(gomega.Equal("0"))
+	g.Expect(list).To(gomega.Equal(
+		Definitions{
+			&Definition{Kind: "1"},
+			&Definition{Kind: "2"},
+		}))
+}
+
+func fieldNames(fields []*Field) (names []string) {
+	for _, f := range fields {
+		names = append(names, f.Name)
+	}
+
+	return
+}
+
+func TestLeak(t *testing.T) {
+	var err error
+	g := gomega.NewGomegaWithT(t)
+	metrics := &RecordedMetrics{operation: map[string]int64{}}
+	Metrics = metrics
+	LeakCheckInterval = time.Millisecond * 10
+	LeakThreshold = time.Millisecond * 20
+	TxMaxLifespan = time.Millisecond * 200
+	defer func() {
+		Metrics = &StockMetrics{}
+		LeakCheckInterval = time.Second * 10
+		LeakThreshold = time.Minute
+		TxMaxLifespan = 0
+	}()
+	DB := New(
+		"/tmp/test-leak.db",
+		&PlainObject{})
+	err = DB.Open(true)
+	g.Expect(err).To(gomega.BeNil())
+	defer func() {
+		_ = DB.Close(true)
+	}()
+	err = DB.Insert(&PlainObject{ID: 0})
+	g.Expect(err).To(gomega.BeNil())
+	// Leaked cursor (reported).
+	cursor, err := DB.Stream(&PlainObject{}, ListOptions{})
+	g.Expect(err).To(gomega.BeNil())
+	// Leaked transaction (aborted).
+	tx, err := DB.Begin()
+	g.Expect(err).To(gomega.BeNil())
+	err = tx.Insert(&PlainObject{ID: 1})
+	g.Expect(err).To(gomega.BeNil())
+	held := func() (held, aborted int) {
+		metrics.mutex.Lock()
+		defer metrics.mutex.Unlock()
+		return metrics.held, metrics.aborted
+	}
+	for i := 0; i < 100; i++ {
+		if n, _ := held(); n == 2 {
+			break
+		}
+		time.Sleep(time.Millisecond * 10)
 	}
-	update := func(done chan int) {
-		for i := 0; i < N; i++ {
-			m := &TestObject{
-				ID:   i,
-				Name: "direct",
-			}
-			go func() {
-				err := DB.Update(m)
-				if err != nil {
-					if errors.Is(err, NotFound) {
-						fmt.Printf("update|%d _____%s\n", i, err)
-					} else {
-						panic(err)
-					}
-				}
-				fmt.Printf("update|%d\n", i)
-			}()
-			time.Sleep(time.Millisecond * 20)
+	n, _ := held()
+	g.Expect(n).To(gomega.Equal(2))
+	reserved := 0
+	for _, s := range DB.Sessions() {
+		if !s.Reserved {
+			continue
+		}
+		reserved++
+		g.Expect(s.Age > LeakThreshold).To(gomega.BeTrue())
+		g.Expect(strings.Join(s.Stack, "\n")).To(gomega.ContainSubstring("TestLeak"))
+		if s.Role == RoleWriter {
+			g.Expect(s.Tx).To(gomega.Equal(1))
 		}
-		done <- 0
 	}
-	transaction := func(done chan int) {
-		time.Sleep(time.Millisecond * 100)
-		var tx *Tx
-		defer func() {
-			if tx != nil {
-				err := tx.Commit()
-				if err != nil {
-					panic(err)
+	g.Expect(reserved).To(gomega.Equal(2))
+	// Aborted.
+	for i := 0; i < 100; i++ {
+		if _, n := held(); n == 1 {
+			break
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	_, n = held()
+	g.Expect(n).To(gomega.Equal(1))
+	err = DB.Insert(&PlainObject{ID: 2})
+	g.Expect(err).To(gomega.BeNil())
+	err = tx.Insert(&PlainObject{ID: 3})
+	g.Expect(errors.Is(err, TxAbortedErr)).To(gomega.BeTrue())
+	err = tx.Get(&PlainObject{ID: 2})
+	g.Expect(errors.Is(err, TxAbortedErr)).To(gomega.BeTrue())
+	err = tx.Commit()
+	g.Expect(errors.Is(err, TxAbortedErr)).To(gomega.BeTrue())
+	err = DB.Get(&PlainObject{ID: 1})
+	g.Expect(errors.Is(err, NotFound)).To(gomega.BeTrue())
+	// Cursor not aborted.
+	_, hasNext := cursor.Next()
+	g.Expect(hasNext).To(gomega.BeTrue())
+	cursor.Close()
+	reserved = 0
+	for _, s := range DB.Sessions() {
+		if s.Reserved {
+			reserved++
+		}
+	}
+	g.Expect(reserved).To(gomega.Equal(0))
+}
+
+func TestRevision(t *testing.T) {
+	var err error
+	g := gomega.NewGomegaWithT(t)
+	path := "/tmp/test-revision.db"
+	DB := New(path, &RevObject{}, &PlainObject{})
+	err = DB.Open(true)
+	g.Expect(err).To(gomega.BeNil())
+	rev, err := DB.Revision()
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(rev).To(gomega.Equal(int64(0)))
+	// Once per tx.
+	tx, err := DB.Begin()
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(tx.Revision()).To(gomega.Equal(int64(0)))
+	a := &RevObject{ID: 1, Name: "a"}
+	b := &RevObject{ID: 2, Name: "b"}
+	err = tx.Insert(a)
+	g.Expect(err).To(gomega.BeNil())
+	err = tx.Insert(b)
+	g.Expect(err).To(gomega.BeNil())
+	err = tx.Insert(&PlainObject{ID: 1})
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(tx.Revision()).To(gomega.Equal(int64(1)))
+	g.Expect(a.Rev).To(gomega.Equal(int64(1)))
+	g.Expect(b.Rev).To(gomega.Equal(int64(1)))
+	err = tx.Commit()
+	g.Expect(err).To(gomega.BeNil())
+	rev, err = DB.Revision()
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(rev).To(gomega.Equal(int64(1)))
+	// Update.
+	a.Name = "A"
+	err = DB.Update(a)
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(a.Rev).To(gomega.Equal(int64(2)))
+	got := &RevObject{ID: 1}
+	err = DB.Get(got)
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(got.Rev).To(gomega.Equal(int64(2)))
+	// Since.
+	list := []RevObject{}
+	err = DB.List(&list, ListOptions{SinceRevision: 1})
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(len(list)).To(gomega.Equal(1))
+	g.Expect(list[0].ID).To(gomega.Equal(1))
+	list = []RevObject{}
+	err = DB.List(
+		&list,
+		ListOptions{
+			SinceRevision: 1,
+			Predicate:     Eq("Name", "b"),
+		})
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(len(list)).To(gomega.Equal(0))
+	n, err := DB.Count(&RevObject{}, nil)
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(n).To(gomega.Equal(int64(2)))
+	err = DB.List(&[]PlainObject{}, ListOptions{SinceRevision: 1})
+	g.Expect(errors.Is(err, RevisionFieldErr)).To(gomega.BeTrue())
+	// Delete.
+	err = DB.Delete(&RevObject{ID: 2})
+	g.Expect(err).To(gomega.BeNil())
+	// No changes.
+	err = DB.With(func(tx *Tx) (err error) {
+		_, err = tx.Count(&RevObject{}, nil)
+		return
+	})
+	g.Expect(err).To(gomega.BeNil())
+	// Rolled back.
+	tx, err = DB.Begin()
+	g.Expect(err).To(gomega.BeNil())
+	err = tx.Insert(&RevObject{ID: 3})
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(tx.Revision()).To(gomega.Equal(int64(4)))
+	_ = tx.End()
+	rev, err = DB.Revision()
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(rev).To(gomega.Equal(int64(3)))
+	// Durable.
+	err = DB.Close(false)
+	g.Expect(err).To(gomega.BeNil())
+	DB = New(path, &RevObject{}, &PlainObject{})
+	err = DB.Open(false)
+	g.Expect(err).To(gomega.BeNil())
+	defer func() {
+		_ = DB.Close(true)
+	}()
+	rev, err = DB.Revision()
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(rev).To(gomega.Equal(int64(3)))
+	c := &RevObject{ID: 3}
+	err = DB.Insert(c)
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(c.Rev).To(gomega.Equal(int64(4)))
+	// Not valid.
+	_, err = Inspect(&BadRevObject{})
+	g.Expect(errors.Is(err, RevisionTypeErr)).To(gomega.BeTrue())
+}
+
+func TestAudit(t *testing.T) {
+	var err error
+	g := gomega.NewGomegaWithT(t)
+	DB := New("/tmp/test-audit.db", &RevObject{})
+	DB.Audit(true)
+	err = DB.Open(true)
+	g.Expect(err).To(gomega.BeNil())
+	defer func() {
+		_ = DB.Close(true)
+	}()
+	a := &RevObject{ID: 1, Name: "a"}
+	tx, err := DB.Begin("x")
+	g.Expect(err).To(gomega.BeNil())
+	tx.SetMeta(
+		TxMeta{
+			Actor:       "elmer",
+			Reason:      "created",
+			Correlation: "c1",
+		})
+	g.Expect(tx.Meta().Labels).To(gomega.Equal([]string{"x"}))
+	err = tx.Insert(a)
+	g.Expect(err).To(gomega.BeNil())
+	a.Name = "A"
+	err = tx.Update(a)
+	g.Expect(err).To(gomega.BeNil())
+	err = tx.Insert(&RevObject{ID: 2})
+	g.Expect(err).To(gomega.BeNil())
+	err = tx.Commit()
+	g.Expect(err).To(gomega.BeNil())
+	err = DB.With(func(tx *Tx) (err error) {
+		tx.SetMeta(
+			TxMeta{
+				Actor:       "bugs",
+				Reason:      "deleted",
+				Correlation: "c2",
+				Labels:      []string{"y"},
+			})
+		err = tx.Delete(&RevObject{ID: 1})
+		return
+	})
+	g.Expect(err).To(gomega.BeNil())
+	history, err := DB.History(&RevObject{ID: 1})
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(len(history)).To(gomega.Equal(3))
+	g.Expect(history[0].Action).To(gomega.Equal("created"))
+	g.Expect(history[0].Revision).To(gomega.Equal(int64(1)))
+	g.Expect(history[0].Kind).To(gomega.Equal("RevObject"))
+	g.Expect(history[0].Key).To(gomega.Equal("1"))
+	g.Expect(history[0].Actor).To(gomega.Equal("elmer"))
+	g.Expect(history[0].Labels).To(gomega.Equal([]string{"x"}))
+	g.Expect(history[0].Timestamp > 0).To(gomega.BeTrue())
+	g.Expect(history[1].Action).To(gomega.Equal("updated"))
+	g.Expect(history[1].Revision).To(gomega.Equal(int64(1)))
+	g.Expect(history[1].Seq > history[0].Seq).To(gomega.BeTrue())
+	g.Expect(history[2].Action).To(gomega.Equal("deleted"))
+	g.Expect(history[2].Revision).To(gomega.Equal(int64(2)))
+	g.Expect(history[2].Actor).To(gomega.Equal("bugs"))
+	g.Expect(history[2].Reason).To(gomega.Equal("deleted"))
+	g.Expect(history[2].Labels).To(gomega.Equal([]string{"y"}))
+	// By correlation.
+	list := []Audit{}
+	err = DB.List(
+		&list,
+		ListOptions{
+			Predicate: Eq("Correlation", "c1"),
+			Detail:    MaxDetail,
+		})
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(len(list)).To(gomega.Equal(3))
+	// Not exported.
+	bfr := &bytes.Buffer{}
+	err = DB.Export(bfr)
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(bfr.String()).ToNot(gomega.ContainSubstring(`"kind":"Audit"`))
+	// Sort by unknown field.
+	err = DB.List(&[]Audit{}, ListOptions{SortBy: []string{"Bad"}})
+	g.Expect(errors.Is(err, SortRefErr)).To(gomega.BeTrue())
+	// Fixed when opened.
+	DB.Audit(false)
+	_, err = DB.History(&RevObject{ID: 1})
+	g.Expect(err).To(gomega.BeNil())
+	// Disabled.
+	DB2 := New("/tmp/test-audit2.db", &RevObject{})
+	err = DB2.Open(true)
+	g.Expect(err).To(gomega.BeNil())
+	defer func() {
+		_ = DB2.Close(true)
+	}()
+	err = DB2.Insert(&RevObject{ID: 1, Name: "a"})
+	g.Expect(err).To(gomega.BeNil())
+	_, err = DB2.History(&RevObject{ID: 1})
+	g.Expect(errors.Is(err, AuditErr)).To(gomega.BeTrue())
+	n, err := DB2.Count(&Audit{}, nil)
+	g.Expect(err).ToNot(gomega.BeNil())
+	g.Expect(n).To(gomega.Equal(int64(0)))
+}
+
+func TestProjection(t *testing.T) {
+	var err error
+	g := gomega.NewGomegaWithT(t)
+	DB := New(
+		"/tmp/test-projection.db",
+		&ProjectedVM{},
+		&HostSummary{})
+	err = DB.Open(true)
+	g.Expect(err).To(gomega.BeNil())
+	defer func() {
+		_ = DB.Close(true)
+	}()
+	adjust := func(tx *Tx, host, delta int) (err error) {
+		m := &HostSummary{Host: host}
+		err = tx.Get(m)
+		if errors.Is(err, NotFound) {
+			m.VMs = delta
+			err = tx.Insert(m)
+			return
+		}
+		if err != nil {
+			return
+		}
+		m.VMs += delta
+		if m.VMs == 0 {
+			err = tx.Delete(m)
+		} else {
+			err = tx.Update(m)
+		}
+		return
+	}
+	projection := Projection{
+		Name:    "host-summary",
+		Sources: []Model{&ProjectedVM{}},
+		Derived: []Model{&HostSummary{}},
+		Apply: func(tx *Tx, events []Event) (err error) {
+			for _, event := range events {
+				vm := event.Model.(*ProjectedVM)
+				if vm.ID == 99 {
+					err = errors.New("failed")
+					return
+				}
+				switch event.Action {
+				case Created:
+					err = adjust(tx, vm.Host, 1)
+				case Deleted:
+					err = adjust(tx, vm.Host, -1)
+				case Updated:
+					err = adjust(tx, vm.Host, -1)
+					if err == nil {
+						err = adjust(tx, event.Updated.(*ProjectedVM).Host, 1)
+					}
 				}
-			}
-		}()
-		threshold := float64(10)
-		for i := N; i < N*2; i++ {
-			if tx == nil {
-				tx, err = DB.Begin()
 				if err != nil {
-					panic(err)
+					return
 				}
 			}
-			m := &TestObject{
-				ID:   i,
-				Name: "transaction",
+			return
+		},
+	}
+	err = DB.Project(projection)
+	g.Expect(err).To(gomega.BeNil())
+	err = DB.Project(projection)
+	g.Expect(errors.Is(err, ProjectionErr)).To(gomega.BeTrue())
+	err = DB.Project(Projection{Name: "bad"})
+	g.Expect(errors.Is(err, ProjectionErr)).To(gomega.BeTrue())
+	summary := func(host int) int {
+		m := &HostSummary{Host: host}
+		err := DB.Get(m)
+		if errors.Is(err, NotFound) {
+			return 0
+		}
+		g.Expect(err).To(gomega.BeNil())
+		return m.VMs
+	}
+	// Created.
+	err = DB.With(func(tx *Tx) (err error) {
+		for i, host := range []int{1, 1, 1, 2} {
+			err = tx.Insert(&ProjectedVM{ID: i, Host: host})
+			if err != nil {
+				return
 			}
+		}
+		return
+	})
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(summary(1)).To(gomega.Equal(3))
+	g.Expect(summary(2)).To(gomega.Equal(1))
+	// Updated.
+	err = DB.Update(&ProjectedVM{ID: 3, Host: 1})
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(summary(1)).To(gomega.Equal(4))
+	err = DB.Get(&HostSummary{Host: 2})
+	g.Expect(errors.Is(err, NotFound)).To(gomega.BeTrue())
+	// Deleted.
+	err = DB.Delete(&ProjectedVM{ID: 0})
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(summary(1)).To(gomega.Equal(3))
+	// Failed (rolled back).
+	err = DB.Insert(&ProjectedVM{ID: 99, Host: 1})
+	g.Expect(err).ToNot(gomega.BeNil())
+	err = DB.Get(&ProjectedVM{ID: 99})
+	g.Expect(errors.Is(err, NotFound)).To(gomega.BeTrue())
+	// Rebuild.
+	err = DB.Update(&HostSummary{Host: 1, VMs: 100})
+	g.Expect(err).To(gomega.BeNil())
+	err = DB.Insert(&HostSummary{Host: 7, VMs: 1})
+	g.Expect(err).To(gomega.BeNil())
+	err = DB.Rebuild()
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(summary(1)).To(gomega.Equal(3))
+	g.Expect(summary(7)).To(gomega.Equal(0))
+	err = DB.Rebuild("host-summary")
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(summary(1)).To(gomega.Equal(3))
+	err = DB.Rebuild("unknown")
+	g.Expect(errors.Is(err, ProjectionErr)).To(gomega.BeTrue())
+	// Registered concurrently with transactions.
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func(n int) {
+			defer wg.Done()
+			err := DB.Project(Projection{
+				Name:    fmt.Sprintf("noop-%d", n),
+				Sources: []Model{&HostSummary{}},
+				Apply: func(tx *Tx, events []Event) error {
+					return nil
+				},
+			})
+			g.Expect(err).To(gomega.BeNil())
+		}(i)
+		go func(n int) {
+			defer wg.Done()
+			err := DB.Insert(&ProjectedVM{ID: 100 + n, Host: 3})
+			g.Expect(err).To(gomega.BeNil())
+		}(i)
+	}
+	wg.Wait()
+	g.Expect(summary(3)).To(gomega.Equal(10))
+}
+
+func TestGraph(t *testing.T) {
+	var err error
+	g := gomega.NewGomegaWithT(t)
+	DB := New(
+		"/tmp/test-graph.db",
+		&PlainObject{},
+		&DetailA{},
+		&DetailB{},
+		&DetailC{},
+		&DetailD{},
+		&Host{},
+		&Datastore{},
+		&HostDatastore{})
+	err = DB.Open(true)
+	g.Expect(err).To(gomega.BeNil())
+	defer func() {
+		_ = DB.Close(true)
+	}()
+	err = DB.With(func(tx *Tx) (err error) {
+		models := []Model{
+			&PlainObject{ID: 1, Name: "root"},
+			&DetailA{PK: 10, FK: 1},
+			&DetailA{PK: 11, FK: 1},
+			&DetailB{PK: 20, FK: 10},
+			&DetailC{PK: 30, FK: 20},
+			&DetailC{PK: 31, FK: 20},
+			&DetailD{PK: 40, FK: 20},
+			&Host{ID: 1, Name: "host"},
+			&Datastore{ID: 2, Name: "ds"},
+			&HostDatastore{Host: 1, Datastore: 2},
+		}
+		for _, m := range models {
 			err = tx.Insert(m)
 			if err != nil {
-				panic(err)
+				return
 			}
-			//time.Sleep(time.Second*3)
-			if math.Mod(float64(i), threshold) == 0 {
-				err = tx.Commit()
+		}
+		return
+	})
+	g.Expect(err).To(gomega.BeNil())
+	kinds := func(graph *Graph) (list []string) {
+		for _, n := range graph.Nodes {
+			list = append(list, n.Kind+"/"+n.Pk)
+		}
+		return
+	}
+	// Descendants.
+	graph, err := DB.Descendants(&PlainObject{ID: 1}, GraphOptions{})
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(kinds(graph)).To(gomega.Equal([]string{
+		"PlainObject/1",
+		"DetailA/10",
+		"DetailA/11",
+		"DetailB/20",
+		"DetailC/30",
+		"DetailC/31",
+		"DetailD/40",
+	}))
+	g.Expect(graph.Nodes[3].Depth).To(gomega.Equal(2))
+	g.Expect(graph.Nodes[6].Depth).To(gomega.Equal(3))
+	g.Expect(len(graph.Edges)).To(gomega.Equal(6))
+	g.Expect(graph.Edges[0]).To(gomega.Equal(GraphEdge{
+		Kind:    "DetailA",
+		Pk:      "10",
+		Field:   "FK",
+		RefKind: "PlainObject",
+		RefPk:   "1",
+	}))
+	// Depth.
+	graph, err = DB.Descendants(&PlainObject{ID: 1}, GraphOptions{Depth: 2})
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(len(graph.Nodes)).To(gomega.Equal(4))
+	// Kinds.
+	graph, err = DB.Descendants(
+		&DetailB{PK: 20},
+		GraphOptions{Kinds: []string{"DetailC"}})
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(kinds(graph)).To(gomega.Equal([]string{
+		"DetailB/20",
+		"DetailC/30",
+		"DetailC/31",
+	}))
+	g.Expect(len(graph.Edges)).To(gomega.Equal(2))
+	graph, err = DB.Descendants(
+		&PlainObject{ID: 1},
+		GraphOptions{Kinds: []string{"DetailC"}, Models: true})
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(kinds(graph)).To(gomega.Equal([]string{
+		"PlainObject/1",
+		"DetailC/30",
+		"DetailC/31",
+	}))
+	g.Expect(graph.Nodes[1].Depth).To(gomega.Equal(3))
+	g.Expect(len(graph.Edges)).To(gomega.Equal(0))
+	g.Expect(graph.Nodes[2].Model.(*DetailC).PK).To(gomega.Equal(31))
+	_, err = DB.Descendants(
+		&DetailB{PK: 20},
+		GraphOptions{Kinds: []string{"Unknown"}})
+	g.Expect(errors.Is(err, KindErr)).To(gomega.BeTrue())
+	// Ancestors (with models).
+	graph, err = DB.Ancestors(&DetailD{PK: 40}, GraphOptions{Models: true})
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(kinds(graph)).To(gomega.Equal([]string{
+		"DetailD/40",
+		"DetailB/20",
+		"DetailA/10",
+		"PlainObject/1",
+	}))
+	g.Expect(graph.Root.Model.(*DetailD).FK).To(gomega.Equal(20))
+	g.Expect(graph.Nodes[3].Model.(*PlainObject).Name).To(gomega.Equal("root"))
+	// Generated PK.
+	joined := &HostDatastore{Host: 1, Datastore: 2}
+	graph, err = DB.Ancestors(joined, GraphOptions{Models: true})
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(joined.PK).To(gomega.BeEmpty())
+	g.Expect(graph.Root.Model.(*HostDatastore).Datastore).To(gomega.Equal(2))
+	g.Expect(kinds(graph)).To(gomega.Equal([]string{
+		"HostDatastore/" + graph.Root.Model.Pk(),
+		"Datastore/2",
+		"Host/1",
+	}))
+	// Fetched in batches.
+	batch := GraphFetchBatch
+	GraphFetchBatch = 1
+	graph, err = DB.Descendants(&PlainObject{ID: 1}, GraphOptions{Models: true})
+	GraphFetchBatch = batch
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(len(graph.Nodes)).To(gomega.Equal(7))
+	for _, node := range graph.Nodes {
+		g.Expect(node.Model).ToNot(gomega.BeNil())
+		g.Expect(ModelPk(node.Model)).To(gomega.Equal(node.Pk))
+	}
+	graph, err = DB.Descendants(&Host{ID: 1}, GraphOptions{})
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(len(graph.Nodes)).To(gomega.Equal(2))
+	// Unknown kind.
+	_, err = DB.Ancestors(&TestObject{}, GraphOptions{})
+	g.Expect(errors.Is(err, KindErr)).To(gomega.BeTrue())
+	// Serialized.
+	b, err := json.Marshal(graph)
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(string(b)).To(gomega.ContainSubstring(`"refKind":"Host"`))
+}
+
+func TestIntegrity(t *testing.T) {
+	var err error
+	g := gomega.NewGomegaWithT(t)
+	DB := New(
+		"/tmp/test-integrity.db",
+		&PlainObject{},
+		&DetailA{},
+		&DetailB{},
+		&DetailC{},
+		&Host{},
+		&DetailE{})
+	err = DB.Open(true)
+	g.Expect(err).To(gomega.BeNil())
+	defer func() {
+		_ = DB.Close(true)
+	}()
+	insert := func() {
+		err = DB.With(func(tx *Tx) (err error) {
+			models := []Model{
+				&Host{ID: 1},
+				&DetailE{PK: 1, FK: 1},
+				&DetailE{PK: 2, FK: 9},
+				&DetailE{PK: 3, FK: 0},
+				&DetailB{PK: 20, FK: 99},
+				&DetailC{PK: 30, FK: 20},
+				&DetailC{PK: 31, FK: 77},
+			}
+			for _, m := range models {
+				err = tx.Insert(m)
 				if err != nil {
-					panic(err)
+					return
 				}
-				tx = nil
-				fmt.Printf("commit|%d\n", i)
 			}
-			fmt.Printf("transaction|%d\n", i)
-			time.Sleep(time.Millisecond * 100)
+			return
+		})
+		g.Expect(err).To(gomega.BeNil())
+	}
+	byKind := func(report []Orphans) (m map[string]Orphans) {
+		m = map[string]Orphans{}
+		for _, orphans := range report {
+			m[orphans.Kind] = orphans
 		}
-		done <- 0
+		return
+	}
+	insert()
+	// Check.
+	report, err := DB.CheckIntegrity(IntegrityOptions{})
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(len(report)).To(gomega.Equal(3))
+	found := byKind(report)
+	g.Expect(found["DetailE"]).To(gomega.Equal(Orphans{
+		Kind:    "DetailE",
+		Field:   "FK",
+		RefKind: "Host",
+		Pks:     []string{"2"},
+	}))
+	g.Expect(found["DetailB"].Pks).To(gomega.Equal([]string{"20"}))
+	g.Expect(found["DetailC"].Pks).To(gomega.Equal([]string{"31"}))
+	// Repair (null).
+	revision, _ := DB.Revision()
+	report, err = DB.CheckIntegrity(IntegrityOptions{Repair: RepairNull})
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(len(report)).To(gomega.Equal(3))
+	g.Expect(report[0].Repaired).To(gomega.BeTrue())
+	next, _ := DB.Revision()
+	g.Expect(next).To(gomega.Equal(revision + 1))
+	detailE := &DetailE{PK: 2}
+	err = DB.Get(detailE)
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(detailE.FK).To(gomega.Equal(0))
+	err = DB.Get(&DetailC{PK: 30})
+	g.Expect(err).To(gomega.BeNil())
+	report, err = DB.CheckIntegrity(IntegrityOptions{})
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(len(report)).To(gomega.Equal(0))
+	// Repair (delete).
+	err = DB.With(func(tx *Tx) (err error) {
+		for _, m := range []Model{&DetailE{}, &DetailB{}, &DetailC{}} {
+			_, err = tx.Execute("DELETE FROM " + ref.ToKind(m) + ";")
+			if err != nil {
+				return
+			}
+		}
+		return
+	})
+	g.Expect(err).To(gomega.BeNil())
+	insert()
+	report, err = DB.CheckIntegrity(IntegrityOptions{Repair: RepairDelete})
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(len(report)).To(gomega.Equal(3))
+	for _, m := range []Model{&DetailE{PK: 2}, &DetailB{PK: 20}, &DetailC{PK: 30}, &DetailC{PK: 31}} {
+		err = DB.Get(m)
+		g.Expect(errors.Is(err, NotFound)).To(gomega.BeTrue())
 	}
+	err = DB.Get(&DetailE{PK: 3})
+	g.Expect(err).To(gomega.BeNil())
+	report, err = DB.CheckIntegrity(IntegrityOptions{})
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(len(report)).To(gomega.Equal(0))
+	// Not valid.
+	_, err = DB.CheckIntegrity(IntegrityOptions{Repair: 99})
+	g.Expect(err).ToNot(gomega.BeNil())
+}
 
-	mark := time.Now()
+// SQLite variant dialect.
+// Named (@) params and alternate column types.
+type VariantDialect struct {
+	SQLite
+	upserts int
+	mapped  int
+}
 
-	done := make(chan int)
-	fnList := []func(chan int){
-		direct,
-		transaction,
-		read,
-		update,
-		del,
+func (d *VariantDialect) Setup() []string {
+	return []string{"PRAGMA foreign_keys = ON"}
+}
+
+func (d *VariantDialect) Type(kind reflect.Kind) string {
+	switch kind {
+	case reflect.Bool:
+		return "BOOLEAN"
+	case reflect.Int,
+		reflect.Int8,
+		reflect.Int16,
+		reflect.Int32,
+		reflect.Int64:
+		return "BIGINT"
+	default:
+		return "VARCHAR(1024)"
 	}
-	for _, fn := range fnList {
-		go fn(done)
+}
+
+func (d *VariantDialect) Param(name string) string {
+	return "@" + name
+}
+
+func (d *VariantDialect) Upsert(table string, columns, keys, update []string) string {
+	d.upserts++
+	return d.SQLite.Upsert(table, columns, keys, update)
+}
+
+func (d *VariantDialect) MapErr(err error, md *Definition) error {
+	mapped := d.SQLite.MapErr(err, md)
+	if mapped != err {
+		d.mapped++
 	}
-	for range fnList {
-		<-done
+	return mapped
+}
+
+func TestDialect(t *testing.T) {
+	var err error
+	g := gomega.NewGomegaWithT(t)
+	dialect := &VariantDialect{}
+	DB := New(
+		"/tmp/test-dialect.db",
+		&PlainObject{},
+		&DetailA{},
+		&DetailB{},
+		&Zoned{})
+	DB.Dialect(dialect)
+	err = DB.Open(true)
+	g.Expect(err).To(gomega.BeNil())
+	defer func() {
+		_ = DB.Close(true)
+	}()
+	g.Expect(dialect.upserts).To(gomega.Equal(1))
+	// DDL.
+	schema := DB.Schema()
+	m, found := schema.Find("PlainObject")
+	g.Expect(found).To(gomega.BeTrue())
+	g.Expect(m.Fields[0].Type).To(gomega.Equal("BIGINT"))
+	g.Expect(m.Fields[1].Type).To(gomega.Equal("VARCHAR(1024)"))
+	// Not shared with other clients.
+	DB2 := New("/tmp/test-dialect-2.db", &PlainObject{})
+	err = DB2.Open(true)
+	g.Expect(err).To(gomega.BeNil())
+	defer func() {
+		_ = DB2.Close(true)
+	}()
+	schema2 := DB2.Schema()
+	m, found = schema2.Find("PlainObject")
+	g.Expect(found).To(gomega.BeTrue())
+	g.Expect(m.Fields[0].Type).To(gomega.Equal("INTEGER"))
+	err = DB2.Insert(&PlainObject{ID: 1, Name: "Elmer"})
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(dialect.upserts).To(gomega.Equal(1))
+	// CRUD.
+	object := &PlainObject{ID: 1, Name: "Elmer", Age: 18}
+	err = DB.Insert(object)
+	g.Expect(err).To(gomega.BeNil())
+	object.Age = 19
+	err = DB.Update(object)
+	g.Expect(err).To(gomega.BeNil())
+	got := &PlainObject{ID: 1}
+	err = DB.Get(got)
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(got.Age).To(gomega.Equal(19))
+	err = DB.Insert(&Zoned{Zone: "east", ID: 1, Name: "a"})
+	g.Expect(err).To(gomega.BeNil())
+	zoned := &Zoned{Zone: "east", ID: 1}
+	err = DB.Get(zoned)
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(zoned.Name).To(gomega.Equal("a"))
+	// List.
+	list := []PlainObject{}
+	err = DB.List(
+		&list,
+		ListOptions{
+			Predicate: And(Eq("Name", "Elmer"), Gt("Age", 18)),
+		})
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(len(list)).To(gomega.Equal(1))
+	// Graph.
+	err = DB.Insert(&DetailA{PK: 10, FK: 1})
+	g.Expect(err).To(gomega.BeNil())
+	graph, err := DB.Descendants(object, GraphOptions{})
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(len(graph.Nodes)).To(gomega.Equal(2))
+	// Errors.
+	err = DB.Insert(&DetailA{PK: 11, FK: 99})
+	g.Expect(errors.Is(err, FkViolationErr)).To(gomega.BeTrue())
+	g.Expect(dialect.mapped > 0).To(gomega.BeTrue())
+	// Upsert.
+	err = DB.Close(false)
+	g.Expect(err).To(gomega.BeNil())
+	err = DB.Open(false)
+	g.Expect(err).To(gomega.BeNil())
+	// Revision (2) and inserts (4).
+	g.Expect(dialect.upserts).To(gomega.Equal(6))
+	revision, err := DB.Revision()
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(revision).To(gomega.Equal(int64(4)))
+}
+
+type RecordingSink struct {
+	name     string
+	failing  bool
+	received []int64
+	mutex    sync.Mutex
+}
+
+func (s *RecordingSink) Name() string {
+	return s.name
+}
+
+func (s *RecordingSink) Send(batch *Batch) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.failing {
+		return errors.New("failed")
 	}
+	s.received = append(s.received, batch.Revision)
+	return nil
+}
 
-	fmt.Println(time.Since(mark))
+func (s *RecordingSink) revisions() []int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]int64{}, s.received...)
 }
 
-func TestDefinitions(t *testing.T) {
+func TestSink(t *testing.T) {
+	var err error
 	g := gomega.NewGomegaWithT(t)
-	list := Definitions{}
-	// Push
-	list.Push(&Definition{Kind: "0"})
-	list.Push(&Definition{Kind: "1"})
-	list.Push(&Definition{Kind: "2"})
-	g.Expect(list).To(gomega.Equal(
-		Definitions{
-			&Definition{Kind: "0"},
-			&Definition{Kind: "1"},
-			&Definition{Kind: "2"},
-		}))
-	// Pop
-	d2 := list.Pop()
-	g.Expect(d2.Kind).To(gomega.Equal("2"))
-	g.Expect(list).To(gomega.Equal(
-		Definitions{
-			&Definition{Kind: "0"},
-			&Definition{Kind: "1"},
-		}))
-	// Append
-	list.Push(&Definition{Kind: "2"})
-	g.Expect(list).To(gomega.Equal(
-		Definitions{
-			&Definition{Kind: "0"},
-			&Definition{Kind: "1"},
-			&Definition{Kind: "2"},
-		}))
-	// Delete
-	list.Delete(1)
-	g.Expect(list).To(gomega.Equal(
-		Definitions{
-			&Definition{Kind: "0"},
-			&Definition{Kind: "2"},
+	SinkInterval = time.Millisecond * 10
+	SinkRetryDelay = time.Millisecond * 10
+	defer func() {
+		SinkInterval = time.Second
+		SinkRetryDelay = time.Second
+	}()
+	// Webhook.
+	var mutex sync.Mutex
+	failing := 2
+	received := []Batch{}
+	server := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			if failing > 0 {
+				failing--
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			batch := Batch{}
+			err := json.NewDecoder(r.Body).Decode(&batch)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			received = append(received, batch)
 		}))
-	list = Definitions{
-		&Definition{Kind: "0"},
-		&Definition{Kind: "1"},
-		&Definition{Kind: "2"},
+	defer server.Close()
+	revisions := func() (list []int64) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		for _, b := range received {
+			list = append(list, b.Revision)
+		}
+		return
 	}
-	list.Delete(0)
-	g.Expect(list).To(gomega.Equal(
-		Definitions{
-			&Definition{Kind: "1"},
-			&Definition{Kind: "2"},
-		}))
-	list = Definitions{
-		&Definition{Kind: "0"},
-		&Definition{Kind: "1"},
-		&Definition{Kind: "2"},
+	webhook := &WebhookSink{URL: server.URL}
+	// File.
+	path := "/tmp/test-sink.ndjson"
+	for _, p := range []string{path, path + ".1", path + ".2"} {
+		_ = os.Remove(p)
 	}
-	list.Delete(2)
-	g.Expect(list).To(gomega.Equal(
-		Definitions{
-			&Definition{Kind: "0"},
-			&Definition{Kind: "1"},
-		}))
-	// Head and Top.
-	list = Definitions{
-		&Definition{Kind: "0"},
-		&Definition{Kind: "1"},
-		&Definition{Kind: "2"},
+	file := &FileSink{Path: path, MaxSize: 300, MaxFiles: 2}
+	defer func() {
+		_ = file.Close()
+	}()
+	open := func(delete bool) DB {
+		DB := New("/tmp/test-sink.db", &PlainObject{})
+		err := DB.Sink(webhook)
+		g.Expect(err).To(gomega.BeNil())
+		err = DB.Sink(file)
+		g.Expect(err).To(gomega.BeNil())
+		err = DB.Open(delete)
+		g.Expect(err).To(gomega.BeNil())
+		return DB
 	}
-	g.Expect(list.Top().Kind).To(gomega.Equal("2"))
-	g.Expect(list.Head(false).Kind).To(gomega.Equal("0"))
-	g.Expect(list.Head(true).Kind).To(gomega.Equal("0"))
-	g.Expect(list).To(gomega.Equal(
-		Definitions{
-			&Definition{Kind: "1"},
-			&Definition{Kind: "2"},
-		}))
+	DB := open(true)
+	err = DB.Sink(&WebhookSink{URL: server.URL})
+	g.Expect(errors.Is(err, SinkErr)).To(gomega.BeTrue())
+	// Delivered (with retries) in order.
+	for i := 0; i < 3; i++ {
+		err = DB.Insert(&PlainObject{ID: i, Name: "Elmer"})
+		g.Expect(err).To(gomega.BeNil())
+	}
+	err = DB.Update(&PlainObject{ID: 0, Name: "Fudd"})
+	g.Expect(err).To(gomega.BeNil())
+	g.Eventually(revisions, time.Second*5, time.Millisecond*10).Should(
+		gomega.Equal([]int64{1, 2, 3, 4}))
+	mutex.Lock()
+	event := received[3].Events[0]
+	mutex.Unlock()
+	g.Expect(event.Action).To(gomega.Equal("updated"))
+	g.Expect(event.Kind).To(gomega.Equal("PlainObject"))
+	g.Expect(event.Pk).To(gomega.Equal("0"))
+	updated := &PlainObject{}
+	err = json.Unmarshal(event.Updated, updated)
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(updated.Name).To(gomega.Equal("Fudd"))
+	// Outbox pruned.
+	g.Eventually(func() int64 {
+		n, _ := DB.Count(&Outbox{}, nil)
+		return n
+	}, time.Second*5, time.Millisecond*10).Should(gomega.Equal(int64(0)))
+	// File rotated.
+	_, err = os.Stat(path + ".1")
+	g.Expect(err).To(gomega.BeNil())
+	b, err := os.ReadFile(path)
+	g.Expect(err).To(gomega.BeNil())
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	last := Batch{}
+	err = json.Unmarshal([]byte(lines[len(lines)-1]), &last)
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(last.Revision).To(gomega.Equal(int64(4)))
+	// Durable (undelivered) outbox and cursor.
+	mutex.Lock()
+	failing = 1000
+	mutex.Unlock()
+	err = DB.Delete(&PlainObject{ID: 1})
+	g.Expect(err).To(gomega.BeNil())
+	err = DB.Deliver()
+	g.Expect(err).To(gomega.BeNil())
+	err = DB.Close(false)
+	g.Expect(err).To(gomega.BeNil())
+	mutex.Lock()
+	failing = 0
+	mutex.Unlock()
+	// Retained (cursors stored) without sinks.
+	DB = New("/tmp/test-sink.db", &PlainObject{})
+	err = DB.Open(false)
+	g.Expect(err).To(gomega.BeNil())
+	// Retry state stored.
+	cursor := &SinkCursor{Name: webhook.Name()}
+	err = DB.Get(cursor)
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(cursor.Revision).To(gomega.Equal(int64(4)))
+	g.Expect(cursor.Failures > 0).To(gomega.BeTrue())
+	g.Expect(cursor.RetryAt > 0).To(gomega.BeTrue())
+	err = DB.Insert(&PlainObject{ID: 9})
+	g.Expect(err).To(gomega.BeNil())
+	n, err := DB.Count(&Outbox{}, nil)
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(n).To(gomega.Equal(int64(2)))
+	err = DB.Close(false)
+	g.Expect(err).To(gomega.BeNil())
+	DB = open(false)
+	defer func() {
+		_ = DB.Close(true)
+	}()
+	err = DB.Deliver()
+	g.Expect(err).To(gomega.BeNil())
+	g.Eventually(revisions, time.Second*5, time.Millisecond*10).Should(
+		gomega.Equal([]int64{1, 2, 3, 4, 5, 6}))
+	mutex.Lock()
+	g.Expect(received[4].Events[0].Action).To(gomega.Equal("deleted"))
+	g.Expect(received[5].Events[0].Action).To(gomega.Equal("created"))
+	mutex.Unlock()
+	g.Eventually(func() int {
+		cursor := &SinkCursor{Name: webhook.Name()}
+		_ = DB.Get(cursor)
+		return cursor.Failures
+	}, time.Second*5, time.Millisecond*10).Should(gomega.Equal(0))
+	// Registered (after open) at the current revision.
+	late := &RecordingSink{name: "late"}
+	err = DB.Sink(late)
+	g.Expect(err).To(gomega.BeNil())
+	cursor = &SinkCursor{Name: late.Name()}
+	err = DB.Get(cursor)
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(cursor.Revision).To(gomega.Equal(int64(6)))
+	err = DB.Insert(&PlainObject{ID: 10})
+	g.Expect(err).To(gomega.BeNil())
+	g.Eventually(late.revisions, time.Second*5, time.Millisecond*10).Should(
+		gomega.Equal([]int64{7}))
+	// Retention.
+	err = DB.Close(false)
+	g.Expect(err).To(gomega.BeNil())
+	SinkRetention = 2
+	defer func() {
+		SinkRetention = 10000
+	}()
+	DB = open(false)
+	dead := &RecordingSink{name: "dead", failing: true}
+	err = DB.Sink(dead)
+	g.Expect(err).To(gomega.BeNil())
+	for i := 11; i < 14; i++ {
+		err = DB.Insert(&PlainObject{ID: i})
+		g.Expect(err).To(gomega.BeNil())
+	}
+	outboxed := func() int64 {
+		_ = DB.Deliver()
+		n, _ := DB.Count(&Outbox{}, nil)
+		return n
+	}
+	g.Eventually(outboxed, time.Second*5, time.Millisecond*10).Should(
+		gomega.Equal(int64(2)))
+	// Removed.
+	err = DB.RemoveSink(dead.Name())
+	g.Expect(err).To(gomega.BeNil())
+	err = DB.Get(&SinkCursor{Name: dead.Name()})
+	g.Expect(errors.Is(err, NotFound)).To(gomega.BeTrue())
+	err = DB.RemoveSink(dead.Name())
+	g.Expect(errors.Is(err, NotFound)).To(gomega.BeTrue())
+	err = DB.RemoveSink(late.Name())
+	g.Expect(err).To(gomega.BeNil())
+	g.Eventually(outboxed, time.Second*5, time.Millisecond*10).Should(
+		gomega.Equal(int64(0)))
 }
 
-func fieldNames(fields []*Field) (names []string) {
-	for _, f := range fields {
-		names = append(names, f.Name)
+func TestCounter(t *testing.T) {
+	var err error
+	g := gomega.NewGomegaWithT(t)
+	LabelCounters = true
+	defer func() {
+		LabelCounters = false
+	}()
+	DB := New(
+		"/tmp/test-counter.db",
+		&TestObject{},
+		&PlainObject{},
+		&DetailA{})
+	err = DB.Open(true)
+	g.Expect(err).To(gomega.BeNil())
+	// Created.
+	for i, v := range []string{"1", "1", "2"} {
+		err = DB.Insert(
+			&TestObject{
+				ID:     i,
+				Name:   "Elmer",
+				labels: Labels{"a": v},
+			})
+		g.Expect(err).To(gomega.BeNil())
 	}
+	g.Expect(DB.Tally(&TestObject{})).To(gomega.Equal(int64(3)))
+	g.Expect(DB.TallyLabel(&TestObject{}, "a", "1")).To(gomega.Equal(int64(2)))
+	g.Expect(DB.TallyLabel(&TestObject{}, "a", "2")).To(gomega.Equal(int64(1)))
+	// Inserted (existing).
+	err = DB.Insert(&TestObject{ID: 0, Name: "Fudd", labels: Labels{"a": "1"}})
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(DB.Tally(&TestObject{})).To(gomega.Equal(int64(3)))
+	g.Expect(DB.TallyLabel(&TestObject{}, "a", "1")).To(gomega.Equal(int64(2)))
+	// Inserted (existing, label changed).
+	err = DB.Insert(&TestObject{ID: 0, Name: "Fudd", labels: Labels{"a": "3"}})
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(DB.TallyLabel(&TestObject{}, "a", "1")).To(gomega.Equal(int64(1)))
+	g.Expect(DB.TallyLabel(&TestObject{}, "a", "3")).To(gomega.Equal(int64(1)))
+	err = DB.Insert(&TestObject{ID: 0, Name: "Fudd", labels: Labels{"a": "1"}})
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(DB.TallyLabel(&TestObject{}, "a", "1")).To(gomega.Equal(int64(2)))
+	g.Expect(DB.TallyLabel(&TestObject{}, "a", "3")).To(gomega.Equal(int64(0)))
+	// Updated (labels replaced).
+	err = DB.Update(&TestObject{ID: 1, Name: "Elmer", labels: Labels{"a": "2"}})
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(DB.TallyLabel(&TestObject{}, "a", "1")).To(gomega.Equal(int64(1)))
+	g.Expect(DB.TallyLabel(&TestObject{}, "a", "2")).To(gomega.Equal(int64(2)))
+	// Deleted.
+	err = DB.Delete(&TestObject{ID: 2})
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(DB.Tally(&TestObject{})).To(gomega.Equal(int64(2)))
+	g.Expect(DB.TallyLabel(&TestObject{}, "a", "2")).To(gomega.Equal(int64(1)))
+	// Rolled back.
+	tx, err := DB.Begin()
+	g.Expect(err).To(gomega.BeNil())
+	err = tx.Insert(&TestObject{ID: 9})
+	g.Expect(err).To(gomega.BeNil())
+	err = tx.End()
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(DB.Tally(&TestObject{})).To(gomega.Equal(int64(2)))
+	// Cascaded.
+	err = DB.With(func(tx *Tx) (err error) {
+		err = tx.Insert(&PlainObject{ID: 1})
+		if err != nil {
+			return
+		}
+		for i := 0; i < 2; i++ {
+			err = tx.Insert(&DetailA{PK: i, FK: 1})
+			if err != nil {
+				return
+			}
+		}
+		return
+	})
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(DB.Tally(&DetailA{})).To(gomega.Equal(int64(2)))
+	err = DB.Delete(&PlainObject{ID: 1})
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(DB.Tally(&PlainObject{})).To(gomega.Equal(int64(0)))
+	g.Expect(DB.Tally(&DetailA{})).To(gomega.Equal(int64(0)))
+	// Reconciled.
+	tx, err = DB.Begin()
+	g.Expect(err).To(gomega.BeNil())
+	_, err = tx.Execute("INSERT INTO PlainObject (ID, Name, Age) VALUES (7, 'x', 1);")
+	g.Expect(err).To(gomega.BeNil())
+	err = tx.Commit()
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(DB.Tally(&PlainObject{})).To(gomega.Equal(int64(0)))
+	err = DB.Reconcile()
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(DB.Tally(&PlainObject{})).To(gomega.Equal(int64(1)))
+	err = DB.Close(false)
+	g.Expect(err).To(gomega.BeNil())
+	DB = New(
+		"/tmp/test-counter.db",
+		&TestObject{},
+		&PlainObject{},
+		&DetailA{})
+	err = DB.Open(false)
+	g.Expect(err).To(gomega.BeNil())
+	defer func() {
+		_ = DB.Close(true)
+	}()
+	g.Expect(DB.Tally(&TestObject{})).To(gomega.Equal(int64(2)))
+	g.Expect(DB.Tally(&PlainObject{})).To(gomega.Equal(int64(1)))
+	g.Expect(DB.TallyLabel(&TestObject{}, "a", "1")).To(gomega.Equal(int64(1)))
+	g.Expect(DB.TallyLabel(&TestObject{}, "a", "2")).To(gomega.Equal(int64(1)))
+}
 
-	return
+func TestWatchKinds(t *testing.T) {
+	var err error
+	g := gomega.NewGomegaWithT(t)
+	DB := New(
+		"/tmp/test-watch-kinds.db",
+		&DetailA{},
+		&PlainObject{},
+		&Host{})
+	err = DB.Open(true)
+	g.Expect(err).To(gomega.BeNil())
+	defer func() {
+		_ = DB.Close(true)
+	}()
+	err = DB.With(func(tx *Tx) (err error) {
+		err = tx.Insert(&PlainObject{ID: 1})
+		if err != nil {
+			return
+		}
+		err = tx.Insert(&DetailA{PK: 1, FK: 1})
+		if err != nil {
+			return
+		}
+		err = tx.Insert(&Host{ID: 1})
+		return
+	})
+	g.Expect(err).To(gomega.BeNil())
+	// Not in the data model.
+	_, err = DB.WatchKinds(
+		[]Model{&DetailA{}, &DetailB{}},
+		&KindHandler{options: WatchOptions{Snapshot: true}})
+	g.Expect(errors.Is(err, KindErr)).To(gomega.BeTrue())
+	// Kinds.
+	handlerA := &KindHandler{options: WatchOptions{Snapshot: true}}
+	watchA, err := DB.WatchKinds(
+		[]Model{
+			&DetailA{},
+			&PlainObject{},
+		},
+		handlerA)
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(watchA.String()).To(gomega.ContainSubstring("DetailA,PlainObject"))
+	// All kinds.
+	handlerB := &KindHandler{options: WatchOptions{Snapshot: true}}
+	watchB, err := DB.WatchKinds(nil, handlerB)
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(watchB.String()).To(gomega.ContainSubstring("*"))
+	// Changes.
+	err = DB.With(func(tx *Tx) (err error) {
+		err = tx.Insert(&PlainObject{ID: 2})
+		if err != nil {
+			return
+		}
+		err = tx.Insert(&DetailA{PK: 2, FK: 2})
+		return
+	})
+	g.Expect(err).To(gomega.BeNil())
+	err = DB.Insert(&Host{ID: 2})
+	g.Expect(err).To(gomega.BeNil())
+	err = DB.Delete(&PlainObject{ID: 1})
+	g.Expect(err).To(gomega.BeNil())
+	expectedA := []string{
+		"created:PlainObject:1",
+		"created:DetailA:1",
+		"parity",
+		"created:PlainObject:2",
+		"created:DetailA:2",
+		"deleted:DetailA:1",
+		"deleted:PlainObject:1",
+	}
+	expectedB := []string{
+		"created:PlainObject:1",
+		"created:DetailA:1",
+		"created:Host:1",
+		"parity",
+		"created:PlainObject:2",
+		"created:DetailA:2",
+		"created:Host:2",
+		"deleted:DetailA:1",
+		"deleted:PlainObject:1",
+	}
+	for i := 0; i < 100; i++ {
+		if len(handlerA.events()) == len(expectedA) &&
+			len(handlerB.events()) == len(expectedB) {
+			break
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	g.Expect(handlerA.events()).To(gomega.Equal(expectedA))
+	// Independent kinds are not ordered in the snapshot.
+	all := handlerB.events()
+	g.Expect(all).To(gomega.HaveLen(len(expectedB)))
+	g.Expect(all[:4]).To(gomega.ConsistOf(expectedB[:4]))
+	g.Expect(all[3]).To(gomega.Equal("parity"))
+	g.Expect(all[4:]).To(gomega.Equal(expectedB[4:]))
+	parent, child := -1, -1
+	for i, e := range all {
+		switch e {
+		case "created:PlainObject:1":
+			parent = i
+		case "created:DetailA:1":
+			child = i
+		}
+	}
+	g.Expect(parent < child).To(gomega.BeTrue())
+	g.Expect(handlerA.parity).To(gomega.Equal(1))
+	g.Expect(handlerB.parity).To(gomega.Equal(1))
+	DB.EndWatch(watchA)
+	DB.EndWatch(watchB)
 }
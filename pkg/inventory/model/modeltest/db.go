@@ -0,0 +1,239 @@
+/*
+Package modeltest provides an in-memory model.DB for
+consumer (controller) tests.
+
+The DB is a model.Client backed by a (shared) in-memory
+sqlite3 database rather than a file. Supports:
+  - Fault injection. Fail the Nth operation or delay operations.
+  - Recording of executed operations for assertions.
+  - Awaiting specific watch events. See: Recorder.
+
+Example:
+
+	db, err := modeltest.New(&Model{})
+	if err != nil {
+	  ...
+	}
+	defer db.Close(true)
+	db.FailNth(model.OpInsert, 2)
+	db.SlowCommit(time.Second)
+	...
+	recorder := modeltest.NewRecorder(model.WatchOptions{})
+	_, err = db.Watch(&Model{}, recorder)
+	...
+	event, err := recorder.Await(modeltest.OfAction(model.Created), time.Second)
+	...
+	for _, op := range db.Ops() {
+	  ...
+	}
+*/
+package modeltest
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	liberr "github.com/konveyor/controller/pkg/error"
+	"github.com/konveyor/controller/pkg/inventory/model"
+	"github.com/konveyor/controller/pkg/ref"
+)
+
+// Errors.
+var (
+	// Injected fault.
+	InjectedErr = errors.New("injected fault")
+	// Await timed out.
+	TimeoutErr = errors.New("await timed out")
+)
+
+// The sqlite3 busy timeout (milliseconds).
+// The in-memory DB does not support WAL so readers
+// and the writer may contend for locks.
+var BusyTimeout = 10000
+
+// DB serial number.
+// Used to name the in-memory DB.
+var serial uint64
+
+// Fault to be injected.
+type Fault struct {
+	// Operation (insert|update|delete|commit).
+	Op string
+	// Model kind. Empty matches all kinds.
+	Kind string
+	// The Nth matched operation fails (1=first).
+	// (0=never).
+	Nth int
+	// Delay each matched operation.
+	Delay time.Duration
+	// Error returned. Default: InjectedErr.
+	Err error
+	// Number of operations matched.
+	matched int
+}
+
+// Match the operation.
+func (f *Fault) match(op, kind string) bool {
+	return f.Op == op && (f.Kind == "" || f.Kind == kind)
+}
+
+// Executed operation.
+type Op struct {
+	// Operation (insert|update|delete|commit).
+	Name string
+	// Model kind. Empty for commit.
+	Kind string
+	// Model primary key. Empty for commit.
+	Pk string
+	// Error returned.
+	Err error
+}
+
+// String representation.
+func (r Op) String() string {
+	s := r.Name
+	if r.Kind != "" {
+		s += fmt.Sprintf(" %s(%s)", r.Kind, r.Pk)
+	}
+	if r.Err != nil {
+		s += fmt.Sprintf(" err=%s", r.Err.Error())
+	}
+
+	return s
+}
+
+// In-memory DB.
+// Implements model.DB.
+type DB struct {
+	*model.Client
+	// Mutex.
+	mutex sync.Mutex
+	// Injected faults.
+	faults []*Fault
+	// Executed operations.
+	ops []Op
+}
+
+// New in-memory DB.
+// The DB is opened and the schema built to support
+// the specified models.
+func New(models ...interface{}) (db *DB, err error) {
+	path := fmt.Sprintf(
+		"file:/modeltest-%d?vfs=memdb&_busy_timeout=%d",
+		atomic.AddUint64(&serial, 1),
+		BusyTimeout)
+	db = &DB{
+		Client: model.New(path, models...).(*model.Client),
+	}
+	db.Intercept(db)
+	err = db.Open(true)
+	if err != nil {
+		db = nil
+	}
+
+	return
+}
+
+// Inject a fault.
+func (r *DB) Inject(fault Fault) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if fault.Err == nil {
+		fault.Err = InjectedErr
+	}
+	r.faults = append(r.faults, &fault)
+}
+
+// Fail the Nth (insert|update|delete|commit) operation.
+// Counted from when injected.
+func (r *DB) FailNth(op string, n int) {
+	r.Inject(Fault{Op: op, Nth: n})
+}
+
+// Delay each commit.
+func (r *DB) SlowCommit(delay time.Duration) {
+	r.Inject(Fault{Op: model.OpCommit, Delay: delay})
+}
+
+// Clear injected faults.
+func (r *DB) Clear() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.faults = nil
+}
+
+// Executed operations.
+// Operations failed by injected faults are included.
+func (r *DB) Ops() (ops []Op) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	ops = append(ops, r.ops...)
+	return
+}
+
+// Reset the recorded operations.
+func (r *DB) Reset() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.ops = nil
+}
+
+// Before the operation.
+// Injected faults are applied.
+func (r *DB) Before(op string, m model.Model) (err error) {
+	kind := ""
+	if m != nil {
+		kind = ref.ToKind(m)
+	}
+	var delay time.Duration
+	r.mutex.Lock()
+	for _, f := range r.faults {
+		if !f.match(op, kind) {
+			continue
+		}
+		f.matched++
+		delay += f.Delay
+		if f.matched == f.Nth {
+			err = f.Err
+		}
+	}
+	r.mutex.Unlock()
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+	if err != nil {
+		err = liberr.Wrap(
+			err,
+			"op",
+			op,
+			"kind",
+			kind)
+		r.record(op, m, err)
+	}
+
+	return
+}
+
+// After the operation.
+// The operation is recorded.
+func (r *DB) After(op string, m model.Model, err error) {
+	r.record(op, m, err)
+}
+
+// Record the operation.
+func (r *DB) record(op string, m model.Model, err error) {
+	entry := Op{
+		Name: op,
+		Err:  err,
+	}
+	if m != nil {
+		entry.Kind = ref.ToKind(m)
+		entry.Pk = model.ModelPk(m)
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.ops = append(r.ops, entry)
+}
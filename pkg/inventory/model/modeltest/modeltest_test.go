@@ -0,0 +1,128 @@
+package modeltest
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/konveyor/controller/pkg/inventory/model"
+	"github.com/onsi/gomega"
+)
+
+type Thing struct {
+	ID   int    `sql:"pk"`
+	Name string `sql:""`
+}
+
+func (m *Thing) Pk() string {
+	return fmt.Sprintf("%d", m.ID)
+}
+
+func TestDB(t *testing.T) {
+	var err error
+	g := gomega.NewGomegaWithT(t)
+	db, err := New(&Thing{})
+	g.Expect(err).To(gomega.BeNil())
+	defer func() {
+		_ = db.Close(true)
+	}()
+	var _ model.DB = db
+	// Isolated.
+	other, err := New(&Thing{})
+	g.Expect(err).To(gomega.BeNil())
+	defer func() {
+		_ = other.Close(true)
+	}()
+	err = db.Insert(&Thing{ID: 1, Name: "a"})
+	g.Expect(err).To(gomega.BeNil())
+	n, err := other.Count(&Thing{}, nil)
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(n).To(gomega.Equal(int64(0)))
+	// Fail the 2nd insert.
+	db.Reset()
+	db.FailNth(model.OpInsert, 2)
+	err = db.With(func(tx *model.Tx) (err error) {
+		for i := 2; i < 5; i++ {
+			err = tx.Insert(&Thing{ID: i})
+			if err != nil {
+				return
+			}
+		}
+		return
+	})
+	g.Expect(errors.Is(err, InjectedErr)).To(gomega.BeTrue())
+	n, err = db.Count(&Thing{}, nil)
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(n).To(gomega.Equal(int64(1)))
+	ops := db.Ops()
+	g.Expect(len(ops)).To(gomega.Equal(2))
+	g.Expect(ops[0].Name).To(gomega.Equal(model.OpInsert))
+	g.Expect(ops[0].Kind).To(gomega.Equal("Thing"))
+	g.Expect(ops[0].Pk).To(gomega.Equal("2"))
+	g.Expect(ops[0].Err).To(gomega.BeNil())
+	g.Expect(errors.Is(ops[1].Err, InjectedErr)).To(gomega.BeTrue())
+	// Fail the commit.
+	db.Clear()
+	db.FailNth(model.OpCommit, 1)
+	err = db.Insert(&Thing{ID: 2})
+	g.Expect(errors.Is(err, InjectedErr)).To(gomega.BeTrue())
+	err = db.Get(&Thing{ID: 2})
+	g.Expect(errors.Is(err, model.NotFound)).To(gomega.BeTrue())
+	err = db.Insert(&Thing{ID: 2})
+	g.Expect(err).To(gomega.BeNil())
+	// Slow commit.
+	db.Clear()
+	db.SlowCommit(50 * time.Millisecond)
+	mark := time.Now()
+	err = db.Delete(&Thing{ID: 2})
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(time.Since(mark) >= 50*time.Millisecond).To(gomega.BeTrue())
+}
+
+func TestRecorder(t *testing.T) {
+	var err error
+	g := gomega.NewGomegaWithT(t)
+	db, err := New(&Thing{})
+	g.Expect(err).To(gomega.BeNil())
+	defer func() {
+		_ = db.Close(true)
+	}()
+	err = db.Insert(&Thing{ID: 1})
+	g.Expect(err).To(gomega.BeNil())
+	recorder := NewRecorder(model.WatchOptions{Snapshot: true})
+	watch, err := db.Watch(&Thing{}, recorder)
+	g.Expect(err).To(gomega.BeNil())
+	err = recorder.AwaitParity(time.Second)
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(recorder.WatchID()).ToNot(gomega.BeZero())
+	err = db.With(
+		func(tx *model.Tx) (err error) {
+			err = tx.Insert(&Thing{ID: 2})
+			if err != nil {
+				return
+			}
+			err = tx.Update(&Thing{ID: 1, Name: "b"})
+			return
+		},
+		"test")
+	g.Expect(err).To(gomega.BeNil())
+	event, err := recorder.Await(
+		All(OfAction(model.Created), WithPk("2")),
+		time.Second)
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(event.HasLabel("test")).To(gomega.BeTrue())
+	rev, err := db.Revision()
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(event.Revision).To(gomega.Equal(rev))
+	event, err = recorder.Await(WithLabel("test"), time.Second)
+	g.Expect(err).To(gomega.BeNil())
+	g.Expect(event.Action).To(gomega.Equal(model.Updated))
+	g.Expect(event.Updated.(*Thing).Name).To(gomega.Equal("b"))
+	_, err = recorder.Await(OfAction(model.Deleted), 10*time.Millisecond)
+	g.Expect(errors.Is(err, TimeoutErr)).To(gomega.BeTrue())
+	g.Expect(len(recorder.Events())).To(gomega.Equal(3))
+	db.EndWatch(watch)
+	err = recorder.AwaitEnd(time.Second)
+	g.Expect(err).To(gomega.BeNil())
+}
@@ -0,0 +1,237 @@
+package modeltest
+
+import (
+	"sync"
+	"time"
+
+	liberr "github.com/konveyor/controller/pkg/error"
+	"github.com/konveyor/controller/pkg/inventory/model"
+)
+
+// Event matcher.
+type Match func(event model.Event) bool
+
+// Match events by action.
+// The `action` may be a mask. Example:
+//
+//	OfAction(model.Created | model.Updated)
+func OfAction(action uint8) Match {
+	return func(event model.Event) bool {
+		return event.Action&action != 0
+	}
+}
+
+// Match events by model primary key.
+func WithPk(pk string) Match {
+	return func(event model.Event) bool {
+		return event.Model != nil && model.ModelPk(event.Model) == pk
+	}
+}
+
+// Match events by label.
+func WithLabel(label string) Match {
+	return func(event model.Event) bool {
+		return event.HasLabel(label)
+	}
+}
+
+// Match events matched by all matchers.
+func All(matchers ...Match) Match {
+	return func(event model.Event) bool {
+		for _, m := range matchers {
+			if !m(event) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// Event recorder.
+// A watch event handler that records events and
+// supports awaiting specific events.
+type Recorder struct {
+	// Watch options.
+	options model.WatchOptions
+	// Mutex.
+	mutex sync.Mutex
+	// Recorded (model) events.
+	events []model.Event
+	// Index of the next event to be matched by Await().
+	next int
+	// Watch ID.
+	watchID uint64
+	// Watch has parity.
+	parity bool
+	// Watch has ended.
+	ended bool
+	// Errors reported.
+	errors []error
+	// Closed and replaced when changed.
+	changed chan struct{}
+}
+
+// New event recorder.
+func NewRecorder(options model.WatchOptions) *Recorder {
+	return &Recorder{
+		options: options,
+		changed: make(chan struct{}),
+	}
+}
+
+// Await an event.
+// Returns the first matched event recorded after the
+// event returned by the previous call. Returns TimeoutErr
+// when not recorded within the timeout.
+func (r *Recorder) Await(match Match, timeout time.Duration) (event model.Event, err error) {
+	deadline := time.After(timeout)
+	for {
+		r.mutex.Lock()
+		for i := r.next; i < len(r.events); i++ {
+			if match(r.events[i]) {
+				event = r.events[i]
+				r.next = i + 1
+				r.mutex.Unlock()
+				return
+			}
+		}
+		changed := r.changed
+		r.mutex.Unlock()
+		select {
+		case <-changed:
+		case <-deadline:
+			err = liberr.Wrap(TimeoutErr)
+			return
+		}
+	}
+}
+
+// Await parity.
+// Returns TimeoutErr when not reported within the timeout.
+func (r *Recorder) AwaitParity(timeout time.Duration) (err error) {
+	err = r.await(
+		func() bool {
+			return r.parity
+		},
+		timeout)
+	return
+}
+
+// Await the watch has ended.
+// Returns TimeoutErr when not reported within the timeout.
+func (r *Recorder) AwaitEnd(timeout time.Duration) (err error) {
+	err = r.await(
+		func() bool {
+			return r.ended
+		},
+		timeout)
+	return
+}
+
+// Await the condition.
+// The condition is tested while locked.
+func (r *Recorder) await(condition func() bool, timeout time.Duration) (err error) {
+	deadline := time.After(timeout)
+	for {
+		r.mutex.Lock()
+		satisfied := condition()
+		changed := r.changed
+		r.mutex.Unlock()
+		if satisfied {
+			return
+		}
+		select {
+		case <-changed:
+		case <-deadline:
+			err = liberr.Wrap(TimeoutErr)
+			return
+		}
+	}
+}
+
+// Recorded (model) events.
+func (r *Recorder) Events() (events []model.Event) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	events = append(events, r.events...)
+	return
+}
+
+// Errors reported.
+func (r *Recorder) Errors() (errors []error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	errors = append(errors, r.errors...)
+	return
+}
+
+// Watch ID.
+func (r *Recorder) WatchID() uint64 {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.watchID
+}
+
+// Watch options.
+func (r *Recorder) Options() model.WatchOptions {
+	return r.options
+}
+
+// Watch has started.
+func (r *Recorder) Started(watchID uint64) {
+	r.update(func() {
+		r.watchID = watchID
+	})
+}
+
+// Watch has parity.
+func (r *Recorder) Parity() {
+	r.update(func() {
+		r.parity = true
+	})
+}
+
+// A model has been created.
+func (r *Recorder) Created(event model.Event) {
+	r.append(event)
+}
+
+// A model has been updated.
+func (r *Recorder) Updated(event model.Event) {
+	r.append(event)
+}
+
+// A model has been deleted.
+func (r *Recorder) Deleted(event model.Event) {
+	r.append(event)
+}
+
+// An error has occurred delivering an event.
+func (r *Recorder) Error(err error) {
+	r.update(func() {
+		r.errors = append(r.errors, err)
+	})
+}
+
+// An event watch has ended.
+func (r *Recorder) End() {
+	r.update(func() {
+		r.ended = true
+	})
+}
+
+// Record the event.
+func (r *Recorder) append(event model.Event) {
+	r.update(func() {
+		r.events = append(r.events, event)
+	})
+}
+
+// Update the recorder and notify waiters.
+func (r *Recorder) update(fn func()) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	fn()
+	close(r.changed)
+	r.changed = make(chan struct{})
+}
@@ -3,7 +3,11 @@ package model
 import (
 	"bytes"
 	liberr "github.com/konveyor/controller/pkg/error"
+	liblabels "k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
 	"reflect"
+	"sort"
+	"strconv"
 	"strings"
 	"text/template"
 )
@@ -11,20 +15,31 @@ import (
 // Label SQL.
 var LabelSQL = `
 {{ $kind := .Kind -}}
-{{ if .Len }}
-{{ .Pk.Name }} IN
+{{ $pk := .PkExpr -}}
+{{ if .Len -}}
 (
-{{ range $i,$l := .List -}}
+{{ range $i,$r := .List -}}
 {{ if $i }}
-INTERSECT
+AND
 {{ end -}}
+{{ $pk }} {{ if $r.Negated }}NOT {{ end }}IN
+(
 SELECT parent
 FROM Label
 WHERE kind = '{{ $kind }}' AND
-name = {{ $l.Name }} AND
-value = {{ $l.Value }}
+name = {{ $r.Name }}
+{{ if $r.Compare -}}
+AND (value GLOB '[0-9]*' OR value GLOB '-[0-9]*')
+AND substr(value, 2) NOT GLOB '*[^0-9]*'
+AND CAST(value AS INTEGER) {{ $r.Compare }} {{ index $r.Values 0 }}
+{{ else if $r.Values -}}
+AND value IN ({{ range $j,$v := $r.Values }}{{ if $j }},{{ end }}{{ $v }}{{ end }})
+{{ end -}}
+)
 {{ end -}}
 )
+{{ else -}}
+1 = 1
 {{ end -}}
 `
 
@@ -93,6 +108,37 @@ func Match(labels Labels) *LabelPredicate {
 	}
 }
 
+// Label selector predicate.
+func MatchSelector(selector liblabels.Selector) *LabelPredicate {
+	return &LabelPredicate{
+		Selector: selector,
+	}
+}
+
+// Label selector predicate.
+// Parse the (k8s) label selector syntax.
+// Example: env in (prod,stage),!deprecated
+func ParseSelector(selector string) (p *LabelPredicate, err error) {
+	parsed, err := liblabels.Parse(selector)
+	if err != nil {
+		err = liberr.Wrap(
+			err,
+			"selector",
+			selector)
+		return
+	}
+	p = MatchSelector(parsed)
+	return
+}
+
+// Related (many-to-many) predicate.
+func Related(join Model, model Model) *RelatedPredicate {
+	return &RelatedPredicate{
+		Join:  join,
+		Model: model,
+	}
+}
+
 // List predicate.
 type Predicate interface {
 	// Build the predicate.
@@ -163,45 +209,50 @@ func (p *SimplePredicate) build(operator string, options *FilterOptions) error {
 	return nil
 }
 
-// Equals (=) predicate.
-type EqPredicate struct {
-	SimplePredicate
-}
-
-// Build.
-func (p *EqPredicate) Build(options *FilterOptions) error {
+// Build (list).
+// The value is a slice.
+func (p *SimplePredicate) buildList(operator string, options *FilterOptions) error {
 	f, found := p.match(options.fields)
 	if !found {
 		return liberr.Wrap(PredicateRefErr)
 	}
 	pv := reflect.ValueOf(p.Value)
-	switch pv.Kind() {
-	case reflect.Slice:
-		params := []string{}
-		for i := 0; i < pv.Len(); i++ {
-			v, err := f.AsValue(pv.Index(i).Interface())
-			if err != nil {
-				return err
-			}
-			params = append(
-				params,
-				options.Param(f.Name, v))
+	params := []string{}
+	for i := 0; i < pv.Len(); i++ {
+		v, err := f.AsValue(pv.Index(i).Interface())
+		if err != nil {
+			return err
 		}
-		p.expr = strings.Join(
-			[]string{
-				f.Name,
-				"IN",
-				"(",
-				strings.Join(params, ","),
-				")"},
-			" ")
-	default:
-		return p.build("=", options)
+		params = append(
+			params,
+			options.Param(f.Name, v))
 	}
+	p.expr = strings.Join(
+		[]string{
+			f.Name,
+			operator,
+			"(",
+			strings.Join(params, ","),
+			")"},
+		" ")
 
 	return nil
 }
 
+// Equals (=) predicate.
+type EqPredicate struct {
+	SimplePredicate
+}
+
+// Build.
+func (p *EqPredicate) Build(options *FilterOptions) error {
+	if reflect.ValueOf(p.Value).Kind() == reflect.Slice {
+		return p.buildList("IN", options)
+	}
+
+	return p.build("=", options)
+}
+
 // Render the expression.
 func (p *EqPredicate) Expr() string {
 	return p.expr
@@ -213,7 +264,12 @@ type NeqPredicate struct {
 }
 
 // Build.
+// A list (slice) value is rendered as NOT IN.
 func (p *NeqPredicate) Build(options *FilterOptions) error {
+	if reflect.ValueOf(p.Value).Kind() == reflect.Slice {
+		return p.buildList("NOT IN", options)
+	}
+
 	return p.build("!=", options)
 }
 
@@ -233,7 +289,7 @@ func (p *GtPredicate) Build(options *FilterOptions) error {
 	if !found {
 		return liberr.Wrap(PredicateRefErr)
 	}
-	switch f.Value.Kind() {
+	switch f.kind() {
 	case reflect.String,
 		reflect.Bool:
 		return PredicateTypeErr
@@ -241,7 +297,9 @@ func (p *GtPredicate) Build(options *FilterOptions) error {
 		reflect.Int8,
 		reflect.Int16,
 		reflect.Int32,
-		reflect.Int64:
+		reflect.Int64,
+		reflect.Float32,
+		reflect.Float64:
 		return p.build(">", options)
 	default:
 		return FieldTypeErr
@@ -264,7 +322,7 @@ func (p *LtPredicate) Build(options *FilterOptions) error {
 	if !found {
 		return liberr.Wrap(PredicateRefErr)
 	}
-	switch f.Value.Kind() {
+	switch f.kind() {
 	case reflect.String,
 		reflect.Bool:
 		return PredicateTypeErr
@@ -272,7 +330,9 @@ func (p *LtPredicate) Build(options *FilterOptions) error {
 		reflect.Int8,
 		reflect.Int16,
 		reflect.Int32,
-		reflect.Int64:
+		reflect.Int64,
+		reflect.Float32,
+		reflect.Float64:
 		return p.build("<", options)
 	default:
 		return FieldTypeErr
@@ -344,18 +404,27 @@ func (p *OrPredicate) Expr() string {
 	}
 
 	expr := strings.Join(predicates, " OR ")
+	if len(predicates) > 1 {
+		expr = "(" + expr + ")"
+	}
 
 	return expr
 }
 
 // Label predicate.
+// Matches models by label using both the (equality)
+// labels and the (set-based) selector.
 type LabelPredicate struct {
 	// Labels
 	Labels
+	// Selector.
+	Selector liblabels.Selector
 	// List options.
 	options *FilterOptions
 	// Parent PK field name.
 	pk *Field
+	// Built requirements.
+	requirements []LabelRequirement
 	// SQL expression.
 	expr string
 }
@@ -369,8 +438,12 @@ func (p *LabelPredicate) Build(options *FilterOptions) error {
 			break
 		}
 	}
+	err := p.buildRequirements()
+	if err != nil {
+		return err
+	}
 	tpl := template.New("")
-	tpl, err := tpl.Parse(LabelSQL)
+	tpl, err = tpl.Parse(LabelSQL)
 	if err != nil {
 		return liberr.Wrap(err)
 	}
@@ -395,29 +468,198 @@ func (p *LabelPredicate) Pk() *Field {
 	return p.pk
 }
 
-// List of labels.
-func (p *LabelPredicate) List() []Label {
-	list := []Label{}
-	for k, v := range p.Labels {
-		k = p.options.Param("k", k)
-		v = p.options.Param("v", v)
-		list = append(
-			list,
-			Label{
-				Name:  k,
-				Value: v,
-			})
-	}
+// PK (SQL) expression.
+// Composite keys are the joined pk columns.
+func (p *LabelPredicate) PkExpr() string {
+	return pkExpr(p.options.fields)
+}
 
-	return list
+// List of requirements.
+func (p *LabelPredicate) List() []LabelRequirement {
+	return p.requirements
 }
 
-// Get the number of labels.
+// Get the number of requirements.
 func (p *LabelPredicate) Len() int {
-	return len(p.Labels)
+	return len(p.requirements)
 }
 
 // Render the expression.
 func (p *LabelPredicate) Expr() string {
 	return p.expr
 }
+
+// Build the requirements.
+// The labels are (sorted) equality requirements.
+// The label and value params are added to the options.
+func (p *LabelPredicate) buildRequirements() (err error) {
+	p.requirements = []LabelRequirement{}
+	keys := []string{}
+	for k := range p.Labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		p.requirements = append(
+			p.requirements,
+			LabelRequirement{
+				Name:     p.options.Param("k", k),
+				Operator: selection.Equals,
+				Values: []string{
+					p.options.Param("v", p.Labels[k]),
+				},
+			})
+	}
+	if p.Selector == nil {
+		return
+	}
+	selected, selectable := p.Selector.Requirements()
+	if !selectable {
+		err = liberr.Wrap(
+			PredicateValueErr,
+			"selector",
+			p.Selector.String())
+		return
+	}
+	for _, r := range selected {
+		requirement := LabelRequirement{
+			Name:     p.options.Param("k", r.Key()),
+			Operator: r.Operator(),
+		}
+		switch r.Operator() {
+		case selection.Exists,
+			selection.DoesNotExist:
+		case selection.GreaterThan,
+			selection.LessThan:
+			values := r.Values().List()
+			if len(values) != 1 {
+				err = liberr.Wrap(
+					PredicateValueErr,
+					"requirement",
+					r.String())
+				return
+			}
+			n, pErr := strconv.ParseInt(values[0], 10, 64)
+			if pErr != nil {
+				err = liberr.Wrap(
+					PredicateValueErr,
+					"requirement",
+					r.String())
+				return
+			}
+			requirement.Values = []string{
+				p.options.Param("v", n),
+			}
+		case selection.Equals,
+			selection.DoubleEquals,
+			selection.In,
+			selection.NotEquals,
+			selection.NotIn:
+			for _, v := range r.Values().List() {
+				requirement.Values = append(
+					requirement.Values,
+					p.options.Param("v", v))
+			}
+		default:
+			err = liberr.Wrap(
+				PredicateOperatorErr,
+				"operator",
+				r.Operator())
+			return
+		}
+		p.requirements = append(p.requirements, requirement)
+	}
+
+	return
+}
+
+// Label requirement.
+// The name and values are SQL params.
+type LabelRequirement struct {
+	// Label name.
+	Name string
+	// Operator.
+	Operator selection.Operator
+	// Label values.
+	Values []string
+}
+
+// Get whether the requirement is negated.
+// The `!=` and `notin` operators match models without the
+// label (k8s semantics) so are rendered as NOT IN.
+func (r LabelRequirement) Negated() bool {
+	switch r.Operator {
+	case selection.NotEquals,
+		selection.NotIn,
+		selection.DoesNotExist:
+		return true
+	}
+
+	return false
+}
+
+// Get the (integer) comparison operator.
+// Returns: empty when not applicable.
+func (r LabelRequirement) Compare() string {
+	switch r.Operator {
+	case selection.GreaterThan:
+		return ">"
+	case selection.LessThan:
+		return "<"
+	}
+
+	return ""
+}
+
+// Related (many-to-many) predicate.
+// Matches models related to the `Model` through
+// the `Join` model. For self-joins, the model is
+// matched using the first `+join` FK.
+type RelatedPredicate struct {
+	// Join model.
+	Join Model
+	// Related model.
+	Model Model
+	// SQL expression.
+	expr string
+}
+
+// Build.
+func (p *RelatedPredicate) Build(options *FilterOptions) (err error) {
+	md, err := Inspect(p.Join)
+	if err != nil {
+		return
+	}
+	kind := md.kind(p.Model)
+	fkModel, fkTarget, err := md.Joined(kind, options.table)
+	if err != nil {
+		return
+	}
+	v, err := fkModel.Owner.AsValue(ModelPk(p.Model))
+	if err != nil {
+		return
+	}
+	p.expr = strings.Join(
+		[]string{
+			pkExpr(options.fields),
+			"IN",
+			"(",
+			"SELECT",
+			fkTarget.Owner.Name,
+			"FROM",
+			md.Kind,
+			"WHERE",
+			fkModel.Owner.Name,
+			"=",
+			options.Param(fkModel.Owner.Name, v),
+			")",
+		},
+		" ")
+
+	return
+}
+
+// Render the expression.
+func (p *RelatedPredicate) Expr() string {
+	return p.expr
+}
@@ -0,0 +1,281 @@
+package model
+
+import (
+	"sync"
+
+	liberr "github.com/konveyor/controller/pkg/error"
+	fb "github.com/konveyor/controller/pkg/filebacked"
+	"github.com/konveyor/controller/pkg/ref"
+)
+
+// Projection.
+// Maintains derived (materialized) models from changes
+// to source models. Apply() is called with the events staged
+// by the transaction before it is committed. Derived models
+// are written using the transaction and are committed (or
+// rolled back) with the source changes. Events staged by
+// projections are not passed to projections.
+//
+// Example:
+//
+//	err := DB.Project(Projection{
+//	  Name:    "host-vm-count",
+//	  Sources: []Model{&VM{}},
+//	  Derived: []Model{&HostSummary{}},
+//	  Apply: func(tx *Tx, events []Event) (err error) {
+//	    ...
+//	  },
+//	})
+type Projection struct {
+	// Name (unique).
+	Name string
+	// Source models.
+	// Only events for source models are passed to Apply().
+	Sources []Model
+	// Derived models.
+	// Deleted on rebuild.
+	Derived []Model
+	// Apply changes to derived models.
+	Apply func(tx *Tx, events []Event) error
+	// Build the derived models from scratch (optional).
+	// Called on rebuild after the derived models have been
+	// deleted. When not specified, Apply() is called with
+	// a `Created` event for each source model.
+	Build func(tx *Tx) error
+}
+
+// Source event.
+func (r *Projection) match(event *Event) (matched bool) {
+	kind := ref.ToKind(event.Model)
+	for _, m := range r.Sources {
+		if ref.ToKind(m) == kind {
+			matched = true
+			break
+		}
+	}
+
+	return
+}
+
+// Validate.
+func (r *Projection) validate(registered []*Projection) (err error) {
+	if r.Name == "" || r.Apply == nil || len(r.Sources) == 0 {
+		err = liberr.Wrap(
+			ProjectionErr,
+			"name",
+			r.Name)
+		return
+	}
+	for _, p := range registered {
+		if p.Name == r.Name {
+			err = liberr.Wrap(
+				ProjectionErr,
+				"reason",
+				"duplicate",
+				"name",
+				r.Name)
+			return
+		}
+	}
+
+	return
+}
+
+// Registered projections.
+// The list is replaced (copy-on-write) on registration so
+// transactions keep the projections registered when started.
+type projections struct {
+	// Registered.
+	registered []*Projection
+	// Protect the list.
+	mutex sync.RWMutex
+}
+
+// Register a projection.
+func (r *projections) add(projection *Projection) (err error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	err = projection.validate(r.registered)
+	if err != nil {
+		return
+	}
+	list := make([]*Projection, 0, len(r.registered)+1)
+	list = append(list, r.registered...)
+	r.registered = append(list, projection)
+	return
+}
+
+// The registered projections.
+func (r *projections) list() []*Projection {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.registered
+}
+
+// Register a projection.
+// Transactions already started are not affected.
+func (r *Client) Project(projection Projection) (err error) {
+	err = r.projections.add(&projection)
+	if err != nil {
+		return
+	}
+
+	r.log.V(3).Info(
+		"projection registered.",
+		"name",
+		projection.Name)
+
+	return
+}
+
+// Rebuild projections.
+// The derived models are deleted and built from scratch
+// in a single transaction. All projections are rebuilt
+// when none specified.
+func (r *Client) Rebuild(names ...string) (err error) {
+	registered := r.projections.list()
+	wanted := map[string]bool{}
+	for _, name := range names {
+		found := false
+		for _, p := range registered {
+			if p.Name == name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			err = liberr.Wrap(
+				ProjectionErr,
+				"reason",
+				"not found",
+				"name",
+				name)
+			return
+		}
+		wanted[name] = true
+	}
+	err = r.With(func(tx *Tx) (err error) {
+		for _, p := range registered {
+			if len(wanted) > 0 && !wanted[p.Name] {
+				continue
+			}
+			err = tx.rebuild(p)
+			if err != nil {
+				return
+			}
+		}
+		return
+	})
+	if err != nil {
+		return
+	}
+
+	r.log.V(3).Info(
+		"projections rebuilt.",
+		"names",
+		names)
+
+	return
+}
+
+// Apply projections.
+// Called before commit.
+func (r *Tx) project() (err error) {
+	if len(r.projections) == 0 || r.staged.Len() == 0 {
+		return
+	}
+	matched := make([][]Event, len(r.projections))
+	itr := r.staged.Iter()
+	defer itr.Close()
+	for {
+		event := Event{}
+		if !event.next(itr) {
+			break
+		}
+		for i, p := range r.projections {
+			if p.match(&event) {
+				matched[i] = append(matched[i], event)
+			}
+		}
+	}
+	for i, p := range r.projections {
+		matched := matched[i]
+		if len(matched) == 0 {
+			continue
+		}
+		err = p.Apply(r, matched)
+		if err != nil {
+			err = liberr.Wrap(
+				err,
+				"projection",
+				p.Name)
+			return
+		}
+	}
+
+	return
+}
+
+// Rebuild the projection.
+func (r *Tx) rebuild(p *Projection) (err error) {
+	for _, m := range p.Derived {
+		var itr fb.Iterator
+		itr, err = r.Find(m, ListOptions{Detail: MaxDetail})
+		if err != nil {
+			return
+		}
+		for {
+			object, hasNext := itr.Next()
+			if !hasNext {
+				break
+			}
+			err = r.Delete(object.(Model))
+			if err != nil {
+				itr.Close()
+				return
+			}
+		}
+		itr.Close()
+	}
+	if p.Build != nil {
+		err = p.Build(r)
+		if err != nil {
+			err = liberr.Wrap(
+				err,
+				"projection",
+				p.Name)
+		}
+		return
+	}
+	events := []Event{}
+	for _, m := range p.Sources {
+		var itr fb.Iterator
+		itr, err = r.Find(m, ListOptions{Detail: MaxDetail})
+		if err != nil {
+			return
+		}
+		for {
+			object, hasNext := itr.Next()
+			if !hasNext {
+				break
+			}
+			events = append(
+				events,
+				Event{
+					Action:   Created,
+					Model:    object.(Model),
+					Revision: r.revision,
+				})
+		}
+		itr.Close()
+	}
+	err = p.Apply(r, events)
+	if err != nil {
+		err = liberr.Wrap(
+			err,
+			"projection",
+			p.Name)
+	}
+
+	return
+}
@@ -27,6 +27,15 @@ func (r *FkRelation) DDL(md *Definition) (ddl []string, err error) {
 				fk.Table)
 			return
 		}
+		if md.IsComposite() {
+			err = liberr.Wrap(
+				CompositePkErr,
+				"kind",
+				md.Kind,
+				"reason",
+				"+must FK references composite PK.")
+			return
+		}
 		pk := md.PkField()
 		fk.Field = pk.Name
 		ddl = append(ddl, fk.DDL(field))
@@ -51,9 +60,11 @@ func (r *FkRelation) Referencing(md *Definition) (list []*FkRef) {
 			list = append(
 				list,
 				&FkRef{
-					field:   field.Name,
-					cascade: fk.Cascade,
-					md:      refMd,
+					field:    field.Name,
+					cascade:  fk.cascaded(),
+					setNull:  fk.SetNull,
+					restrict: fk.Restrict,
+					md:       refMd,
 				})
 		}
 	}
@@ -124,6 +135,10 @@ type FkRef struct {
 	field string
 	// Cascade
 	cascade bool
+	// Set null.
+	setNull bool
+	// Restrict.
+	restrict bool
 	// Model definition.
 	md *Definition
 }
@@ -0,0 +1,110 @@
+package model
+
+import (
+	"database/sql"
+	"fmt"
+
+	liberr "github.com/konveyor/controller/pkg/error"
+)
+
+// Revision (table).
+const (
+	revisionKind = "Revision"
+	revisionID   = 0
+)
+
+// Durable commit revision.
+// A single row incremented (once) by each transaction
+// with changes. Monotonically increasing and preserved
+// across restarts.
+type Revision struct {
+	ID    int   `sql:"pk"`
+	Value int64 `sql:""`
+}
+
+func (m *Revision) Pk() string {
+	return fmt.Sprintf("%d", m.ID)
+}
+
+// Get the current (committed) revision.
+func (r *Client) Revision() (revision int64, err error) {
+	session := r.pool.Reader()
+	defer session.Return()
+	m := &Revision{ID: revisionID}
+	err = r.table(session.db).Get(m)
+	if err != nil {
+		return
+	}
+
+	revision = m.Value
+
+	return
+}
+
+// Create the revision (row) as needed.
+func (r *Client) buildRevision(session *Session) (err error) {
+	_, err = session.db.Exec(
+		dialectOf(r.dialect).Upsert(
+			revisionKind,
+			[]string{"ID", "Value"},
+			[]string{"ID"},
+			nil),
+		sql.Named("ID", revisionID),
+		sql.Named("Value", 0))
+	if err != nil {
+		err = liberr.Wrap(err)
+	}
+
+	return
+}
+
+// Get the transaction revision.
+// Zero until the first change.
+func (r *Tx) Revision() int64 {
+	return r.revision
+}
+
+// Increment the revision.
+// Performed (once) on the first change. The increment
+// is committed (or rolled back) with the transaction.
+func (r *Tx) bump() (err error) {
+	if r.revision > 0 {
+		return
+	}
+	id := sql.Named("ID", revisionID)
+	where := " WHERE ID = " + dialectOf(r.dialect).Param("ID") + ";"
+	_, err = r.real.Exec(
+		"UPDATE "+revisionKind+" SET Value = Value + 1"+where,
+		id)
+	if err != nil {
+		err = liberr.Wrap(mapErr(r.dialect, err, nil))
+		return
+	}
+	row := r.real.QueryRow(
+		"SELECT Value FROM "+revisionKind+where,
+		id)
+	err = row.Scan(&r.revision)
+	if err != nil {
+		err = liberr.Wrap(mapErr(r.dialect, err, nil))
+	}
+
+	return
+}
+
+// Stamp the model with the transaction revision.
+// Sets the `revision` field when defined.
+func (r *Tx) stamp(model Model) (err error) {
+	err = r.bump()
+	if err != nil {
+		return
+	}
+	md, err := Inspect(model)
+	if err != nil {
+		return
+	}
+	if f := md.RevisionField(); f != nil {
+		f.Value.SetInt(r.revision)
+	}
+
+	return
+}
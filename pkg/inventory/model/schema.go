@@ -0,0 +1,151 @@
+package model
+
+import "sort"
+
+// Schema.
+// A serializable description of the data model.
+type Schema struct {
+	// Model (table) descriptions.
+	Models []ModelSchema `json:"models"`
+}
+
+// Find a model description by kind.
+func (r *Schema) Find(kind string) (m *ModelSchema, found bool) {
+	for i := range r.Models {
+		if r.Models[i].Kind == kind {
+			m = &r.Models[i]
+			found = true
+			break
+		}
+	}
+
+	return
+}
+
+// Model (table) description.
+type ModelSchema struct {
+	// Model kind (table name).
+	Kind string `json:"kind"`
+	// Many-to-many join model.
+	Join bool `json:"join,omitempty"`
+	// Field (column) descriptions.
+	Fields []FieldSchema `json:"fields"`
+}
+
+// Field (column) description.
+type FieldSchema struct {
+	// Field (column) name.
+	Name string `json:"name"`
+	// SQL type.
+	Type string `json:"type"`
+	// Primary key.
+	Pk bool `json:"pk,omitempty"`
+	// Natural key.
+	Key bool `json:"key,omitempty"`
+	// Unique index (group) names.
+	Unique []string `json:"unique,omitempty"`
+	// Non-unique index (group) names.
+	Index []string `json:"index,omitempty"`
+	// Foreign key.
+	Fk *FkSchema `json:"fk,omitempty"`
+	// Immutable.
+	Const bool `json:"const,omitempty"`
+	// Read-only and managed by the DB.
+	Virtual bool `json:"virtual,omitempty"`
+	// Auto-incremented.
+	Incremented bool `json:"incremented,omitempty"`
+	// Expiry TTL.
+	TTL string `json:"ttl,omitempty"`
+	// Stamped with the commit revision.
+	Revision bool `json:"revision,omitempty"`
+	// Detail level.
+	Detail int `json:"detail"`
+}
+
+// Foreign key description.
+type FkSchema struct {
+	// Referenced kind.
+	Kind string `json:"kind"`
+	// Referenced (pk) field.
+	Field string `json:"field,omitempty"`
+	// +must.
+	Must bool `json:"must,omitempty"`
+	// +cascade.
+	Cascade bool `json:"cascade,omitempty"`
+	// +join.
+	Join bool `json:"join,omitempty"`
+	// +setnull.
+	SetNull bool `json:"setnull,omitempty"`
+	// +restrict.
+	Restrict bool `json:"restrict,omitempty"`
+}
+
+// Build the schema.
+// Models are sorted by kind. The internal
+// tables are excluded.
+func (r *DataModel) Schema() (schema Schema) {
+	schema.Models = []ModelSchema{}
+	for _, md := range r.Definitions() {
+		if internal(md.Kind) {
+			continue
+		}
+		m := ModelSchema{
+			Kind:   md.Kind,
+			Join:   md.IsJoin(),
+			Fields: []FieldSchema{},
+		}
+		for _, f := range md.Fields {
+			m.Fields = append(m.Fields, r.fieldSchema(f))
+		}
+		schema.Models = append(schema.Models, m)
+	}
+	sort.Slice(
+		schema.Models,
+		func(i, j int) bool {
+			return schema.Models[i].Kind < schema.Models[j].Kind
+		})
+
+	return
+}
+
+// Build the field description.
+func (r *DataModel) fieldSchema(f *Field) (fs FieldSchema) {
+	fs = FieldSchema{
+		Name:        f.Name,
+		Type:        f.SqlType(),
+		Pk:          f.Pk(),
+		Key:         f.Key(),
+		Const:       !f.Mutable(),
+		Virtual:     f.Virtual(),
+		Incremented: f.Incremented(),
+		Revision:    f.Revisioned(),
+		Detail:      f.Detail(),
+	}
+	if unique := f.Unique(); len(unique) > 0 {
+		fs.Unique = unique
+	}
+	if index := f.Index(); len(index) > 0 {
+		fs.Index = index
+	}
+	if ttl, found := f.TTL(); found {
+		fs.TTL = ttl.String()
+	}
+	if fk := f.Fk(); fk != nil {
+		fs.Fk = &FkSchema{
+			Kind:     fk.Table,
+			Must:     fk.Must,
+			Cascade:  fk.Cascade,
+			Join:     fk.Join,
+			SetNull:  fk.SetNull,
+			Restrict: fk.Restrict,
+		}
+		if md, found := r.Find(fk.Table); found {
+			fs.Fk.Kind = md.Kind
+			if pk := md.PkField(); pk != nil && !md.IsComposite() {
+				fs.Fk.Field = pk.Name
+			}
+		}
+	}
+
+	return
+}
@@ -2,8 +2,15 @@ package model
 
 import (
 	"database/sql"
+	"fmt"
+	"io"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
 	liberr "github.com/konveyor/controller/pkg/error"
-	_ "github.com/mattn/go-sqlite3"
 )
 
 // DB session.
@@ -11,36 +18,81 @@ import (
 type Session struct {
 	// ID.
 	id int
+	// Role (writer|reader).
+	role string
 	// Return the session to the pool.
 	returner func()
 	// DB connection.
 	db *sql.DB
+	// SQL dialect.
+	dialect Dialect
 	// DB transaction history.
 	tx []*sql.Tx
 	// Closed indicator.
 	closed bool
+	// Aborted by the pool.
+	aborted bool
+	// Protect the reservation.
+	mutex sync.Mutex
 }
 
 // Return the session to the pool.
 // After is has been returned, it MUST no longer be used.
+// Returning an aborted session has no effect.
 func (s *Session) Return() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.aborted {
+		return
+	}
 	s.assertReserved()
-	s.returner()
+	returner := s.returner
 	s.returner = nil
+	returner()
 }
 
 // Begin a transaction.
 func (s *Session) Begin() (tx *sql.Tx, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.aborted {
+		err = liberr.Wrap(TxAbortedErr)
+		return
+	}
 	s.assertReserved()
 	tx, err = s.db.Begin()
 	if err != nil {
-		err = liberr.Wrap(err)
+		err = liberr.Wrap(mapErr(s.dialect, err, nil))
 	}
 	s.tx = append(s.tx, tx)
 
 	return
 }
 
+// The session has been aborted by the pool.
+func (s *Session) Aborted() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.aborted
+}
+
+// Abort.
+// Transactions are rolled back and the session
+// returned to the pool.
+func (s *Session) abort() (aborted bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.aborted || s.returner == nil {
+		return
+	}
+	s.aborted = true
+	returner := s.returner
+	s.returner = nil
+	returner()
+	aborted = true
+	return
+}
+
 // Assert reserved.
 // Ensure the session has been reserved and not
 // yet returned.
@@ -62,8 +114,79 @@ func (s *Session) reset() {
 	s.tx = nil
 }
 
+// Session reservation.
+type reservation struct {
+	// The reserved session.
+	session *Session
+	// Reserved timestamp.
+	mark time.Time
+	// Caller stack (program counters).
+	callers []uintptr
+	// Reported held past the threshold.
+	reported bool
+}
+
+// Caller stack.
+func (r *reservation) stack() (stack []string) {
+	frames := runtime.CallersFrames(r.callers)
+	for {
+		frame, more := frames.Next()
+		stack = append(
+			stack,
+			fmt.Sprintf(
+				"%s() %s:%d",
+				frame.Function,
+				frame.File,
+				frame.Line))
+		if !more {
+			break
+		}
+	}
+
+	return
+}
+
+// Session state.
+type SessionState struct {
+	// Session ID.
+	ID int
+	// Role (writer|reader).
+	Role string
+	// Reserved.
+	Reserved bool
+	// Time reserved.
+	Age time.Duration
+	// Open transactions.
+	Tx int
+	// Caller stack when reserved.
+	Stack []string
+}
+
+// String representation.
+func (r SessionState) String() string {
+	if !r.Reserved {
+		return fmt.Sprintf(
+			"session-%.2d: %s free",
+			r.ID,
+			r.Role)
+	}
+	s := fmt.Sprintf(
+		"session-%.2d: %s reserved age=%s tx=%d",
+		r.ID,
+		r.Role,
+		r.Age,
+		r.Tx)
+	for _, frame := range r.Stack {
+		s += "\n\t" + frame
+	}
+
+	return s
+}
+
 // Session pool.
 type Pool struct {
+	// SQL dialect.
+	dialect Dialect
 	// Journal.
 	journal *Journal
 	// All sessions.
@@ -73,6 +196,10 @@ type Pool struct {
 		writer chan *Session
 		reader chan *Session
 	}
+	// Reservations by session ID.
+	reserved map[int]*reservation
+	// Protect reservations.
+	mutex sync.Mutex
 }
 
 // Open the pool.
@@ -88,20 +215,17 @@ func (p *Pool) Open(nWriter, nReader int, path string, journal *Journal) (err er
 		}
 	}()
 	p.journal = journal
+	p.reserved = make(map[int]*reservation)
 	total := nWriter + nReader
 	p.next.writer = make(chan *Session, nWriter)
 	p.next.reader = make(chan *Session, nReader)
 	for id := 0; id < total; id++ {
-		session := &Session{id: id}
-		session.db, err = sql.Open("sqlite3", path)
+		session := &Session{id: id, dialect: p.dialect}
+		session.db, err = sql.Open(dialectOf(p.dialect).Driver(), path)
 		if err != nil {
 			return
 		}
-		pragma := []string{
-			"PRAGMA foreign_keys = ON",
-			"PRAGMA journal_mode = WAL",
-		}
-		for _, stmt := range pragma {
+		for _, stmt := range dialectOf(p.dialect).Setup() {
 			_, err = session.db.Exec(stmt)
 			if err != nil {
 				return
@@ -111,8 +235,10 @@ func (p *Pool) Open(nWriter, nReader int, path string, journal *Journal) (err er
 			p.sessions,
 			session)
 		if id < nWriter {
+			session.role = RoleWriter
 			p.next.writer <- session
 		} else {
+			session.role = RoleReader
 			p.next.reader <- session
 		}
 	}
@@ -134,26 +260,135 @@ func (p *Pool) Close() (err error) {
 // Get the next writer.
 // This may block until available.
 func (p *Pool) Writer() *Session {
-	return p.nextSession(p.next.writer)
+	return p.nextSession(RoleWriter, p.next.writer)
 }
 
 // Get the next reader.
 // This may block until available.
 func (p *Pool) Reader() *Session {
-	return p.nextSession(p.next.reader)
+	return p.nextSession(RoleReader, p.next.reader)
+}
+
+// Get the state of each session.
+// Ordered by session ID.
+func (p *Pool) State() (state []SessionState) {
+	p.mutex.Lock()
+	reserved := make(map[int]*reservation)
+	for id, r := range p.reserved {
+		reserved[id] = r
+	}
+	p.mutex.Unlock()
+	for _, session := range p.sessions {
+		s := SessionState{
+			ID:   session.id,
+			Role: session.role,
+		}
+		if r, found := reserved[session.id]; found {
+			s.Reserved = true
+			s.Age = time.Since(r.mark)
+			s.Stack = r.stack()
+			r.session.mutex.Lock()
+			s.Tx = len(r.session.tx)
+			r.session.mutex.Unlock()
+		}
+		state = append(state, s)
+	}
+	sort.Slice(
+		state,
+		func(i, j int) bool {
+			return state[i].ID < state[j].ID
+		})
+
+	return
+}
+
+// Dump the pool state.
+// Intended for debugging.
+func (p *Pool) Dump(w io.Writer) (err error) {
+	state := p.State()
+	lines := []string{}
+	for _, s := range state {
+		lines = append(lines, s.String())
+	}
+	_, err = io.WriteString(w, strings.Join(lines, "\n")+"\n")
+	if err != nil {
+		err = liberr.Wrap(err)
+	}
+
+	return
 }
 
 // Get the next session.
 // This may block until available.
-func (p *Pool) nextSession(ch chan *Session) (session *Session) {
+// The wait is reported to the metrics hook.
+func (p *Pool) nextSession(role string, ch chan *Session) (session *Session) {
+	mark := time.Now()
 	next := <-ch
+	Metrics.Waited(role, time.Since(mark))
 	session = &Session{
-		id: next.id,
-		db: next.db,
-		returner: func() {
-			session.reset()
-			ch <- next
-		},
+		id:   next.id,
+		role: next.role,
+		db:   next.db,
+	}
+	session.returner = func() {
+		session.reset()
+		p.released(session)
+		ch <- next
+	}
+	callers := make([]uintptr, 32)
+	n := runtime.Callers(3, callers)
+	p.mutex.Lock()
+	p.reserved[session.id] = &reservation{
+		session: session,
+		mark:    time.Now(),
+		callers: callers[:n],
+	}
+	p.mutex.Unlock()
+
+	return
+}
+
+// The session has been returned.
+func (p *Pool) released(session *Session) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	delete(p.reserved, session.id)
+}
+
+// Find sessions held past the threshold.
+// Sessions not already reported are reported (once).
+// Sessions with open transactions held past the max
+// lifespan (0=disabled) are aborted.
+func (p *Pool) held(threshold, lifespan time.Duration) (reported, aborted []SessionState) {
+	p.mutex.Lock()
+	candidates := []*reservation{}
+	for _, r := range p.reserved {
+		candidates = append(candidates, r)
+	}
+	p.mutex.Unlock()
+	for _, r := range candidates {
+		age := time.Since(r.mark)
+		r.session.mutex.Lock()
+		nTx := len(r.session.tx)
+		r.session.mutex.Unlock()
+		state := SessionState{
+			ID:       r.session.id,
+			Role:     r.session.role,
+			Reserved: true,
+			Age:      age,
+			Tx:       nTx,
+			Stack:    r.stack(),
+		}
+		if lifespan > 0 && age > lifespan && nTx > 0 {
+			if r.session.abort() {
+				aborted = append(aborted, state)
+			}
+			continue
+		}
+		if threshold > 0 && age > threshold && !r.reported {
+			r.reported = true
+			reported = append(reported, state)
+		}
 	}
 
 	return
@@ -0,0 +1,516 @@
+package model
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	liberr "github.com/konveyor/controller/pkg/error"
+	"github.com/konveyor/controller/pkg/ref"
+)
+
+// Sink tables.
+const (
+	outboxKind = "Outbox"
+	cursorKind = "SinkCursor"
+)
+
+// The sink delivery interval.
+// Must be set by the application before the DB is opened.
+var SinkInterval = time.Second
+
+// The max number of batches delivered per sink (per interval).
+var SinkBatch = 100
+
+// The initial (failed) delivery retry delay.
+// Doubled on each consecutive failure.
+var SinkRetryDelay = time.Second
+
+// The max (failed) delivery retry delay.
+var SinkMaxRetryDelay = time.Minute
+
+// The max number of batches retained in the outbox (0=unlimited).
+// Older batches are pruned even when not delivered to all sinks.
+var SinkRetention = 10000
+
+// Event sink.
+// Receives each committed batch (of changes) in revision
+// order. Delivery is at-least-once; a batch is retried until
+// Send() succeeds. The (durable) cursor is keyed by name and
+// stored with the retry state. The cursor is created at the
+// current revision when the sink is first registered (or when
+// the DB is opened) so changes committed before are not sent.
+// Batches are stored in the outbox while a sink is registered,
+// or when the DB is opened with sink cursors stored. The cursor
+// of a sink no longer used is removed using RemoveSink(). A sink
+// further behind than SinkRetention batches skips the pruned
+// batches.
+type EventSink interface {
+	// Name (unique).
+	Name() string
+	// Send the batch.
+	Send(batch *Batch) error
+}
+
+// Batch of changes.
+// The events for a committed transaction.
+type Batch struct {
+	// The commit revision.
+	Revision int64 `json:"revision"`
+	// Events.
+	Events []SinkEvent `json:"events"`
+}
+
+// Sink event.
+// Models are serialized using the model's JSON.
+type SinkEvent struct {
+	// ID.
+	ID uint64 `json:"id"`
+	// Action (created|updated|deleted).
+	Action string `json:"action"`
+	// Model kind.
+	Kind string `json:"kind"`
+	// Model primary key.
+	Pk string `json:"pk"`
+	// Labels.
+	Labels []string `json:"labels,omitempty"`
+	// The model.
+	Model json.RawMessage `json:"model"`
+	// The updated model.
+	Updated json.RawMessage `json:"updated,omitempty"`
+}
+
+// Outbox (batch) entry.
+// Batches stored (committed) with the changes
+// pending delivery to sinks.
+type Outbox struct {
+	Revision int64  `sql:"pk"`
+	Batch    string `sql:""`
+}
+
+func (m *Outbox) Pk() string {
+	return fmt.Sprintf("%d", m.Revision)
+}
+
+// Sink cursor.
+// The revision of the last batch delivered to the sink
+// and the (failed) delivery retry state.
+type SinkCursor struct {
+	Name     string `sql:"pk"`
+	Revision int64  `sql:""`
+	// Consecutive failures.
+	Failures int `sql:""`
+	// Next delivery attempt (unix nanoseconds).
+	RetryAt int64 `sql:""`
+}
+
+func (m *SinkCursor) Pk() string {
+	return m.Name
+}
+
+// Build the batch for the staged events.
+func (r *Tx) batch() (batch *Batch, err error) {
+	batch = &Batch{
+		Revision: r.revision,
+		Events:   []SinkEvent{},
+	}
+	itr := r.staged.Iter()
+	defer itr.Close()
+	for {
+		event := Event{}
+		if !event.next(itr) {
+			break
+		}
+		se := SinkEvent{
+			ID:     event.ID,
+			Action: actionName(event.Action),
+			Kind:   ref.ToKind(event.Model),
+			Pk:     ModelPk(event.Model),
+			Labels: event.Labels,
+		}
+		se.Model, err = json.Marshal(event.Model)
+		if err != nil {
+			err = liberr.Wrap(err)
+			return
+		}
+		if event.Updated != nil {
+			se.Updated, err = json.Marshal(event.Updated)
+			if err != nil {
+				err = liberr.Wrap(err)
+				return
+			}
+		}
+		batch.Events = append(batch.Events, se)
+	}
+
+	return
+}
+
+// Store the batch in the outbox.
+// Called before commit. See: Journal.outboxed().
+func (r *Tx) outbox() (err error) {
+	if !r.journal.outboxed() || r.staged.Len() == 0 || r.revision == 0 {
+		return
+	}
+	batch, err := r.batch()
+	if err != nil {
+		return
+	}
+	b, err := json.Marshal(batch)
+	if err != nil {
+		err = liberr.Wrap(err)
+		return
+	}
+	err = r.table().Insert(
+		&Outbox{
+			Revision: r.revision,
+			Batch:    string(b),
+		})
+
+	return
+}
+
+// Create the stored cursors of the registered sinks as
+// needed and determine whether sink cursors are stored.
+// Batches are retained in the outbox (for sinks not yet
+// registered) when a sink has been delivered to.
+func (r *Client) openOutbox() (err error) {
+	session := r.pool.Writer()
+	defer session.Return()
+	for _, sink := range r.journal.Sinks() {
+		err = r.sinkCursor(session, sink.Name())
+		if err != nil {
+			return
+		}
+	}
+	n := int64(0)
+	row := session.db.QueryRow("SELECT COUNT(*) FROM " + cursorKind + ";")
+	err = row.Scan(&n)
+	if err != nil {
+		err = liberr.Wrap(mapErr(r.dialect, err, nil))
+		return
+	}
+	r.journal.mutex.Lock()
+	r.journal.cursors = n > 0
+	r.journal.mutex.Unlock()
+
+	return
+}
+
+// Create the sink cursor at the current revision.
+// Not changed when already stored. The writer session
+// prevents commits between reading the revision and
+// storing the cursor.
+func (r *Client) sinkCursor(session *Session, name string) (err error) {
+	table := r.table(session.db)
+	err = table.Get(&SinkCursor{Name: name})
+	if err == nil || !errors.Is(err, NotFound) {
+		return
+	}
+	revision := &Revision{ID: revisionID}
+	err = table.Get(revision)
+	if err != nil {
+		return
+	}
+	err = table.Insert(
+		&SinkCursor{
+			Name:     name,
+			Revision: revision.Value,
+		})
+	if err != nil {
+		return
+	}
+
+	r.log.V(3).Info(
+		"sink cursor created.",
+		"name",
+		name,
+		"revision",
+		revision.Value)
+
+	return
+}
+
+// Register an event sink.
+// The cursor is created at the current revision; when
+// the DB is opened for sinks registered before.
+// See: Journal.Sink().
+func (r *Client) Sink(sink EventSink) (err error) {
+	if r.dm == nil {
+		err = r.journal.Sink(sink)
+		return
+	}
+	session := r.pool.Writer()
+	defer session.Return()
+	err = r.sinkCursor(session, sink.Name())
+	if err != nil {
+		return
+	}
+	err = r.journal.Sink(sink)
+	if err != nil {
+		return
+	}
+	r.journal.mutex.Lock()
+	r.journal.cursors = true
+	r.journal.mutex.Unlock()
+
+	return
+}
+
+// Remove an event sink.
+// The sink is unregistered and the stored cursor deleted.
+// Returns NotFound when the cursor is not stored. Batches
+// retained only for the sink are pruned on the next delivery.
+func (r *Client) RemoveSink(name string) (err error) {
+	r.sinkDelivery.mutex.Lock()
+	defer r.sinkDelivery.mutex.Unlock()
+	r.journal.RemoveSink(name)
+	if r.dm == nil {
+		return
+	}
+	session := r.pool.Writer()
+	defer session.Return()
+	err = r.table(session.db).Delete(&SinkCursor{Name: name})
+	if err != nil {
+		return
+	}
+	n := int64(0)
+	row := session.db.QueryRow("SELECT COUNT(*) FROM " + cursorKind + ";")
+	err = row.Scan(&n)
+	if err != nil {
+		err = liberr.Wrap(mapErr(r.dialect, err, nil))
+		return
+	}
+	r.journal.mutex.Lock()
+	r.journal.cursors = n > 0
+	r.journal.mutex.Unlock()
+
+	r.log.V(3).Info(
+		"sink removed.",
+		"name",
+		name)
+
+	return
+}
+
+// Deliver the outbox to the sinks.
+// Delivered in the background. Provided to flush
+// the outbox on demand.
+func (r *Client) Deliver() (err error) {
+	err = r.sinkDelivery.Deliver()
+	return
+}
+
+// Sink delivery.
+// Periodically (and when notified of a commit) delivers
+// the outbox to the sinks. Batches delivered to all sinks
+// (stored cursors) or beyond the retention are deleted.
+type sinkDelivery struct {
+	// DB client.
+	client *Client
+	// Delivery interval.
+	interval time.Duration
+	// Serialize delivery.
+	mutex sync.Mutex
+	// Stop requested.
+	done chan struct{}
+	// Goroutine ended.
+	wg sync.WaitGroup
+}
+
+// Start the delivery.
+// Not started when disabled.
+func (r *sinkDelivery) Start() {
+	if r.interval <= 0 {
+		return
+	}
+	r.done = make(chan struct{})
+	r.wg.Add(1)
+	go r.run()
+
+	r.client.log.V(3).Info(
+		"sink delivery started.",
+		"interval",
+		r.interval)
+}
+
+// Shutdown the delivery.
+func (r *sinkDelivery) Shutdown() {
+	if r.done == nil {
+		return
+	}
+	close(r.done)
+	r.wg.Wait()
+	r.done = nil
+
+	r.client.log.V(3).Info("sink delivery stopped.")
+}
+
+// Run.
+func (r *sinkDelivery) run() {
+	defer r.wg.Done()
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	committed := r.client.journal.committed()
+	for {
+		select {
+		case <-ticker.C:
+		case <-committed:
+		case <-r.done:
+			return
+		}
+		err := r.Deliver()
+		if err != nil {
+			r.client.log.Error(err, "sink: delivery failed.")
+		}
+	}
+}
+
+// Deliver the outbox to the sinks.
+func (r *sinkDelivery) Deliver() (err error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if !r.client.journal.outboxed() {
+		return
+	}
+	for _, sink := range r.client.journal.Sinks() {
+		err = r.deliver(sink)
+		if err != nil {
+			return
+		}
+	}
+	cursors := []SinkCursor{}
+	err = r.client.List(&cursors, ListOptions{Detail: MaxDetail})
+	if err != nil {
+		return
+	}
+	err = r.prune(cursors)
+
+	return
+}
+
+// Deliver the outbox to the sink.
+// The cursor and retry state are stored after each attempt.
+func (r *sinkDelivery) deliver(sink EventSink) (err error) {
+	name := sink.Name()
+	m := &SinkCursor{Name: name}
+	err = r.client.Get(m)
+	if err != nil {
+		return
+	}
+	if time.Now().Before(time.Unix(0, m.RetryAt)) {
+		return
+	}
+	list := []Outbox{}
+	err = r.client.List(
+		&list,
+		ListOptions{
+			Predicate: Gt("Revision", m.Revision),
+			Sort:      []int{1},
+			Page:      &Page{Limit: SinkBatch},
+			Detail:    MaxDetail,
+		})
+	if err != nil {
+		return
+	}
+	for _, entry := range list {
+		batch := &Batch{}
+		err = json.Unmarshal([]byte(entry.Batch), batch)
+		if err != nil {
+			err = liberr.Wrap(err)
+			return
+		}
+		sErr := sink.Send(batch)
+		if sErr != nil {
+			m.Failures++
+			delay := SinkRetryDelay << (m.Failures - 1)
+			if delay <= 0 || delay > SinkMaxRetryDelay {
+				delay = SinkMaxRetryDelay
+			}
+			m.RetryAt = time.Now().Add(delay).UnixNano()
+			r.client.log.Error(
+				sErr,
+				"sink: send failed.",
+				"sink",
+				name,
+				"revision",
+				batch.Revision,
+				"failures",
+				m.Failures,
+				"retry",
+				delay)
+			err = r.store(m)
+			return
+		}
+		m.Revision = entry.Revision
+		m.Failures = 0
+		m.RetryAt = 0
+		err = r.store(m)
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// Store the sink cursor.
+func (r *sinkDelivery) store(cursor *SinkCursor) (err error) {
+	session := r.client.pool.Writer()
+	defer session.Return()
+	err = r.client.table(session.db).Insert(cursor)
+
+	return
+}
+
+// Delete batches delivered to all (stored) cursors
+// and batches beyond the retention.
+func (r *sinkDelivery) prune(cursors []SinkCursor) (err error) {
+	session := r.client.pool.Writer()
+	defer session.Return()
+	latest := sql.NullInt64{}
+	row := session.db.QueryRow("SELECT MAX(Revision) FROM " + outboxKind + ";")
+	err = row.Scan(&latest)
+	if err != nil {
+		err = liberr.Wrap(mapErr(r.client.dialect, err, nil))
+		return
+	}
+	if !latest.Valid {
+		return
+	}
+	revision := latest.Int64
+	for _, m := range cursors {
+		if m.Revision < revision {
+			revision = m.Revision
+		}
+	}
+	if SinkRetention > 0 && revision < latest.Int64-int64(SinkRetention) {
+		revision = latest.Int64 - int64(SinkRetention)
+		for _, m := range cursors {
+			if m.Revision < revision {
+				r.client.log.Info(
+					"sink: undelivered batches pruned.",
+					"sink",
+					m.Name,
+					"cursor",
+					m.Revision,
+					"pruned",
+					revision)
+			}
+		}
+	}
+	if revision <= 0 {
+		return
+	}
+	_, err = session.db.Exec(
+		"DELETE FROM "+outboxKind+" WHERE Revision <= "+dialectOf(r.client.dialect).Param("revision")+";",
+		sql.Named("revision", revision))
+	if err != nil {
+		err = liberr.Wrap(mapErr(r.client.dialect, err, nil))
+	}
+
+	return
+}
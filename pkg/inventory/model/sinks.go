@@ -0,0 +1,197 @@
+package model
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	liberr "github.com/konveyor/controller/pkg/error"
+)
+
+// Rotating NDJSON file sink.
+// Each batch is written as a (single) JSON line. The file
+// is rotated (path.1 ... path.N) when the max size would
+// be exceeded.
+type FileSink struct {
+	// File path.
+	Path string
+	// Max file size in bytes (0=not rotated).
+	MaxSize int64
+	// Max number of rotated files kept.
+	MaxFiles int
+	// Open file.
+	file *os.File
+	// Current file size.
+	size int64
+	// Protect the file.
+	mutex sync.Mutex
+}
+
+// Name.
+func (s *FileSink) Name() string {
+	return "file:" + s.Path
+}
+
+// Write the batch.
+func (s *FileSink) Send(batch *Batch) (err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	line, err := json.Marshal(batch)
+	if err != nil {
+		err = liberr.Wrap(err)
+		return
+	}
+	line = append(line, '\n')
+	err = s.open()
+	if err != nil {
+		return
+	}
+	if s.MaxSize > 0 && s.size > 0 && s.size+int64(len(line)) > s.MaxSize {
+		err = s.rotate()
+		if err != nil {
+			return
+		}
+	}
+	n, err := s.file.Write(line)
+	s.size += int64(n)
+	if err != nil {
+		err = liberr.Wrap(err)
+	}
+
+	return
+}
+
+// Close the file.
+func (s *FileSink) Close() (err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.file != nil {
+		err = s.file.Close()
+		s.file = nil
+	}
+
+	return
+}
+
+// Open the file (as needed).
+func (s *FileSink) open() (err error) {
+	if s.file != nil {
+		return
+	}
+	s.file, err = os.OpenFile(
+		s.Path,
+		os.O_APPEND|os.O_CREATE|os.O_WRONLY,
+		0644)
+	if err != nil {
+		err = liberr.Wrap(err)
+		return
+	}
+	st, err := s.file.Stat()
+	if err != nil {
+		err = liberr.Wrap(err)
+		return
+	}
+
+	s.size = st.Size()
+
+	return
+}
+
+// Rotate the file.
+// The oldest file is deleted.
+func (s *FileSink) rotate() (err error) {
+	_ = s.file.Close()
+	s.file = nil
+	for n := s.MaxFiles - 1; n > 0; n-- {
+		err = os.Rename(
+			fmt.Sprintf("%s.%d", s.Path, n),
+			fmt.Sprintf("%s.%d", s.Path, n+1))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			err = liberr.Wrap(err)
+			return
+		}
+	}
+	if s.MaxFiles > 0 {
+		err = os.Rename(s.Path, s.Path+".1")
+	} else {
+		err = os.Remove(s.Path)
+	}
+	if err != nil {
+		err = liberr.Wrap(err)
+		return
+	}
+
+	err = s.open()
+
+	return
+}
+
+// HTTP webhook sink.
+// Each batch is POSTed as JSON. Responses other than 2xx
+// are failures (retried).
+type WebhookSink struct {
+	// URL.
+	URL string
+	// Additional request headers.
+	Header http.Header
+	// HTTP client.
+	// Default: client with 30s timeout.
+	Client *http.Client
+}
+
+// Name.
+func (s *WebhookSink) Name() string {
+	return "webhook:" + s.URL
+}
+
+// POST the batch.
+func (s *WebhookSink) Send(batch *Batch) (err error) {
+	body, err := json.Marshal(batch)
+	if err != nil {
+		err = liberr.Wrap(err)
+		return
+	}
+	request, err := http.NewRequest(
+		http.MethodPost,
+		s.URL,
+		bytes.NewReader(body))
+	if err != nil {
+		err = liberr.Wrap(err)
+		return
+	}
+	for name, values := range s.Header {
+		for _, v := range values {
+			request.Header.Add(name, v)
+		}
+	}
+	request.Header.Set("Content-Type", "application/json")
+	client := s.Client
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		err = liberr.Wrap(err)
+		return
+	}
+	defer func() {
+		_, _ = io.Copy(io.Discard, response.Body)
+		_ = response.Body.Close()
+	}()
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		err = liberr.New(
+			"webhook failed.",
+			"url",
+			s.URL,
+			"status",
+			response.StatusCode)
+	}
+
+	return
+}
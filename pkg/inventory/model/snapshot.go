@@ -0,0 +1,113 @@
+package model
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/go-logr/logr"
+	liberr "github.com/konveyor/controller/pkg/error"
+	fb "github.com/konveyor/controller/pkg/filebacked"
+)
+
+// Read-only DB access.
+// Implemented by the Client, Tx and Snapshot.
+type Reader interface {
+	// Get the specified model.
+	Get(Model) error
+	// List models based on the type of slice.
+	List(interface{}, ListOptions) error
+	// Find models.
+	Find(interface{}, ListOptions) (fb.Iterator, error)
+	// Stream models.
+	Stream(interface{}, ListOptions) (*Cursor, error)
+	// Count based on the specified model.
+	Count(Model, Predicate) (int64, error)
+}
+
+// Read snapshot.
+// All reads see one consistent (WAL) snapshot of the DB
+// pinned by a (deferred) read transaction.
+type Snapshot struct {
+	// Read transaction.
+	tx *sql.Tx
+	// SQL dialect.
+	dialect Dialect
+	// Logger.
+	log logr.Logger
+}
+
+// Read within a consistent snapshot.
+// A reader session is reserved and a (deferred) read transaction
+// started and pinned before `fn` is called. The transaction is
+// ended and the session returned when `fn` returns. Cursors
+// must be closed before `fn` returns.
+func (r *Client) Snapshot(fn func(Reader) error) (err error) {
+	session := r.pool.Reader()
+	defer session.Return()
+	mark := time.Now()
+	tx, err := session.Begin()
+	if err != nil {
+		return
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+	// Pin the snapshot.
+	// Deferred transactions start the (WAL) read
+	// snapshot on the first read.
+	row := tx.QueryRow("SELECT COUNT(*) FROM " + revisionKind)
+	var n int64
+	err = row.Scan(&n)
+	if err != nil {
+		err = liberr.Wrap(mapErr(r.dialect, err, nil))
+		return
+	}
+	err = fn(&Snapshot{tx: tx, dialect: r.dialect, log: r.log})
+	if err != nil {
+		return
+	}
+
+	r.log.V(4).Info(
+		"snapshot ended.",
+		"duration",
+		time.Since(mark))
+
+	return
+}
+
+// Table using the read transaction.
+func (r *Snapshot) table() Table {
+	return Table{DB: r.tx, Dialect: r.dialect}
+}
+
+// Get the model.
+func (r *Snapshot) Get(model Model) (err error) {
+	err = r.table().Get(model)
+	return
+}
+
+// List models.
+// The `list` must be: *[]Model.
+func (r *Snapshot) List(list interface{}, options ListOptions) (err error) {
+	err = r.table().List(list, options)
+	return
+}
+
+// Find models.
+func (r *Snapshot) Find(model interface{}, options ListOptions) (itr fb.Iterator, err error) {
+	itr, err = r.table().Find(model, options)
+	return
+}
+
+// Stream models.
+// The cursor must be closed before the snapshot ends.
+func (r *Snapshot) Stream(model interface{}, options ListOptions) (cursor *Cursor, err error) {
+	cursor, err = r.table().Stream(model, options)
+	return
+}
+
+// Count models.
+func (r *Snapshot) Count(model Model, predicate Predicate) (n int64, err error) {
+	n, err = r.table().Count(model, predicate)
+	return
+}
@@ -0,0 +1,143 @@
+package model
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// SQLite (sqlite3) dialect.
+// The default.
+type SQLite struct{}
+
+// The database/sql driver name.
+func (d *SQLite) Driver() string {
+	return "sqlite3"
+}
+
+// Statements executed when a connection is opened.
+func (d *SQLite) Setup() []string {
+	return []string{
+		"PRAGMA foreign_keys = ON",
+		"PRAGMA auto_vacuum = INCREMENTAL",
+		"PRAGMA journal_mode = WAL",
+	}
+}
+
+// Column type for the field (reflect) kind.
+func (d *SQLite) Type(kind reflect.Kind) string {
+	switch kind {
+	case reflect.Bool,
+		reflect.Int,
+		reflect.Int8,
+		reflect.Int16,
+		reflect.Int32,
+		reflect.Int64:
+		return "INTEGER"
+	case reflect.Float32,
+		reflect.Float64:
+		return "REAL"
+	default:
+		return "TEXT"
+	}
+}
+
+// Named parameter.
+func (d *SQLite) Param(name string) string {
+	return ":" + name
+}
+
+// Insert statement that (on conflict with the keys)
+// updates the listed columns. Conflicts are ignored
+// when no columns are listed.
+func (d *SQLite) Upsert(table string, columns, keys, update []string) string {
+	params := []string{}
+	for _, name := range columns {
+		params = append(params, d.Param(name))
+	}
+	stmt := "INSERT INTO " + table +
+		" (" + strings.Join(columns, ",") + ")" +
+		" VALUES (" + strings.Join(params, ",") + ")" +
+		" ON CONFLICT (" + strings.Join(keys, ",") + ")"
+	if len(update) == 0 {
+		stmt += " DO NOTHING;"
+		return stmt
+	}
+	set := []string{}
+	for _, name := range update {
+		set = append(set, name+" = excluded."+name)
+	}
+	stmt += " DO UPDATE SET " + strings.Join(set, ",") + ";"
+
+	return stmt
+}
+
+// Table DDL template.
+func (d *SQLite) TableDDL() string {
+	return TableDDL
+}
+
+// Index DDL template.
+func (d *SQLite) IndexDDL() string {
+	return IndexDDL
+}
+
+// Map (sqlite3) driver errors.
+func (d *SQLite) MapErr(err error, md *Definition) error {
+	sql3Err := sqlite3.Error{}
+	if !errors.As(err, &sql3Err) {
+		return err
+	}
+	mapped := &DbErr{Cause: sql3Err}
+	switch sql3Err.Code {
+	case sqlite3.ErrBusy,
+		sqlite3.ErrLocked:
+		mapped.Reason = BusyErr
+	case sqlite3.ErrConstraint:
+		switch sql3Err.ExtendedCode {
+		case sqlite3.ErrConstraintUnique,
+			sqlite3.ErrConstraintPrimaryKey:
+			mapped.Reason = ConflictErr
+		case sqlite3.ErrConstraintForeignKey:
+			mapped.Reason = FkViolationErr
+		case sqlite3.ErrConstraintNotNull:
+			mapped.Reason = NotNullErr
+		default:
+			mapped.Reason = ConstraintErr
+		}
+	default:
+		return err
+	}
+	if md == nil {
+		return mapped
+	}
+	mapped.Kind = md.Kind
+	// The violated FK is not reported by sqlite.
+	if mapped.Reason != FkViolationErr {
+		mapped.Fields = d.offending(sql3Err, md)
+	}
+
+	return mapped
+}
+
+// Offending fields.
+// Parsed from the (sqlite3) error message.
+// Format: <reason>: table.column, table.column
+func (d *SQLite) offending(err sqlite3.Error, md *Definition) (fields []string) {
+	msg := err.Error()
+	part := strings.SplitN(msg, ":", 2)
+	if len(part) != 2 {
+		return
+	}
+	for _, column := range strings.Split(part[1], ",") {
+		column = strings.TrimSpace(column)
+		column = strings.TrimPrefix(column, md.Kind+".")
+		if f := md.Field(column); f != nil {
+			fields = append(fields, f.Name)
+		}
+	}
+
+	return
+}
@@ -3,20 +3,24 @@ package model
 import (
 	"bytes"
 	"crypto/sha1"
+	"crypto/sha256"
 	"database/sql"
 	"encoding/binary"
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"github.com/google/uuid"
 	liberr "github.com/konveyor/controller/pkg/error"
 	fb "github.com/konveyor/controller/pkg/filebacked"
-	"github.com/mattn/go-sqlite3"
 	"reflect"
+	"strconv"
 	"strings"
 	"text/template"
+	"time"
 )
 
 // DDL templates.
+// See: Dialect.
 var TableDDL = `
 CREATE TABLE IF NOT EXISTS {{.Table}} (
 {{ range $i,$f := .Fields -}}
@@ -64,7 +68,10 @@ SET
 {{ $f.Name }} = {{ $f.Param }}
 {{ end -}}
 WHERE
-{{ .Pk.Name }} = {{ .Pk.Param }}
+{{ range $i,$f := .Pks -}}
+{{ if $i }}AND {{ end -}}
+{{ $f.Name }} = {{ $f.Param }}
+{{ end -}}
 {{ if .Predicate -}}
 AND {{ .Predicate.Expr }}
 {{ end -}}
@@ -74,7 +81,10 @@ AND {{ .Predicate.Expr }}
 var DeleteSQL = `
 DELETE FROM {{.Table}}
 WHERE
-{{ .Pk.Name }} = {{ .Pk.Param }}
+{{ range $i,$f := .Pks -}}
+{{ if $i }}AND {{ end -}}
+{{ $f.Name }} = {{ $f.Param }}
+{{ end -}}
 ;
 `
 
@@ -86,7 +96,10 @@ SELECT
 {{ end -}}
 FROM {{.Table}}
 WHERE
-{{ .Pk.Name }} = {{ .Pk.Param }}
+{{ range $i,$f := .Pks -}}
+{{ if $i }}AND {{ end -}}
+{{ $f.Name }} = {{ $f.Param }}
+{{ end -}}
 ;
 `
 
@@ -107,11 +120,14 @@ WHERE
 {{ if .Predicate -}}
 {{ .Predicate.Expr }}
 {{ end -}}
-{{ if .Sort -}}
+{{ if or .Sort .SortBy -}}
 ORDER BY
 {{ range $i,$n := .Sort -}}
 {{ if $i }},{{ end }}{{ $n }}
 {{ end -}}
+{{ range $i,$n := .SortBy -}}
+{{ if or $i $.Sort }},{{ end }}{{ $n }}
+{{ end -}}
 {{ end -}}
 {{ if .Page -}}
 LIMIT {{.Page.Limit}} OFFSET {{.Page.Offset}}
@@ -131,20 +147,75 @@ var (
 	MustBeObjectErr = errors.New("must be object")
 	// Field type error.
 	FieldTypeErr = errors.New("field type must be (int, str, bool")
+	// Declared storage class not valid.
+	StorageErr = errors.New("storage class must be (integer, text, real) on a driver.Valuer field")
 	// PK field type error.
 	PkTypeErr = errors.New("pk field must be (int, str)")
 	// Generated PK error.
 	GenPkTypeErr = errors.New("PK field must be `str` when generated")
+	// PK generator not valid.
+	PkGenErr = errors.New("PK generator not valid")
+	// Composite PK not valid.
+	CompositePkErr = errors.New("composite PK not valid")
 	// Invalid field referenced in predicate.
 	PredicateRefErr = errors.New("predicate referenced unknown field")
 	// Invalid predicate for type of field.
 	PredicateTypeErr = errors.New("predicate type not valid for field")
 	// Invalid predicate value.
 	PredicateValueErr = errors.New("predicate value not valid")
+	// Invalid predicate operator.
+	PredicateOperatorErr = errors.New("predicate operator not supported")
+	// Invalid field referenced in sort.
+	SortRefErr = errors.New("sort referenced unknown field")
 	// Invalid detail level.
 	DetailErr = errors.New("detail level must be <= MaxDetail")
+	// Join model must have (2) join FKs.
+	JoinFkErr = errors.New("join model must have (2) `+join` FK fields")
+	// Model not joined by the join model.
+	JoinKindErr = errors.New("model kind not joined")
+	// DB integrity check failed.
+	IntegrityErr = errors.New("integrity check failed")
+	// TTL field type error.
+	TtlTypeErr = errors.New("ttl field must be (int) unix timestamp")
+	// TTL duration not valid.
+	TtlErr = errors.New("ttl must be a valid duration")
+	// Revision field type not valid.
+	RevisionTypeErr = errors.New("revision field must be (int)")
+	// SinceRevision used without a revision field.
+	RevisionFieldErr = errors.New("model has no revision field")
+	// Audit trail not enabled.
+	AuditErr = errors.New("audit trail not enabled")
+	// Projection not valid or not found.
+	ProjectionErr = errors.New("projection not valid")
+	// Kind not in the data model.
+	KindErr = errors.New("kind not found in the data model")
+	// Sink not valid.
+	SinkErr = errors.New("sink not valid")
+	// FK flags not compatible.
+	FkFlagErr = errors.New("FK flags (+cascade|+join, +setnull, +restrict) not compatible")
 )
 
+// Delete restricted error.
+// The model is referenced by +restrict foreign keys.
+type RestrictErr struct {
+	// Referenced model kind.
+	Kind string
+	// Referenced model PK.
+	Pk string
+	// Blocking references.
+	// Format: <kind>.<field> (<count>)
+	References []string
+}
+
+// Error description.
+func (e *RestrictErr) Error() string {
+	return fmt.Sprintf(
+		"delete %s(%s) restricted by: %s",
+		e.Kind,
+		e.Pk,
+		strings.Join(e.References, ", "))
+}
+
 // Represents a table in the DB.
 // Using reflect, the model is inspected to determine the
 // table name and columns. The column definition is specified
@@ -158,6 +229,30 @@ var (
 type Table struct {
 	// Database connection.
 	DB DBTX
+	// SQL dialect.
+	// Default: SQLite.
+	Dialect Dialect
+}
+
+// The SQL dialect.
+func (t Table) dialect() Dialect {
+	return dialectOf(t.Dialect)
+}
+
+// Inspect the model.
+// The definition is bound to the table dialect.
+func (t Table) inspect(model interface{}) (md *Definition, err error) {
+	md, err = Inspect(model)
+	if err == nil {
+		md.bind(t.dialect())
+	}
+
+	return
+}
+
+// Map driver errors.
+func (t Table) mapErr(err error, md *Definition) error {
+	return mapErr(t.Dialect, err, md)
 }
 
 // Get the table name for the model.
@@ -200,7 +295,7 @@ func (t Table) DDL(model interface{}, dm *DataModel) (list []string, err error)
 // Build table DDL.
 func (t Table) TableDDL(md *Definition, dm *DataModel) (list []string, err error) {
 	tpl := template.New("")
-	tpl, err = tpl.Parse(TableDDL)
+	tpl, err = tpl.Parse(t.dialect().TableDDL())
 	if err != nil {
 		err = liberr.Wrap(err)
 		return
@@ -230,7 +325,7 @@ func (t Table) KeyIndexDDL(md *Definition) (list []string, err error) {
 	tpl := template.New("")
 	keyFields := md.KeyFields()
 	if len(keyFields) > 0 {
-		tpl, err = tpl.Parse(IndexDDL)
+		tpl, err = tpl.Parse(t.dialect().IndexDDL())
 		if err != nil {
 			err = liberr.Wrap(err)
 			return
@@ -280,7 +375,7 @@ func (t Table) IndexDDL(md *Definition) (list []string, err error) {
 		}
 	}
 	for group, idxFields := range index {
-		tpl, err = tpl.Parse(IndexDDL)
+		tpl, err = tpl.Parse(t.dialect().IndexDDL())
 		if err != nil {
 			err = liberr.Wrap(err)
 			return
@@ -305,42 +400,60 @@ func (t Table) IndexDDL(md *Definition) (list []string, err error) {
 
 // Insert the model in the DB.
 // Expects the primary key (PK) to be set.
+// Updated when the primary key exists; other (unique
+// key) conflicts return ConflictErr.
 func (t Table) Insert(model interface{}) (err error) {
-	md, err := Inspect(model)
+	_, err = t.insert(model)
+	return
+}
+
+// Insert the model in the DB.
+// Updated when the primary key exists.
+// Returns whether the model was inserted.
+func (t Table) insert(model interface{}) (inserted bool, err error) {
+	md, err := t.inspect(model)
 	if err != nil {
 		return
 	}
 	t.EnsurePk(md)
-	stmt, err := t.insertSQL(md)
+	found, err := t.exists(md)
+	if err != nil {
+		return
+	}
+	stmt := t.upsertSQL(md)
+	params, err := t.Params(md)
 	if err != nil {
 		return
 	}
-	params := t.Params(md)
+	mark := time.Now()
 	r, err := t.DB.Exec(stmt, params...)
 	if err != nil {
-		if sql3Err, cast := err.(sqlite3.Error); cast {
-			if sql3Err.Code == sqlite3.ErrConstraint {
-				return t.Update(model)
-			}
-		}
 		err = liberr.Wrap(
-			err,
+			t.mapErr(err, md),
 			"sql",
 			stmt,
 			"params",
 			params)
 		return
 	}
-	_, err = r.RowsAffected()
+	nRows, err := r.RowsAffected()
 	if err != nil {
 		err = liberr.Wrap(err)
 		return
 	}
 
+	inserted = !found
 	t.reflectIncremented(md)
+	if inserted {
+		t.observe(OpInsert, md, stmt, params, mark, nRows)
+	} else {
+		t.observe(OpUpdate, md, stmt, params, mark, nRows)
+	}
 
 	log.V(5).Info(
-		"table: model inserted.",
+		"table: model upserted.",
+		"inserted",
+		inserted,
 		"sql",
 		stmt,
 		"params",
@@ -349,10 +462,42 @@ func (t Table) Insert(model interface{}) (err error) {
 	return
 }
 
+// Get whether a model with the primary key exists.
+func (t Table) exists(md *Definition) (found bool, err error) {
+	pks := []Predicate{}
+	for _, f := range md.PkFields() {
+		pks = append(pks, Eq(f.Name, f.Value.Interface()))
+	}
+	if len(pks) == 0 {
+		return
+	}
+	options := ListOptions{Predicate: And(pks...)}
+	stmt, err := t.countSQL(md, &options)
+	if err != nil {
+		return
+	}
+	n := int64(0)
+	params := options.Params()
+	err = t.DB.QueryRow(stmt, params...).Scan(&n)
+	if err != nil {
+		err = liberr.Wrap(
+			t.mapErr(err, md),
+			"sql",
+			stmt,
+			"params",
+			params)
+		return
+	}
+
+	found = n > 0
+
+	return
+}
+
 // Update the model in the DB.
 // Expects the primary key (PK) to be set.
 func (t Table) Update(model interface{}, predicate ...Predicate) (err error) {
-	md, err := Inspect(model)
+	md, err := t.inspect(model)
 	if err != nil {
 		return
 	}
@@ -365,11 +510,16 @@ func (t Table) Update(model interface{}, predicate ...Predicate) (err error) {
 	if err != nil {
 		return
 	}
-	params := append(t.Params(md), options.Params()...)
+	params, err := t.Params(md)
+	if err != nil {
+		return
+	}
+	params = append(params, options.Params()...)
+	mark := time.Now()
 	r, err := t.DB.Exec(stmt, params...)
 	if err != nil {
 		err = liberr.Wrap(
-			err,
+			t.mapErr(err, md),
 			"sql",
 			stmt,
 			"params",
@@ -387,6 +537,7 @@ func (t Table) Update(model interface{}, predicate ...Predicate) (err error) {
 	}
 
 	t.reflectIncremented(md)
+	t.observe(OpUpdate, md, stmt, params, mark, nRows)
 
 	log.V(5).Info(
 		"table: model updated.",
@@ -401,7 +552,7 @@ func (t Table) Update(model interface{}, predicate ...Predicate) (err error) {
 // Delete the model in the DB.
 // Expects the primary key (PK) to be set.
 func (t Table) Delete(model interface{}) (err error) {
-	md, err := Inspect(model)
+	md, err := t.inspect(model)
 	if err != nil {
 		return
 	}
@@ -410,11 +561,15 @@ func (t Table) Delete(model interface{}) (err error) {
 	if err != nil {
 		return
 	}
-	params := t.Params(md)
+	params, err := t.Params(md)
+	if err != nil {
+		return
+	}
+	mark := time.Now()
 	r, err := t.DB.Exec(stmt, params...)
 	if err != nil {
 		err = liberr.Wrap(
-			err,
+			t.mapErr(err, md),
 			"sql",
 			stmt,
 			"params",
@@ -431,6 +586,8 @@ func (t Table) Delete(model interface{}) (err error) {
 		return
 	}
 
+	t.observe(OpDelete, md, stmt, params, mark, nRows)
+
 	log.V(5).Info(
 		"table: model deleted.",
 		"sql",
@@ -445,7 +602,7 @@ func (t Table) Delete(model interface{}) (err error) {
 // Expects the primary key (PK) to be set.
 // Fetch the row and populate the fields in the model.
 func (t Table) Get(model interface{}) (err error) {
-	md, err := Inspect(model)
+	md, err := t.inspect(model)
 	if err != nil {
 		return
 	}
@@ -454,12 +611,16 @@ func (t Table) Get(model interface{}) (err error) {
 	if err != nil {
 		return
 	}
-	params := t.Params(md)
+	params, err := t.Params(md)
+	if err != nil {
+		return
+	}
+	mark := time.Now()
 	row := t.DB.QueryRow(stmt, params...)
 	err = t.scan(row, md.Fields)
 	if err != nil {
 		err = liberr.Wrap(
-			err,
+			t.mapErr(err, md),
 			"sql",
 			stmt,
 			"params",
@@ -467,6 +628,8 @@ func (t Table) Get(model interface{}) (err error) {
 		return
 	}
 
+	t.observe(OpGet, md, stmt, params, mark, 1)
+
 	log.V(5).Info(
 		"table: get succeeded.",
 		"sql",
@@ -498,7 +661,7 @@ func (t Table) List(list interface{}, options ListOptions) (err error) {
 		err = liberr.Wrap(MustBeSlicePtrErr)
 		return
 	}
-	md, err := Inspect(model)
+	md, err := t.inspect(model)
 	if err != nil {
 		return
 	}
@@ -507,10 +670,11 @@ func (t Table) List(list interface{}, options ListOptions) (err error) {
 		return
 	}
 	params := options.Params()
+	mark := time.Now()
 	cursor, err := t.DB.Query(stmt, params...)
 	if err != nil {
 		err = liberr.Wrap(
-			err,
+			t.mapErr(err, md),
 			"sql",
 			stmt,
 			"params",
@@ -525,7 +689,7 @@ func (t Table) List(list interface{}, options ListOptions) (err error) {
 		mt := reflect.TypeOf(model)
 		mPtr := reflect.New(mt.Elem())
 		mInt := mPtr.Interface()
-		mDef, _ := Inspect(mInt)
+		mDef, _ := t.inspect(mInt)
 		options.fields = mDef.Fields
 		err = t.scan(cursor, options.Fields())
 		if err != nil {
@@ -536,6 +700,8 @@ func (t Table) List(list interface{}, options ListOptions) (err error) {
 	}
 
 	lv.Set(mList)
+	_ = cursor.Close()
+	t.observe(OpList, md, stmt, params, mark, int64(lv.Len()))
 
 	log.V(5).Info(
 		"table: list succeeded.",
@@ -552,7 +718,7 @@ func (t Table) List(list interface{}, options ListOptions) (err error) {
 // Find models in the DB.
 // Qualified by the list options.
 func (t Table) Find(model interface{}, options ListOptions) (itr fb.Iterator, err error) {
-	md, err := Inspect(model)
+	md, err := t.inspect(model)
 	if err != nil {
 		return
 	}
@@ -561,9 +727,10 @@ func (t Table) Find(model interface{}, options ListOptions) (itr fb.Iterator, er
 		return
 	}
 	params := options.Params()
+	mark := time.Now()
 	cursor, err := t.DB.Query(stmt, params...)
 	if err != nil {
-		err = liberr.Wrap(err, "sql", stmt, "params", params)
+		err = liberr.Wrap(t.mapErr(err, md), "sql", stmt, "params", params)
 		return
 	}
 	defer func() {
@@ -574,7 +741,7 @@ func (t Table) Find(model interface{}, options ListOptions) (itr fb.Iterator, er
 		mt := reflect.TypeOf(model)
 		mPtr := reflect.New(mt.Elem())
 		mInt := mPtr.Interface()
-		mDef, _ := Inspect(mInt)
+		mDef, _ := t.inspect(mInt)
 		options.fields = mDef.Fields
 		err = t.scan(cursor, options.Fields())
 		if err != nil {
@@ -585,6 +752,8 @@ func (t Table) Find(model interface{}, options ListOptions) (itr fb.Iterator, er
 	}
 
 	itr = list.Iter()
+	_ = cursor.Close()
+	t.observe(OpFind, md, stmt, params, mark, int64(itr.Len()))
 
 	log.V(5).Info(
 		"table: find succeeded.",
@@ -598,11 +767,46 @@ func (t Table) Find(model interface{}, options ListOptions) (itr fb.Iterator, er
 	return
 }
 
+// Stream models in the DB.
+// Qualified by the list options.
+// Returns an open cursor which must be closed.
+func (t Table) Stream(model interface{}, options ListOptions) (cursor *Cursor, err error) {
+	md, err := t.inspect(model)
+	if err != nil {
+		return
+	}
+	stmt, err := t.listSQL(md, &options)
+	if err != nil {
+		return
+	}
+	params := options.Params()
+	cursor = newCursor(t, md, model, options)
+	cursor.rows, err = t.DB.Query(stmt, params...)
+	if err != nil {
+		cursor.closed = true
+		cursor = nil
+		err = liberr.Wrap(t.mapErr(err, md), "sql", stmt, "params", params)
+		return
+	}
+	cursor.stmt = stmt
+	cursor.params = params
+	cursor.elapsed = time.Since(cursor.started)
+
+	log.V(5).Info(
+		"table: stream opened.",
+		"sql",
+		stmt,
+		"params",
+		params)
+
+	return
+}
+
 // Count the models in the DB.
 // Qualified by the model field values and list options.
 // Else, ALL models are counted.
 func (t Table) Count(model interface{}, predicate Predicate) (count int64, err error) {
-	md, err := Inspect(model)
+	md, err := t.inspect(model)
 	if err != nil {
 		return
 	}
@@ -613,11 +817,12 @@ func (t Table) Count(model interface{}, predicate Predicate) (count int64, err e
 	}
 	count = int64(0)
 	params := options.Params()
+	mark := time.Now()
 	row := t.DB.QueryRow(stmt, params...)
 	err = row.Scan(&count)
 	if err != nil {
 		err = liberr.Wrap(
-			err,
+			t.mapErr(err, md),
 			"sql",
 			stmt,
 			"params",
@@ -625,6 +830,8 @@ func (t Table) Count(model interface{}, predicate Predicate) (count int64, err e
 		return
 	}
 
+	t.observe(OpCount, md, stmt, params, mark, 1)
+
 	log.V(5).Info(
 		"table: count succeeded.",
 		"sql",
@@ -636,19 +843,33 @@ func (t Table) Count(model interface{}, predicate Predicate) (count int64, err e
 }
 
 // Get the `Fields` referenced as param in SQL.
-func (t Table) Params(md *Definition) (list []interface{}) {
+// Returns codec (encode) errors.
+func (t Table) Params(md *Definition) (list []interface{}, err error) {
 	list = []interface{}{}
 	for _, f := range md.Fields {
 		if f.isParam {
-			p := sql.Named(f.Name, f.Pull())
-			list = append(list, p)
+			var v interface{}
+			v, err = f.Encode()
+			if err != nil {
+				return
+			}
+			list = append(list, sql.Named(f.Name, v))
 		}
 	}
 
 	return
 }
 
+// Primary key SQL expression.
+// Composite keys are the (pk) columns joined by the
+// PkSeparator matching ModelPk().
+func pkExpr(fields []*Field) string {
+	return aliasedPkExpr("", fields)
+}
+
 // Ensure PK is generated as specified/needed.
+// The PK is generated using the fields and
+// generator specified in the `pk(...)` tag.
 func (t Table) EnsurePk(md *Definition) {
 	pk := md.PkField()
 	if pk == nil {
@@ -658,7 +879,7 @@ func (t Table) EnsurePk(md *Definition) {
 	if len(withFields) == 0 {
 		return
 	}
-	switch pk.Value.Kind() {
+	switch pk.kind() {
 	case reflect.String:
 		if pk.Pull() != "" {
 			return
@@ -666,28 +887,46 @@ func (t Table) EnsurePk(md *Definition) {
 	default:
 		return
 	}
-	h := sha1.New()
+	generator, namespace := pk.Generator()
+	bfr := new(bytes.Buffer)
+	values := []string{}
 	for _, f := range md.Fields {
 		name := strings.ToLower(f.Name)
 		if matched, _ := withFields[name]; !matched {
 			continue
 		}
 		f.Pull()
-		switch f.Value.Kind() {
+		switch f.kind() {
 		case reflect.String:
-			h.Write([]byte(f.string))
+			bfr.Write([]byte(f.string))
+			values = append(values, f.string)
 		case reflect.Bool,
 			reflect.Int,
 			reflect.Int8,
 			reflect.Int16,
 			reflect.Int32,
 			reflect.Int64:
-			bfr := new(bytes.Buffer)
 			binary.Write(bfr, binary.BigEndian, f.int)
-			h.Write(bfr.Bytes())
+			values = append(values, strconv.FormatInt(f.int, 10))
+		}
+	}
+	switch generator {
+	case GenSha256:
+		h := sha256.Sum256(bfr.Bytes())
+		pk.string = hex.EncodeToString(h[:])
+	case GenUuid5:
+		ns := PkNamespace
+		if namespace != "" {
+			ns = uuid.MustParse(namespace)
 		}
+		pk.string = uuid.NewSHA1(ns, bfr.Bytes()).String()
+	case GenConcat:
+		pk.string = strings.Join(values, PkSeparator)
+	default:
+		h := sha1.New()
+		h.Write(bfr.Bytes())
+		pk.string = hex.EncodeToString(h.Sum(nil))
 	}
-	pk.string = hex.EncodeToString(h.Sum(nil))
 	pk.Push()
 }
 
@@ -705,6 +944,24 @@ func (t Table) Constraints(md *Definition, dm *DataModel) (constraints []string,
 			}
 		}
 	}
+	if md.IsComposite() {
+		list := []string{}
+		for _, f := range md.PkFields() {
+			list = append(list, f.Name)
+		}
+		constraints = append(
+			constraints,
+			fmt.Sprintf(
+				"PRIMARY KEY (%s)",
+				strings.Join(list, ",")))
+	}
+	if md.IsJoin() {
+		list := []string{}
+		for _, fk := range md.JoinFks() {
+			list = append(list, fk.Owner.Name)
+		}
+		unique["__JOIN__"] = list
+	}
 	for _, list := range unique {
 		constraints = append(
 			constraints,
@@ -724,6 +981,65 @@ func (t Table) Constraints(md *Definition, dm *DataModel) (constraints []string,
 	return
 }
 
+// Observe the completed operation.
+// Timed from the mark. See: record().
+func (t Table) observe(op string, md *Definition, stmt string, params []interface{}, mark time.Time, rows int64) {
+	t.record(op, md, stmt, params, time.Since(mark), rows)
+}
+
+// Record the operation duration.
+// Reported to the metrics hook and logged with the
+// query plan when the slow query threshold is exceeded.
+func (t Table) record(op string, md *Definition, stmt string, params []interface{}, duration time.Duration, rows int64) {
+	Metrics.Operation(op, md.Kind, duration, rows)
+	if SlowQueryThreshold == 0 || duration < SlowQueryThreshold {
+		return
+	}
+	Metrics.Slow(op, md.Kind, duration)
+	log.V(1).Info(
+		"table: slow query.",
+		"op",
+		op,
+		"kind",
+		md.Kind,
+		"duration",
+		duration,
+		"sql",
+		stmt,
+		"params",
+		params,
+		"plan",
+		t.explain(stmt, params))
+}
+
+// Explain the query plan.
+// Returns the plan detail (lines).
+func (t Table) explain(stmt string, params []interface{}) (plan []string) {
+	plan = []string{}
+	cursor, err := t.DB.Query("EXPLAIN QUERY PLAN "+stmt, params...)
+	if err != nil {
+		log.V(4).Info(
+			"table: explain failed.",
+			"error",
+			err.Error())
+		return
+	}
+	defer func() {
+		_ = cursor.Close()
+	}()
+	for cursor.Next() {
+		var id, parent, notUsed int
+		detail := ""
+		err = cursor.Scan(&id, &parent, &notUsed, &detail)
+		if err != nil {
+			return
+		}
+		plan = append(plan, detail)
+	}
+
+	return
+}
+
 // Reflect auto-incremented fields.
 // Field.int is incremented by Field.Push() called when the
 // SQL statement is built. This needs to be propagated to the model.
@@ -760,6 +1076,26 @@ func (t Table) insertSQL(md *Definition) (sql string, err error) {
 	return
 }
 
+// Build model upsert SQL.
+// Mutable fields are updated on primary key conflict.
+func (t Table) upsertSQL(md *Definition) (sql string) {
+	columns := []string{}
+	for _, f := range md.RealFields(md.Fields) {
+		f.isParam = true
+		columns = append(columns, f.Name)
+	}
+	keys := []string{}
+	for _, f := range md.PkFields() {
+		keys = append(keys, f.Name)
+	}
+	update := []string{}
+	for _, f := range md.MutableFields() {
+		update = append(update, f.Name)
+	}
+	sql = t.dialect().Upsert(md.Kind, columns, keys, update)
+	return
+}
+
 // Build model update SQL.
 func (t Table) updateSQL(md *Definition, options *FilterOptions) (sql string, err error) {
 	tpl := template.New("")
@@ -780,6 +1116,7 @@ func (t Table) updateSQL(md *Definition, options *FilterOptions) (sql string, er
 			Fields:  md.MutableFields(),
 			Options: options,
 			Pk:      md.PkField(),
+			Pks:     md.PkFields(),
 		})
 	if err != nil {
 		err = liberr.Wrap(err)
@@ -805,6 +1142,7 @@ func (t Table) deleteSQL(md *Definition) (sql string, err error) {
 		TmplData{
 			Table: md.Kind,
 			Pk:    md.PkField(),
+			Pks:   md.PkFields(),
 		})
 	if err != nil {
 		err = liberr.Wrap(err)
@@ -830,6 +1168,7 @@ func (t Table) getSQL(md *Definition) (sql string, err error) {
 		TmplData{
 			Table:  md.Kind,
 			Pk:     md.PkField(),
+			Pks:    md.PkFields(),
 			Fields: md.Fields,
 		})
 	if err != nil {
@@ -919,7 +1258,10 @@ func (t Table) scan(row Row, fields []*Field) (err error) {
 		return
 	}
 	for _, f := range fields {
-		f.Push()
+		err = f.Push()
+		if err != nil {
+			return
+		}
 	}
 
 	return
@@ -939,6 +1281,8 @@ type TmplData struct {
 	Keys []*Field
 	// Primary key.
 	Pk *Field
+	// Primary key fields.
+	Pks []*Field
 	// Filter options.
 	Options *FilterOptions
 	// Count
@@ -947,7 +1291,7 @@ type TmplData struct {
 
 // Predicate
 func (t TmplData) Predicate() Predicate {
-	return t.Options.Predicate
+	return t.Options.predicate
 }
 
 // Pagination.
@@ -960,12 +1304,19 @@ func (t TmplData) Sort() []int {
 	return t.Options.Sort
 }
 
+// Sort (by field name) criteria.
+func (t TmplData) SortBy() []string {
+	return t.Options.sortBy
+}
+
 // FilterOptions options.
 type FilterOptions struct {
 	// Pagination.
 	Page *Page
 	// Sort by field position.
 	Sort []int
+	// Sort by field name (after Sort).
+	SortBy []string
 	// Field detail level.
 	// Defaults:
 	//   0 = primary and natural fields.
@@ -973,20 +1324,62 @@ type FilterOptions struct {
 	Detail int
 	// Predicate
 	Predicate Predicate
+	// Changed since the revision (0=disabled).
+	// Requires a `revision` field.
+	SinceRevision int64
+	// Predicate built (including SinceRevision).
+	predicate Predicate
+	// Sort (column) names.
+	sortBy []string
 	// Table (name).
 	table string
 	// Fields.
 	fields []*Field
 	// Params.
 	params []interface{}
+	// SQL dialect.
+	dialect Dialect
 }
 
 // Validate options.
 func (l *FilterOptions) Build(md *Definition) (err error) {
 	l.table = md.Kind
 	l.fields = md.Fields
-	if l.Predicate != nil {
-		err = l.Predicate.Build(l)
+	l.dialect = md.dialect
+	l.params = nil
+	l.predicate = l.Predicate
+	l.sortBy = nil
+	for _, name := range l.SortBy {
+		f := md.Field(name)
+		if f == nil {
+			err = liberr.Wrap(
+				SortRefErr,
+				"kind",
+				md.Kind,
+				"field",
+				name)
+			return
+		}
+		l.sortBy = append(l.sortBy, f.Name)
+	}
+	if l.SinceRevision > 0 {
+		f := md.RevisionField()
+		if f == nil {
+			err = liberr.Wrap(
+				RevisionFieldErr,
+				"kind",
+				md.Kind)
+			return
+		}
+		since := Gt(f.Name, l.SinceRevision)
+		if l.predicate != nil {
+			l.predicate = And(since, l.predicate)
+		} else {
+			l.predicate = since
+		}
+	}
+	if l.predicate != nil {
+		err = l.predicate.Build(l)
 	}
 
 	return
@@ -997,7 +1390,7 @@ func (l *FilterOptions) Build(md *Definition) (err error) {
 func (l *FilterOptions) Param(name string, value interface{}) (p string) {
 	name = fmt.Sprintf("%s%d", name, len(l.params))
 	l.params = append(l.params, sql.Named(name, value))
-	p = ":" + name
+	p = dialectOf(l.dialect).Param(name)
 	return
 }
 
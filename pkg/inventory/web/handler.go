@@ -1,6 +1,7 @@
 package web
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
@@ -67,6 +68,58 @@ func (h *Paged) setPage(ctx *gin.Context) int {
 	return http.StatusOK
 }
 
+// Filtered handler.
+type Filtered struct {
+	// The `filter` parameter passed in the request
+	// parsed into a predicate. Nil when not passed.
+	Filter model.Predicate
+}
+
+// Prepare the handler to fulfil the request.
+// Set the `filter` field using the passed parameter. The
+// filter is validated using the model definition.
+func (h *Filtered) Prepare(ctx *gin.Context, m interface{}) int {
+	h.Filter = nil
+	expr := ctx.Request.URL.Query().Get("filter")
+	if len(expr) == 0 {
+		return http.StatusOK
+	}
+	md, err := model.Inspect(m)
+	if err != nil {
+		return http.StatusInternalServerError
+	}
+	h.Filter, err = model.Parse(expr, md)
+	if err != nil {
+		log.Real.V(3).Info(
+			"handler: filter not valid.",
+			"url",
+			ctx.Request.URL,
+			"reason",
+			err.Error())
+		return http.StatusBadRequest
+	}
+
+	return http.StatusOK
+}
+
+// Snapshot handler.
+// Multi-query responses are read within a consistent
+// snapshot of the DB.
+type Snapshot struct {
+}
+
+// Read within a consistent snapshot.
+// Returns the http status for the error returned by `fn`.
+func (h *Snapshot) Read(db model.DB, fn func(model.Reader) error) int {
+	err := db.Snapshot(fn)
+	status := ErrorStatus(err)
+	if status == http.StatusInternalServerError {
+		log.Trace(err)
+	}
+
+	return status
+}
+
 // Parity (not-partial) request handler.
 type Parity struct {
 }
@@ -106,6 +159,8 @@ type Event struct {
 	Resource interface{}
 	// Updated resource.
 	Updated interface{}
+	// Commit revision.
+	Revision int64
 }
 
 // String representation.
@@ -262,9 +317,10 @@ func (r *WatchWriter) send(e model.Event) {
 		return
 	}
 	event := Event{
-		ID:     e.ID,
-		Labels: e.Labels,
-		Action: e.Action,
+		ID:       e.ID,
+		Labels:   e.Labels,
+		Action:   e.Action,
+		Revision: e.Revision,
 	}
 	if e.Model != nil {
 		event.Resource = r.builder(e.Model)
@@ -367,6 +423,9 @@ type SchemaHandler struct {
 	Version string
 	// Schema release.
 	Release int
+	// DB (optional).
+	// The data model schema is published when set.
+	DB model.DB
 }
 
 // Add routes.
@@ -378,9 +437,10 @@ func (h *SchemaHandler) AddRoutes(r *gin.Engine) {
 // List schema.
 func (h *SchemaHandler) List(ctx *gin.Context) {
 	type Schema struct {
-		Version string   `json:"version,omitempty"`
-		Release int      `json:"release,omitempty"`
-		Paths   []string `json:"paths"`
+		Version string              `json:"version,omitempty"`
+		Release int                 `json:"release,omitempty"`
+		Paths   []string            `json:"paths"`
+		Models  []model.ModelSchema `json:"models,omitempty"`
 	}
 	schema := Schema{
 		Version: h.Version,
@@ -390,6 +450,9 @@ func (h *SchemaHandler) List(ctx *gin.Context) {
 	for _, rte := range h.router.Routes() {
 		schema.Paths = append(schema.Paths, rte.Path)
 	}
+	if h.DB != nil {
+		schema.Models = h.DB.Schema().Models
+	}
 
 	ctx.JSON(http.StatusOK, schema)
 }
@@ -398,3 +461,29 @@ func (h *SchemaHandler) List(ctx *gin.Context) {
 func (h SchemaHandler) Get(ctx *gin.Context) {
 	ctx.Status(http.StatusMethodNotAllowed)
 }
+
+// Get the http status for the (model) error.
+//
+//	NotFound = 404
+//	ConflictErr = 409
+//	FkViolationErr|NotNullErr|ConstraintErr = 422
+//	BusyErr = 503
+//	other = 500
+func ErrorStatus(err error) int {
+	switch {
+	case err == nil:
+		return http.StatusOK
+	case errors.Is(err, model.NotFound):
+		return http.StatusNotFound
+	case errors.Is(err, model.ConflictErr):
+		return http.StatusConflict
+	case errors.Is(err, model.FkViolationErr),
+		errors.Is(err, model.NotNullErr),
+		errors.Is(err, model.ConstraintErr):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, model.BusyErr):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}